@@ -49,8 +49,8 @@ func BenchmarkServer(b *testing.B) {
 		server.Fallback("/", http.StatusNotFound),
 	)
 	unzipHandler := http.FileServer(http.FS(fs))
-	staticZipHandler := server.Caching()(http.FileServer(http.FS(zipfs)))
-	dynamicZipHandler := server.Caching()(middleware.Compress(5, config.Gzip.MediaTypes...)(unzipHandler))
+	staticZipHandler := server.Caching(zipfs)(http.FileServer(http.FS(zipfs)))
+	dynamicZipHandler := server.Caching(fs)(middleware.Compress(5, config.Gzip.MediaTypes...)(unzipHandler))
 	cspPathRegex := regexp.MustCompile(config.AngularCspReplace.FilePathRegex)
 	cspHandler := server.CspFileReplace(config.AngularCspReplace.VariableName, config.MediaTypeMap)(unzipHandler)
 	r.Handle("/*", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -6,22 +6,58 @@ import "time"
 type config struct {
 	// Log configures log properties
 	Log logConfig `koanf:"log"`
+	// TrustedProxies are CIDRs of proxies whose ClientIPHeader is used to determine the client IP
+	TrustedProxies []string `koanf:"trustedproxies"`
+	// ClientIPHeader is the forwarding header set by the trusted proxies: X-Forwarded-For, Forwarded or X-Real-IP. The others are ignored.
+	ClientIPHeader string `koanf:"clientipheader"`
 	// RateLimit is the configuration of the global or per IP request rate limit
 	RateLimit rateLimitConfig `koanf:"ratelimit"`
+	// IPFilter restricts path prefixes to client IPs
+	IPFilter ipFilterConfig `koanf:"ipfilter"`
+	// BasicAuth protects path prefixes with HTTP Basic authentication
+	BasicAuth basicAuthConfig `koanf:"basicauth"`
+	// OIDC protects path prefixes with an OpenID Connect login
+	OIDC oidcConfig `koanf:"oidc"`
+	// JWT protects path prefixes with JWT verification
+	JWT jwtConfig `koanf:"jwt"`
+	// SignedURLs protects path prefixes with signed, expiring URLs
+	SignedURLs signedURLsConfig `koanf:"signedurls"`
 	// Headers is a map of static HTTP response headers
 	Headers map[string]string `koanf:"headers"`
+	// HeaderRules is an ordered list of rules that modify the HTTP response headers per path and media type, all matching rules apply
+	HeaderRules []headerRuleConfig `koanf:"headerrules"`
+	// CacheControl is an ordered list of rules that set the Cache-Control HTTP response header per path, the first matching rule applies
+	CacheControl []cacheControlRuleConfig `koanf:"cachecontrol"`
 	// MediaTypeMap is a map of file extensions like ".jk" to corresponding media types.
 	MediaTypeMap map[string]string `koanf:"mediatypes"`
+	// Redirects is an ordered list of redirect and internal rewrite rules, the first matching rule applies
+	Redirects []redirectRuleConfig `koanf:"redirects"`
+	// RedirectsFile is the name of a Netlify-style _redirects file in the served directory. Its rules apply after the Redirects. Set to empty to disable.
+	RedirectsFile string `koanf:"redirectsfile"`
 	// FallbackPath is the path that should be used as an alternative on HTTP 404 responses. Set to empty to disable.
 	FallbackPath string `koanf:"fallback"`
+	// Mounts serve sub-directories under path prefixes with their own fallback, the longest matching prefix applies
+	Mounts []mountConfig `koanf:"mounts"`
+	// Proxy forwards path prefixes to upstream servers, all HTTP methods are allowed for them. They apply to all vhosts.
+	Proxy []proxyRouteConfig `koanf:"proxy"`
 	// Metrics holds the configuration for prometheus metrics
 	Metrics metricsConfig `koanf:"metrics"`
 	// MemoryFs enables the in-memory filesystem
 	MemoryFs bool `koanf:"memoryfs"`
+	// MemoryFsWatch holds the configuration for hot reloading the in-memory filesystem
+	MemoryFsWatch memoryFsWatchConfig `koanf:"memoryfswatch"`
 	// H2C enables the h2c (unencrypted HTTP2) endpoint
 	H2C bool `koanf:"h2c"`
 	// Health enables the health endpoint
 	Health bool `koanf:"health"`
+	// TLS holds the configuration for TLS termination of the webserver
+	TLS tlsConfig `koanf:"tls"`
+	// HTTP3 holds the configuration for the HTTP/3 (QUIC) listener
+	HTTP3 http3Config `koanf:"http3"`
+	// HTTPSRedirect holds the configuration for the plaintext listener that redirects to HTTPS
+	HTTPSRedirect httpsRedirectConfig `koanf:"httpsredirect"`
+	// ProxyProtocol holds the configuration for PROXY protocol headers from load balancers
+	ProxyProtocol proxyProtocolConfig `koanf:"proxyprotocol"`
 	// Port holds the configuration for various TCP ports
 	Port portConfig `koanf:"port"`
 	// Gzip holds the configuration for gzip compression handling
@@ -32,6 +68,100 @@ type config struct {
 	ShutdownDelay int `koanf:"shutdowndelay"`
 	// AngularCspReplace holds the configuration for angular csp fix
 	AngularCspReplace angularCspReplaceConfig `koanf:"angularcsp"`
+	// VHosts maps host names to their own root directory and site settings, unmatched hosts are served from the target-path argument
+	VHosts []vhostConfig `koanf:"vhosts"`
+}
+
+// mountConfig serves a sub-directory under a path prefix, e.g. a single page application
+type mountConfig struct {
+	// Prefix is the path prefix like /admin/
+	Prefix string `koanf:"prefix"`
+	// Dir is the sub-directory of the served directory, defaults to the prefix
+	Dir string `koanf:"dir"`
+	// FallbackPath is the path within Dir that is served on the FallbackCodes, e.g. /index.html. Set to empty to disable.
+	FallbackPath string `koanf:"fallback"`
+	// FallbackCodes are the HTTP status codes on which the FallbackPath is served, defaults to 404
+	FallbackCodes []int `koanf:"fallbackcodes"`
+}
+
+// proxyRouteConfig forwards a path prefix to upstream servers
+type proxyRouteConfig struct {
+	// Prefix is the path prefix like /api/, the longest matching prefix applies
+	Prefix string `koanf:"prefix"`
+	// Upstreams are the base URLs of the backends like http://backend:8080, the requests are distributed round-robin between the healthy ones
+	Upstreams []string `koanf:"upstreams"`
+	// StripPrefix removes the prefix from the path before it is appended to the upstream URL
+	StripPrefix bool `koanf:"stripprefix"`
+	// PreserveHost forwards the Host header of the client instead of the upstream host
+	PreserveHost bool `koanf:"preservehost"`
+	// RequestHeaders are applied to the forwarded requests
+	RequestHeaders headerRewriteConfig `koanf:"requestheaders"`
+	// ResponseHeaders are applied to the upstream responses
+	ResponseHeaders headerRewriteConfig `koanf:"responseheaders"`
+	// ConnectTimeout bounds establishing the connection to an upstream
+	ConnectTimeout time.Duration `koanf:"connecttimeout"`
+	// Timeout bounds the wait for the upstream response headers
+	Timeout time.Duration `koanf:"timeout"`
+	// Retries is the number of retries with the next upstream for idempotent requests without body on connection errors
+	Retries int `koanf:"retries"`
+	// HealthCheck holds the configuration for the active upstream health checks
+	HealthCheck healthCheckConfig `koanf:"healthcheck"`
+}
+
+// headerRewriteConfig deletes and then sets HTTP headers
+type headerRewriteConfig struct {
+	// Set is a map of headers that are set
+	Set map[string]string `koanf:"set"`
+	// Delete is a list of headers that are removed
+	Delete []string `koanf:"delete"`
+}
+
+// healthCheckConfig holds the configuration for the active upstream health checks
+type healthCheckConfig struct {
+	// Path is requested on every upstream, upstreams that answer with a status code below 400 are healthy. Empty disables the health checks.
+	Path string `koanf:"path"`
+	// Interval between the health checks, defaults to 10s
+	Interval time.Duration `koanf:"interval"`
+	// Timeout of a single health check request
+	Timeout time.Duration `koanf:"timeout"`
+}
+
+// vhostSiteKeys are the config keys that can be set per virtual host, the top-level values are the defaults
+var vhostSiteKeys = []string{"headers", "fallback", "mounts", "memoryfs", "memoryfswatch", "gzip", "angularcsp"}
+
+// vhostConfig holds the configuration for a virtual host
+type vhostConfig struct {
+	// Hosts are the host names served by this virtual host, wildcards like *.example.com match all subdomains
+	Hosts []string `koanf:"hosts"`
+	// Root is the directory that is served for the Hosts
+	Root string `koanf:"root"`
+	// Headers is a map of static HTTP response headers, merged with the top-level headers
+	Headers map[string]string `koanf:"headers"`
+	// FallbackPath is the path that should be used as an alternative on HTTP 404 responses. Set to empty to disable.
+	FallbackPath string `koanf:"fallback"`
+	// Mounts serve sub-directories under path prefixes with their own fallback, the longest matching prefix applies
+	Mounts []mountConfig `koanf:"mounts"`
+	// MemoryFs enables the in-memory filesystem
+	MemoryFs bool `koanf:"memoryfs"`
+	// MemoryFsWatch holds the configuration for hot reloading the in-memory filesystem
+	MemoryFsWatch memoryFsWatchConfig `koanf:"memoryfswatch"`
+	// Gzip holds the configuration for gzip compression handling
+	Gzip gzipConfig `koanf:"gzip"`
+	// AngularCspReplace holds the configuration for angular csp fix
+	AngularCspReplace angularCspReplaceConfig `koanf:"angularcsp"`
+}
+
+// apply returns a copy of the config with the site settings of the virtual host
+func (vhost *vhostConfig) apply(conf *config) *config {
+	result := *conf
+	result.Headers = vhost.Headers
+	result.FallbackPath = vhost.FallbackPath
+	result.Mounts = vhost.Mounts
+	result.MemoryFs = vhost.MemoryFs
+	result.MemoryFsWatch = vhost.MemoryFsWatch
+	result.Gzip = vhost.Gzip
+	result.AngularCspReplace = vhost.AngularCspReplace
+	return &result
 }
 
 // logConfig holds configuration regarding logging
@@ -54,6 +184,54 @@ type accessLogConfig struct {
 	Metrics bool `koanf:"metrics"`
 }
 
+// cacheControlRuleConfig holds a single Cache-Control rule, all set conditions have to match
+type cacheControlRuleConfig struct {
+	// Glob is a path pattern where * matches within a path segment and ** across path segments, e.g. /assets/**.js
+	Glob string `koanf:"glob"`
+	// Regex is a regular expression for the path, e.g. ^/assets/.*\.js$
+	Regex string `koanf:"regex"`
+	// Hashed only matches file names that contain a content hash like main.3f9a1c.js
+	Hashed bool `koanf:"hashed"`
+	// Value is the Cache-Control HTTP response header value
+	Value string `koanf:"value"`
+}
+
+// headerRuleConfig holds a single rule for HTTP response header modifications, all set conditions have to match
+type headerRuleConfig struct {
+	// Prefix is a path prefix, e.g. /fonts/
+	Prefix string `koanf:"prefix"`
+	// Glob is a path pattern where * matches within a path segment and ** across path segments, e.g. /assets/**.js
+	Glob string `koanf:"glob"`
+	// Regex is a regular expression for the path, e.g. ^/assets/.*\.js$
+	Regex string `koanf:"regex"`
+	// MediaTypes are matched against the response Content-Type, wildcards like font/* are supported
+	MediaTypes []string `koanf:"mediatypes"`
+	// Set overwrites the given HTTP response headers
+	Set map[string]string `koanf:"set"`
+	// Append adds values to the given HTTP response headers
+	Append map[string]string `koanf:"append"`
+	// Delete removes the given HTTP response headers
+	Delete []string `koanf:"delete"`
+}
+
+// redirectRuleConfig holds a single redirect or rewrite rule, exactly one of path, prefix or regex has to be set
+type redirectRuleConfig struct {
+	// Host restricts the rule to the given host, wildcards like *.example.com match all subdomains
+	Host string `koanf:"host"`
+	// Path is an exact path with optional placeholders and a trailing wildcard, e.g. /blog/:slug or /old-docs/*
+	Path string `koanf:"path"`
+	// Prefix is a path prefix, the remaining path is available as :splat
+	Prefix string `koanf:"prefix"`
+	// Regex is a regular expression for the path, the capture groups are available as $1 or ${name}
+	Regex string `koanf:"regex"`
+	// To is the target path or URL, e.g. /docs/:splat
+	To string `koanf:"to"`
+	// Status is the redirect status code (301, 302, 307, 308) or 200 for an internal rewrite
+	Status int `koanf:"status"`
+	// Force also applies the rule if a file exists at the request path
+	Force bool `koanf:"force"`
+}
+
 // metricsConfig holds the prometheus metrics configuration
 type metricsConfig struct {
 	// Enabled activates the prometheus metrics endpoint
@@ -62,6 +240,14 @@ type metricsConfig struct {
 	Namespace string `koanf:"namespace"`
 }
 
+// memoryFsWatchConfig holds the configuration for hot reloading the in-memory filesystem
+type memoryFsWatchConfig struct {
+	// Enabled activates watching the served directory and reloading the in-memory filesystem on changes
+	Enabled bool `koanf:"enabled"`
+	// Debounce is the time to wait for further changes before the reload is executed
+	Debounce time.Duration `koanf:"debounce"`
+}
+
 // portConfig holds configurations for various TCP ports
 type portConfig struct {
 	// Webserver is the TCP port for the main web server
@@ -72,6 +258,108 @@ type portConfig struct {
 	Metrics uint16 `koanf:"metrics"`
 	// H2c is the TCP port for h2c (unecncrypted http2)
 	H2c uint16 `koanf:"h2c"`
+	// HTTP is the TCP port for the plaintext HTTP to HTTPS redirect listener
+	HTTP uint16 `koanf:"http"`
+	// H3 is the UDP port that is advertised for HTTP/3
+	H3 uint16 `koanf:"h3"`
+}
+
+// proxyProtocolConfig holds the configuration for PROXY protocol v1 and v2 headers on the webserver and https redirect listeners
+type proxyProtocolConfig struct {
+	// Enabled activates parsing the PROXY headers
+	Enabled bool `koanf:"enabled"`
+	// Mode is strict (allowed upstreams have to send the header, other upstreams must not) or lenient (optional for allowed upstreams, ignored for others)
+	Mode string `koanf:"mode"`
+	// Allowed are the CIDRs of the upstreams like load balancers that are allowed to send the PROXY header
+	Allowed []string `koanf:"allowed"`
+	// ReadHeaderTimeout is the maximal duration to wait for the PROXY header
+	ReadHeaderTimeout time.Duration `koanf:"readheadertimeout"`
+}
+
+// http3Config holds the configuration for the HTTP/3 (QUIC) listener
+type http3Config struct {
+	// Enabled activates the HTTP/3 listener on the UDP port with the number of the webserver port, requires tls.enabled
+	Enabled bool `koanf:"enabled"`
+	// IdleTimeout closes connections without HTTP/3 activity
+	IdleTimeout time.Duration `koanf:"idletimeout"`
+	// HandshakeTimeout is the maximal duration of the QUIC handshake
+	HandshakeTimeout time.Duration `koanf:"handshaketimeout"`
+}
+
+// tlsConfig holds the configuration for TLS termination
+type tlsConfig struct {
+	// Enabled activates TLS termination for the webserver port
+	Enabled bool `koanf:"enabled"`
+	// Cert is the path to the PEM encoded certificate (chain) file
+	Cert string `koanf:"cert"`
+	// Key is the path to the PEM encoded private key file
+	Key string `koanf:"key"`
+	// SNI holds additional certificates that are selected by the server name of the client. Cert and Key are the default certificate.
+	SNI []sniCertConfig `koanf:"sni"`
+	// MinVersion is the minimal TLS version, valid values are 1.0, 1.1, 1.2 and 1.3
+	MinVersion string `koanf:"minversion"`
+	// CipherSuites restricts the TLS 1.2 (and lower) cipher suites, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Empty uses the Go defaults.
+	CipherSuites []string `koanf:"ciphersuites"`
+	// ReloadDebounce is the time to wait for further changes of the certificate files before they are reloaded
+	ReloadDebounce time.Duration `koanf:"reloaddebounce"`
+	// ACME holds the configuration for obtaining the certificates via ACME instead of the Cert and Key files
+	ACME acmeConfig `koanf:"acme"`
+	// ClientAuth holds the configuration for the verification of client certificates (mutual TLS)
+	ClientAuth clientAuthConfig `koanf:"clientauth"`
+}
+
+// sniCertConfig holds a certificate for the given SNI names
+type sniCertConfig struct {
+	// Names are the server names for which the certificate is used, wildcards like *.example.com match a single label
+	Names []string `koanf:"names"`
+	// Cert is the path to the PEM encoded certificate (chain) file
+	Cert string `koanf:"cert"`
+	// Key is the path to the PEM encoded private key file
+	Key string `koanf:"key"`
+}
+
+// clientAuthConfig holds the configuration for mutual TLS
+type clientAuthConfig struct {
+	// Mode is one of none, optional (verify if presented) or required
+	Mode string `koanf:"mode"`
+	// CA is the path to the PEM encoded CA bundle against which the client certificates are verified
+	CA string `koanf:"ca"`
+	// Rules restrict path prefixes to (matching) verified client certificates, the first rule with a matching prefix applies
+	Rules []clientCertRuleConfig `koanf:"rules"`
+}
+
+// clientCertRuleConfig restricts a path prefix to verified client certificates, all verified certificates match if Subjects and SANs are empty
+type clientCertRuleConfig struct {
+	// Prefix is the path prefix, e.g. /admin/
+	Prefix string `koanf:"prefix"`
+	// Subjects are matched against the common name and the distinguished name of the certificate subject
+	Subjects []string `koanf:"subjects"`
+	// SANs are matched against the DNS, email and URI subject alternative names of the certificate
+	SANs []string `koanf:"sans"`
+}
+
+// acmeConfig holds the configuration for ACME certificate issuance
+type acmeConfig struct {
+	// Enabled activates ACME, the HTTP-01 challenge requires the httpsredirect listener, TLS-ALPN-01 is answered on the webserver port
+	Enabled bool `koanf:"enabled"`
+	// Domains are the domain names for which certificates are obtained
+	Domains []string `koanf:"domains"`
+	// Email is the optional contact address for the ACME account
+	Email string `koanf:"email"`
+	// CacheDir is the directory where the certificates and the account key are cached, it has to be writable
+	CacheDir string `koanf:"cachedir"`
+	// Directory is the URL of the ACME directory
+	Directory string `koanf:"directory"`
+	// RenewBefore is the duration before the expiry at which certificates are renewed, zero uses the lesser of 30 days or a third of the certificate lifetime
+	RenewBefore time.Duration `koanf:"renewbefore"`
+}
+
+// httpsRedirectConfig holds the configuration for the HTTP to HTTPS redirect listener
+type httpsRedirectConfig struct {
+	// Enabled activates the redirect listener on the http port, requires that TLS is enabled
+	Enabled bool `koanf:"enabled"`
+	// Port is the public HTTPS port used for the redirect location, e.g. when the webserver port is mapped to 443
+	Port uint16 `koanf:"port"`
 }
 
 // gzipConfig holds configuration for gzip response compression
@@ -82,6 +370,8 @@ type gzipConfig struct {
 	CompressionLevel int `koanf:"compression"`
 	// MediaTypes is a slice of media type (according to the response HTTP Content-Type header) that should be compressed
 	MediaTypes []string `koanf:"mediatypes"`
+	// Encodings is a slice of content encodings for which precompressed sidecar files are served, the order is the server preference
+	Encodings []string `koanf:"encodings"`
 }
 
 // timeoutConfig holds various timeouts
@@ -116,10 +406,152 @@ type cookieConfig struct {
 	MaxAge int `koanf:"maxage"`
 }
 
+// ipFilterConfig holds the client IP allow and deny lists
+type ipFilterConfig struct {
+	// Rules restrict path prefixes to client IPs, the longest matching prefix applies
+	Rules []ipFilterRuleConfig `koanf:"rules"`
+	// ReloadDebounce is the time to wait for further changes of the list files before they are reloaded
+	ReloadDebounce time.Duration `koanf:"reloaddebounce"`
+}
+
+// ipFilterRuleConfig restricts a path prefix to client IPs, denied IPs are rejected first and if allowed IPs are set all others are rejected
+type ipFilterRuleConfig struct {
+	// Prefix is the path prefix like /internal/, empty for all paths
+	Prefix string `koanf:"prefix"`
+	// Allow are CIDRs or single IPs that are allowed
+	Allow []string `koanf:"allow"`
+	// Deny are CIDRs or single IPs that are rejected
+	Deny []string `koanf:"deny"`
+	// AllowFile is the path to a file with additional allowed CIDRs, one per line. It is reloaded on changes.
+	AllowFile string `koanf:"allowfile"`
+	// DenyFile is the path to a file with additional denied CIDRs, one per line. It is reloaded on changes.
+	DenyFile string `koanf:"denyfile"`
+}
+
+// basicAuthConfig holds the configuration for HTTP Basic authentication, the health endpoint is not affected
+type basicAuthConfig struct {
+	// Enabled activates the authentication
+	Enabled bool `koanf:"enabled"`
+	// Htpasswd is the path to the htpasswd file with bcrypt, {SHA} or argon2 hashes, it is reloaded on changes
+	Htpasswd string `koanf:"htpasswd"`
+	// Rules are the protected path prefixes, the longest matching prefix applies
+	Rules []basicAuthRuleConfig `koanf:"rules"`
+	// MaxFailures is the number of failed attempts per client IP and failure window after which further attempts are rejected, zero disables the limit
+	MaxFailures int `koanf:"maxfailures"`
+	// FailureWindow is the time window for which the maximal number of failed attempts applies
+	FailureWindow time.Duration `koanf:"failurewindow"`
+	// ReloadDebounce is the time to wait for further changes of the htpasswd file before it is reloaded
+	ReloadDebounce time.Duration `koanf:"reloaddebounce"`
+}
+
+// basicAuthRuleConfig protects a path prefix
+type basicAuthRuleConfig struct {
+	// Prefix is the path prefix like /preview/, empty for all paths
+	Prefix string `koanf:"prefix"`
+	// Realm is shown by the browser in the login dialog
+	Realm string `koanf:"realm"`
+}
+
+// oidcConfig holds the configuration for the OpenID Connect login, the health endpoint is not affected
+type oidcConfig struct {
+	// Enabled activates the login
+	Enabled bool `koanf:"enabled"`
+	// Issuer is the issuer URL of the identity provider, its endpoints are discovered via /.well-known/openid-configuration
+	Issuer       string `koanf:"issuer"`
+	ClientID     string `koanf:"clientid"`
+	ClientSecret string `koanf:"clientsecret"`
+	// RedirectURL is the absolute callback URL registered at the identity provider, its path is handled by websrv
+	RedirectURL string `koanf:"redirecturl"`
+	// Scopes are requested in addition to the openid scope
+	Scopes []string `koanf:"scopes"`
+	// Prefixes are the protected path prefixes, all paths are protected if empty
+	Prefixes []string `koanf:"prefixes"`
+	// AllowedDomains restricts the logins to verified email addresses of these domains
+	AllowedDomains []string `koanf:"alloweddomains"`
+	// AllowedGroups restricts the logins to members of these groups, a login is allowed if either the domain or a group matches
+	AllowedGroups []string `koanf:"allowedgroups"`
+	// GroupsClaim is the ID token claim that holds the groups
+	GroupsClaim string `koanf:"groupsclaim"`
+	// CookieName is the name of the session cookie
+	CookieName string `koanf:"cookiename"`
+	// CookieSecret encrypts the session cookie, has to be at least 32 characters long
+	CookieSecret string `koanf:"cookiesecret"`
+	// SessionDuration is the lifetime of the session cookie
+	SessionDuration time.Duration `koanf:"sessionduration"`
+}
+
+// jwtConfig holds the configuration for the verification of JWTs from the Authorization header or a cookie, the health endpoint is not affected
+type jwtConfig struct {
+	// Enabled activates the verification
+	Enabled bool `koanf:"enabled"`
+	// Issuer is the required iss claim
+	Issuer string `koanf:"issuer"`
+	// Audience has to be contained in the aud claim
+	Audience string `koanf:"audience"`
+	// JWKSFile is the path to a JSON Web Key Set file, it is reloaded on changes. Either the JWKSFile or the JWKSURL has to be set.
+	JWKSFile string `koanf:"jwksfile"`
+	// JWKSURL is fetched every refresh interval and for unknown key ids
+	JWKSURL string `koanf:"jwksurl"`
+	// RefreshInterval is the time between two fetches of the JWKSURL
+	RefreshInterval time.Duration `koanf:"refreshinterval"`
+	// ReloadDebounce is the time to wait for further changes of the JWKSFile before it is reloaded
+	ReloadDebounce time.Duration `koanf:"reloaddebounce"`
+	// CookieName is the cookie that holds the token if there is no Authorization header, empty to only accept the header
+	CookieName string `koanf:"cookiename"`
+	// Leeway is the allowed clock skew for the exp, nbf and iat claims
+	Leeway time.Duration `koanf:"leeway"`
+	// Rules are the protected path prefixes, the longest matching prefix applies
+	Rules []jwtRuleConfig `koanf:"rules"`
+}
+
+// jwtRuleConfig protects a path prefix
+type jwtRuleConfig struct {
+	// Prefix is the path prefix like /assets/, empty for all paths
+	Prefix string `koanf:"prefix"`
+	// Claims are required, a string claim has to be equal to the value and an array claim has to contain it
+	Claims map[string]string `koanf:"claims"`
+}
+
+// signedURLsConfig holds the configuration for signed, expiring URLs, the health endpoint is not affected
+type signedURLsConfig struct {
+	// Enabled activates the verification
+	Enabled bool `koanf:"enabled"`
+	// Prefixes are the protected path prefixes, all paths are protected if empty
+	Prefixes []string `koanf:"prefixes"`
+	// Keys are all accepted for the verification, the sign subcommand uses the first key by default
+	Keys []signedURLKeyConfig `koanf:"keys"`
+}
+
+// signedURLKeyConfig is either an HMAC-SHA256 secret or an Ed25519 key
+type signedURLKeyConfig struct {
+	// ID is added to the signed URLs to select the key
+	ID string `koanf:"id"`
+	// Secret is the HMAC-SHA256 secret
+	Secret string `koanf:"secret"`
+	// PublicKey is the base64 encoded Ed25519 public key
+	PublicKey string `koanf:"publickey"`
+	// PrivateKey is the base64 encoded Ed25519 seed, it is only required for the sign subcommand
+	PrivateKey string `koanf:"privatekey"`
+}
+
 // rateLimitConfig holds the configuration for rate limiting
 type rateLimitConfig struct {
-	// Enabled activates the gzip response compression
+	// Enabled activates the rate limiting
 	Enabled bool `koanf:"enabled"`
+	// ByIP counts the requests per client IP instead of globally, see TrustedProxies
+	ByIP bool `koanf:"byip"`
+	// Requests is the number of requests allowed per time window
+	MaxRequests int `koanf:"max_requests"`
+	// TimeWindow is the time window for which the maximal number of requests applies
+	TimeWindow time.Duration `koanf:"timewindow"`
+	// Rules override the limit per path prefix with separate request counters, the longest matching prefix applies
+	Rules []rateLimitRuleConfig `koanf:"rules"`
+}
+
+// rateLimitRuleConfig overrides the rate limit for a path prefix
+type rateLimitRuleConfig struct {
+	// Prefix is the path prefix like /api/
+	Prefix string `koanf:"prefix"`
 	// Requests is the number of requests allowed per time window
 	MaxRequests int `koanf:"max_requests"`
 	// TimeWindow is the time window for which the maximal number of requests applies
@@ -128,7 +560,8 @@ type rateLimitConfig struct {
 
 //nolint:mnd
 var defaultConfig = config{
-	Log: logConfig{Level: "info"},
+	Log:            logConfig{Level: "info"},
+	ClientIPHeader: "X-Forwarded-For",
 	RateLimit: rateLimitConfig{
 		Enabled:     false,
 		MaxRequests: 400,
@@ -139,10 +572,13 @@ var defaultConfig = config{
 		Health:    8081,
 		Metrics:   9090,
 		H2c:       443,
+		HTTP:      8082,
+		H3:        443,
 	},
 	Gzip: gzipConfig{
 		CompressionLevel: 5,
 		MediaTypes:       []string{"text/css", "text/html", "text/javascript", "font/tff"},
+		Encodings:        []string{"br", "zstd", "gzip"},
 	},
 	MediaTypeMap: map[string]string{
 		".js":    "application/javascript",
@@ -155,6 +591,29 @@ var defaultConfig = config{
 		".woff2": "font/woff2",
 		".txt":   "text/plain",
 	},
+	RedirectsFile: "_redirects",
+	MemoryFsWatch: memoryFsWatchConfig{Debounce: time.Second},
+	TLS: tlsConfig{
+		MinVersion:     "1.2",
+		ReloadDebounce: time.Second,
+		ClientAuth:     clientAuthConfig{Mode: "none"},
+		ACME: acmeConfig{
+			CacheDir:  "/tmp/websrv/acme",
+			Directory: "https://acme-v02.api.letsencrypt.org/directory",
+		},
+	},
+	HTTP3:         http3Config{IdleTimeout: 30 * time.Second, HandshakeTimeout: 10 * time.Second},
+	HTTPSRedirect: httpsRedirectConfig{Port: 443},
+	IPFilter:      ipFilterConfig{ReloadDebounce: time.Second},
+	BasicAuth:     basicAuthConfig{MaxFailures: 10, FailureWindow: 15 * time.Minute, ReloadDebounce: time.Second},
+	OIDC: oidcConfig{
+		Scopes:          []string{"email", "profile"},
+		GroupsClaim:     "groups",
+		CookieName:      "websrv_oidc",
+		SessionDuration: 8 * time.Hour,
+	},
+	JWT:           jwtConfig{RefreshInterval: time.Hour, ReloadDebounce: time.Second, Leeway: 30 * time.Second},
+	ProxyProtocol: proxyProtocolConfig{Mode: "strict", ReadHeaderTimeout: 10 * time.Second},
 	Metrics:       metricsConfig{Namespace: "websrv"},
 	Timeout:       timeoutConfig{Idle: 30, Read: 10, Write: 10, Shutdown: 5},
 	ShutdownDelay: 5,
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/landlock-lsm/go-landlock/landlock"
+	"github.com/stretchr/testify/require"
+)
+
+// landlockIssuerEnv holds the issuer url for the child process of TestLandlockOIDC, landlock restrictions can not be undone
+const landlockIssuerEnv = "WEBSRV_TEST_LANDLOCK_ISSUER"
+
+func TestLandlockOIDC(t *testing.T) {
+	if issuer := os.Getenv(landlockIssuerEnv); issuer != "" {
+		landlockOIDC(t, issuer)
+		return
+	}
+	var idp *httptest.Server
+	idp = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/auth",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/keys",
+		})
+	}))
+	defer idp.Close()
+	// the identity provider certificate is only trusted via the CA file, which has to be readable under landlock
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: idp.Certificate().Raw}), 0o600)
+	require.NoError(t, err)
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLandlockOIDC$") //nolint:gosec // re-executes the test binary
+	cmd.Env = append(os.Environ(), landlockIssuerEnv+"="+idp.URL, "SSL_CERT_FILE="+caFile)
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+}
+
+// landlockOIDC applies the landlock restrictions for the OIDC login and discovers the identity provider at the issuer
+func landlockOIDC(t *testing.T, issuer string) {
+	conf := defaultConfig
+	conf.OIDC.Enabled = true
+	conf.OIDC.Issuer = issuer
+	conf.OIDC.ClientID = "websrv"
+	conf.OIDC.RedirectURL = "https://example.com/callback"
+	conf.OIDC.CookieName = "session"
+	conf.OIDC.CookieSecret = "0123456789abcdef0123456789abcdef"
+
+	ll := landlock.V5.BestEffort()
+	outboundDirs, outboundFiles := outboundPaths(&conf)
+	err := landlockFsDirs(ll, nil, nil, landlock.RODirs(outboundDirs...).IgnoreIfMissing(), landlock.ROFiles(outboundFiles...).IgnoreIfMissing())
+	require.NoError(t, err)
+	port, ok, err := oidcPort(&conf)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, landlockNetwork(ll, landlock.ConnectTCP(port)))
+
+	_, err = oidc(context.Background(), &conf)
+	require.NoError(t, err)
+}
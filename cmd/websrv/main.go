@@ -5,7 +5,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io/fs"
 	"net/http"
 	"os"
 	"path"
@@ -18,7 +17,6 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/httprate"
 	"github.com/landlock-lsm/go-landlock/landlock"
 	"github.com/ngergs/websrv/v5/internal/utils"
 	"github.com/prometheus/client_golang/prometheus"
@@ -34,6 +32,12 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "sign" {
+		if err := sign(os.Args[2:]); err != nil {
+			log.Fatal().Err(err).Msg("Error signing the urls")
+		}
+		return
+	}
 	ll := landlock.V5.BestEffort()
 	conf, err := readConfig()
 	if err != nil {
@@ -44,85 +48,239 @@ func main() {
 	if err != nil {
 		log.Fatal().Err(err).Msg("Error during initialization")
 	}
-	if err := landlockFsReadonlyDirs(ll, targetDir, filepath.Join("/", "proc", strconv.Itoa(os.Getpid()), "task")); err != nil {
+	tlsReadonlyDirs, writableDirs := tlsDirs(conf)
+	for _, dir := range writableDirs {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			log.Fatal().Err(err).Msgf("Error creating directory %s", dir)
+		}
+	}
+	readonlyDirs := append([]string{filepath.Join("/", "proc", strconv.Itoa(os.Getpid()), "task")}, tlsReadonlyDirs...)
+	if targetDir != "" {
+		readonlyDirs = append(readonlyDirs, targetDir)
+	}
+	for _, vhost := range conf.VHosts {
+		readonlyDirs = append(readonlyDirs, vhost.Root)
+	}
+	readonlyDirs = append(readonlyDirs, ipFilterDirs(conf)...)
+	if conf.BasicAuth.Enabled {
+		readonlyDirs = append(readonlyDirs, filepath.Dir(conf.BasicAuth.Htpasswd))
+	}
+	if conf.JWT.Enabled && conf.JWT.JWKSFile != "" {
+		readonlyDirs = append(readonlyDirs, filepath.Dir(conf.JWT.JWKSFile))
+	}
+	// the system CA certificates and resolver files are at distribution dependent locations, missing ones are skipped
+	outboundDirs, outboundFiles := outboundPaths(conf)
+	if err := landlockFsDirs(ll, readonlyDirs, writableDirs,
+		landlock.RODirs(outboundDirs...).IgnoreIfMissing(), landlock.ROFiles(outboundFiles...).IgnoreIfMissing()); err != nil {
 		log.Fatal().Err(err).Msg("")
 	}
 	var wg sync.WaitGroup
 	sigtermCtx := server.SigTermCtx(context.Background(), time.Duration(conf.ShutdownDelay)*time.Second)
-	unzipfs, zipfs := initFs(targetDir, conf)
+
+	var certs *server.SNICertificates
+	if conf.TLS.Enabled && !conf.TLS.ACME.Enabled {
+		certs, err = sniCertificates(sigtermCtx, conf)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error loading the TLS certificates")
+		}
+	}
 
 	errChan := make(chan error)
 	var promRegistration *server.PrometheusRegistration
+	var rateLimitRegistration *server.RateLimitRegistration
 	if conf.Metrics.Enabled {
 		promRegistration, err = server.AccessMetricsRegister(prometheus.DefaultRegisterer, conf.Metrics.Namespace)
 		if err != nil {
 			log.Error().Err(err).Msg("Could not register custom prometheus metrics.")
 		}
+		if conf.RateLimit.Enabled {
+			rateLimitRegistration, err = server.RateLimitMetricsRegister(prometheus.DefaultRegisterer, conf.Metrics.Namespace)
+			if err != nil {
+				log.Error().Err(err).Msg("Could not register rate limit prometheus metrics.")
+			}
+		}
+		if certs != nil {
+			if err := server.CertExpiryMetricsRegister(prometheus.DefaultRegisterer, conf.Metrics.Namespace, certs); err != nil {
+				log.Error().Err(err).Msg("Could not register certificate expiry prometheus metrics.")
+			}
+		}
+	}
+
+	cacheControlRules, err := cacheControlRules(conf)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error parsing the cache-control rules")
+	}
+
+	headerRules, err := headerRules(conf)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error parsing the header rules")
+	}
+
+	var defaultHandler http.Handler
+	if targetDir != "" {
+		defaultHandler, err = siteHandler(sigtermCtx, conf, targetDir, headerRules, cacheControlRules)
+		if err != nil {
+			log.Fatal().Err(err).Msgf("Error setting up the site %s", targetDir)
+		}
+	}
+	vhosts := make([]server.VirtualHost, len(conf.VHosts))
+	for i, vhost := range conf.VHosts {
+		log.Info().Msgf("Serving %s for the virtual hosts %v", vhost.Root, vhost.Hosts)
+		handler, err := siteHandler(sigtermCtx, vhost.apply(conf), vhost.Root, headerRules, cacheControlRules)
+		if err != nil {
+			log.Fatal().Err(err).Msgf("Error setting up the virtual host %s", vhost.Root)
+		}
+		vhosts[i] = server.VirtualHost{Hosts: vhost.Hosts, Handler: handler}
 	}
 
+	clientIPResolver, err := server.NewClientIPResolver(conf.ClientIPHeader, conf.TrustedProxies...)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error parsing the trusted proxies")
+	}
+	ipFilter, err := ipFilterRules(sigtermCtx, conf)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error setting up the ip filter")
+	}
+	var basicAuthHandler server.HandlerMiddleware
+	if conf.BasicAuth.Enabled {
+		auth, err := basicAuth(sigtermCtx, conf)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error setting up the basic authentication")
+		}
+		log.Info().Msgf("Basic authentication with %s for %d path prefixes", conf.BasicAuth.Htpasswd, len(conf.BasicAuth.Rules))
+		basicAuthHandler = server.BasicAuth(auth)
+	}
+	var oidcHandler server.HandlerMiddleware
+	if conf.OIDC.Enabled {
+		rp, err := oidc(sigtermCtx, conf)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error setting up the oidc login")
+		}
+		log.Info().Msgf("OIDC login with %s for %d path prefixes", conf.OIDC.Issuer, len(conf.OIDC.Prefixes))
+		oidcHandler = server.OIDC(rp)
+	}
+	var jwtHandler server.HandlerMiddleware
+	if conf.JWT.Enabled {
+		verifier, err := jwtVerifier(sigtermCtx, conf)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error setting up the jwt verification")
+		}
+		log.Info().Msgf("JWT verification for issuer %s and %d path prefixes", conf.JWT.Issuer, len(conf.JWT.Rules))
+		jwtHandler = server.JWT(verifier)
+	}
+	var signedURLHandler server.HandlerMiddleware
+	if conf.SignedURLs.Enabled {
+		keys, err := signedURLKeys(conf)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error reading the signed url keys")
+		}
+		verifier, err := server.NewSignedURLVerifier(keys, conf.SignedURLs.Prefixes...)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error setting up the signed url verification")
+		}
+		log.Info().Msgf("Signed urls with %d keys for %d path prefixes", len(keys), len(conf.SignedURLs.Prefixes))
+		signedURLHandler = server.SignedURL(verifier)
+	}
 	r := chi.NewRouter()
-	var rateLimitHandler func(http.Handler) http.Handler
+	var rateLimitHandler server.HandlerMiddleware
 	if conf.RateLimit.Enabled {
-		log.Info().Msgf("Rate limiting globally with %d requests per %v", conf.RateLimit.MaxRequests, conf.RateLimit.TimeWindow)
-		rateLimitHandler = httprate.LimitBy(conf.RateLimit.MaxRequests, conf.RateLimit.TimeWindow, httprate.Key("*"))
+		limiter, err := rateLimiter(conf)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error setting up the rate limits")
+		}
+		scope := "globally"
+		if conf.RateLimit.ByIP {
+			scope = "per client IP"
+		}
+		log.Info().Msgf("Rate limiting %s with %d requests per %v and %d path overrides", scope, conf.RateLimit.MaxRequests, conf.RateLimit.TimeWindow, len(conf.RateLimit.Rules))
+		rateLimitHandler = server.RateLimit(limiter, rateLimitRegistration)
 	}
 	r.Use(
+		server.RealIP(clientIPResolver),
 		server.Optional(rateLimitHandler, conf.RateLimit.Enabled),
 		server.Optional(server.H2C(conf.Port.H2c), conf.H2C),
+		server.Optional(server.HTTP3(conf.Port.H3), isHTTP3(conf)),
 		middleware.RequestID,
 		middleware.Timeout(time.Duration(conf.Timeout.Write)*time.Second),
 		server.Optional(server.AccessLog(), conf.Log.AccessLog.General),
 		server.Optional(server.AccessMetrics(promRegistration), conf.Metrics.Enabled),
-		server.Validate(),
-		server.Header(conf.Headers),
-		server.Optional(server.SessionId(conf.AngularCspReplace.SessionCookie.Name, time.Duration(conf.AngularCspReplace.SessionCookie.MaxAge)*time.Second),
-			conf.AngularCspReplace.Enabled),
-		server.Optional(server.CspHeaderReplace(conf.AngularCspReplace.VariableName), conf.AngularCspReplace.Enabled),
-		server.Optional(server.Fallback(conf.FallbackPath, http.StatusNotFound), conf.FallbackPath != ""),
+		server.Validate(proxyPrefixes(conf)...),
 	)
-
-	unzipHandler := http.FileServer(http.FS(unzipfs))
-	staticZipHandler := server.Caching()(http.FileServer(http.FS(zipfs)))
-	dynamicZipHandler := server.Caching()(middleware.Compress(gzip.DefaultCompression, conf.Gzip.MediaTypes...)(unzipHandler))
-	var cspPathRegex *regexp.Regexp
-	var cspHandler http.Handler
-	if conf.AngularCspReplace.Enabled {
-		cspPathRegex = regexp.MustCompile(conf.AngularCspReplace.FilePathRegex)
-		cspHandler = middleware.Compress(gzip.DefaultCompression, conf.Gzip.MediaTypes...)(
-			server.CspFileReplace(conf.AngularCspReplace.VariableName, conf.MediaTypeMap)(unzipHandler))
+	// the path based access checks are applied again to internal rewrites, as they change the request path
+	accessChecks := chi.Chain(
+		server.Optional(server.IPFilter(ipFilter, promRegistration), len(conf.IPFilter.Rules) > 0),
+		server.Optional(server.ClientCert(clientCertRules(conf)...), isClientAuth(conf)),
+		server.Optional(basicAuthHandler, conf.BasicAuth.Enabled),
+		server.Optional(oidcHandler, conf.OIDC.Enabled),
+		server.Optional(jwtHandler, conf.JWT.Enabled),
+		server.Optional(signedURLHandler, conf.SignedURLs.Enabled),
+	)
+	r.Use(accessChecks...)
+	r.Use(server.RewriteCheck(accessChecks.Handler))
+	if len(vhosts) > 0 {
+		r.Handle("/*", server.VirtualHostHandler(defaultHandler, vhosts...))
+	} else {
+		r.Handle("/*", defaultHandler)
+	}
+	proxies, err := proxyRoutes(sigtermCtx, conf)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error setting up the proxy routes")
+	}
+	for prefix, handler := range proxies {
+		log.Info().Msgf("Proxying %s", prefix)
+		// the request paths are cleaned by the Validate handler, so the prefix without trailing slash has to be handled as well
+		r.Handle(strings.TrimSuffix(prefix, "/"), handler)
+		r.Handle(strings.TrimSuffix(prefix, "/")+"/*", handler)
 	}
-	r.Handle("/*", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if cspPathRegex != nil && cspPathRegex.MatchString(r.URL.Path) {
-			cspHandler.ServeHTTP(w, r)
-			return
-		}
-		if conf.MemoryFs && conf.Gzip.Enabled {
-			if r.URL.Path == conf.FallbackPath {
-				w.Header().Set("Content-Encoding", "gzip")
-				staticZipHandler.ServeHTTP(w, r)
-				return
-			}
-			mediaType, ok := conf.MediaTypeMap[path.Ext(r.URL.Path)]
-			if i := strings.Index(mediaType, ";"); i >= 0 {
-				mediaType = mediaType[0:i]
-			}
-			if r.URL.Path == conf.FallbackPath || (ok && utils.Contains(conf.Gzip.MediaTypes, mediaType)) {
-				w.Header().Set("Content-Encoding", "gzip")
-				staticZipHandler.ServeHTTP(w, r)
-				return
-			}
-		}
-		// gzip not active also will cause the gzipMediaTypes list to be empty so safe to call the generalized handler here
-		dynamicZipHandler.ServeHTTP(w, r)
-	}))
 
 	webserver := server.Build(conf.Port.Webserver, time.Duration(conf.Timeout.Read)*time.Second,
 		time.Duration(conf.Timeout.Write)*time.Second, time.Duration(conf.Timeout.Idle)*time.Second, conf.H2C, r)
+	var acmeHandler http.Handler
+	if conf.TLS.Enabled {
+		webserver.TLSConfig, acmeHandler, err = initTLS(conf, certs)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error setting up TLS")
+		}
+		if conf.TLS.ACME.Enabled {
+			log.Info().Msgf("Terminating TLS with ACME certificates for %v", conf.TLS.ACME.Domains)
+		} else {
+			log.Info().Msgf("Terminating TLS with certificate %s and %d SNI certificates", conf.TLS.Cert, len(conf.TLS.SNI))
+		}
+	}
+	proxyProto, err := proxyProtocol(conf)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error setting up the PROXY protocol")
+	}
+	if proxyProto != nil {
+		log.Info().Msgf("Parsing PROXY protocol headers in %s mode from %v", conf.ProxyProtocol.Mode, conf.ProxyProtocol.Allowed)
+		webserver.UseProxyProtocol(proxyProto)
+	}
 	log.Info().Msgf("Starting webserver server on port %d", conf.Port.Webserver)
 	srvCtx := context.WithValue(sigtermCtx, server.ServerName, "file server")
 	server.AddGracefulShutdown(srvCtx, &wg, webserver, time.Duration(conf.Timeout.Shutdown)*time.Second)
 	webserver.ListenGoServe(sigtermCtx, errChan)
 
+	if isHTTP3(conf) {
+		http3Server := server.BuildHTTP3(conf.Port.Webserver, webserver.TLSConfig, conf.HTTP3.IdleTimeout, conf.HTTP3.HandshakeTimeout, r)
+		http3Ctx := context.WithValue(sigtermCtx, server.ServerName, "http3 file server")
+		server.AddGracefulShutdown(http3Ctx, &wg, http3Server, time.Duration(conf.Timeout.Shutdown)*time.Second)
+		http3Server.ListenGoServe(sigtermCtx, errChan)
+		log.Info().Msgf("Starting HTTP/3 server on udp port %d", conf.Port.Webserver)
+	}
+
+	if conf.TLS.Enabled && conf.HTTPSRedirect.Enabled {
+		redirectServer := server.Build(conf.Port.HTTP, time.Duration(conf.Timeout.Read)*time.Second,
+			time.Duration(conf.Timeout.Write)*time.Second, time.Duration(conf.Timeout.Idle)*time.Second,
+			false, server.HTTPSRedirectHandler(conf.HTTPSRedirect.Port, acmeHandler), server.Optional(server.AccessLog(), conf.Log.AccessLog.General))
+		if proxyProto != nil {
+			redirectServer.UseProxyProtocol(proxyProto)
+		}
+		redirectCtx := context.WithValue(sigtermCtx, server.ServerName, "https redirect server")
+		server.AddGracefulShutdown(redirectCtx, &wg, redirectServer, time.Duration(conf.Timeout.Shutdown)*time.Second)
+		redirectServer.ListenGoServe(sigtermCtx, errChan)
+		log.Info().Msgf("Redirecting plaintext HTTP requests from port %d to HTTPS", conf.Port.HTTP)
+	}
+
 	if conf.Metrics.Enabled {
 		metricsServer := server.Build(conf.Port.Metrics, time.Duration(conf.Timeout.Read)*time.Second,
 			time.Duration(conf.Timeout.Write)*time.Second, time.Duration(conf.Timeout.Idle)*time.Second,
@@ -135,6 +293,34 @@ func main() {
 
 	go logErrors(errChan)
 
+	var netRules []landlock.Rule
+	if port, ok, err := acmePort(conf); err != nil {
+		log.Fatal().Err(err).Msg("")
+	} else if ok {
+		// the ACME client has to reach the ACME directory
+		netRules = append(netRules, landlock.ConnectTCP(port))
+	}
+	if port, ok, err := oidcPort(conf); err != nil {
+		log.Fatal().Err(err).Msg("")
+	} else if ok {
+		// the relying party has to reach the identity provider for the token exchange and its signing keys
+		netRules = append(netRules, landlock.ConnectTCP(port))
+	}
+	if port, ok, err := jwksPort(conf); err != nil {
+		log.Fatal().Err(err).Msg("")
+	} else if ok {
+		// the verifier has to reach the JWKS URL to refresh the keys
+		netRules = append(netRules, landlock.ConnectTCP(port))
+	}
+	if ports, err := upstreamPorts(conf); err != nil {
+		log.Fatal().Err(err).Msg("")
+	} else {
+		// the reverse proxy has to reach the upstreams
+		for _, port := range ports {
+			netRules = append(netRules, landlock.ConnectTCP(port))
+		}
+	}
+
 	// stop health server after everything else has stopped
 	if conf.Health {
 		healthServer := server.Build(conf.Port.Health, time.Duration(conf.Timeout.Read)*time.Second,
@@ -145,35 +331,112 @@ func main() {
 		log.Info().Msgf("Starting healthcheck server on port %d", conf.Port.Health)
 		healthCtx := context.WithValue(context.Background(), server.ServerName, "health server")
 		healthServer.ListenGoServe(sigtermCtx, errChan)
-		if err := landlockNetwork(ll); err != nil {
+		if err := landlockNetwork(ll, netRules...); err != nil {
 			log.Fatal().Err(err).Msg("")
 		}
 		// 1 second is sufficient for health checks to shut down
 		errChan <- server.ShutdownAfterWaitGroup(healthCtx, &wg, healthServer.Server, time.Duration(1)*time.Second)
 	} else {
-		if err := landlockNetwork(ll); err != nil {
+		if err := landlockNetwork(ll, netRules...); err != nil {
 			log.Fatal().Err(err).Msg("")
 		}
 		wg.Wait()
 	}
 }
 
-// initFs loads the non-zipped and zipped fs according to the config
-// zipFs is nil if memoryFs or gzipActive are not set
-func initFs(targetDir string, conf *config) (unzipfs fs.ReadFileFS, zipfs fs.ReadFileFS) {
-	if conf.MemoryFs {
+// siteHandler builds the handler chain that serves the targetDir with the site settings of the conf
+func siteHandler(ctx context.Context, conf *config, targetDir string, headerRules []server.HeaderRule, cacheControlRules []server.CacheControlRule) (http.Handler, error) {
+	unzipfs, watchedFs := initFs(ctx, targetDir, conf)
+
+	rules, err := redirectRules(conf, unzipfs)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the redirect rules: %w", err)
+	}
+	redirects := server.NewRedirectRules(rules...)
+	if watchedFs != nil {
+		watchedFs.OnReload(func() {
+			rules, err := redirectRules(conf, unzipfs)
+			if err != nil {
+				log.Error().Err(err).Msg("Error reloading the redirect rules, keeping the previous version")
+				return
+			}
+			redirects.Store(rules...)
+		})
+	}
+
+	unzipHandler := server.FileServer(unzipfs)
+	// gzip not active also will cause the gzipMediaTypes list to be empty so safe to call the generalized handler here
+	// already precompressed sidecars are not compressed again
+	// the caching handler is placed before dynamic compression to weaken the ETag for dynamically compressed responses
+	dynamicZipHandler := server.Caching(unzipfs)(middleware.Compress(gzip.DefaultCompression, conf.Gzip.MediaTypes...)(unzipHandler))
+	fileHandler := server.Precompressed(unzipfs, conf.MediaTypeMap, sidecarEncodings(conf)...)(dynamicZipHandler)
+	var cspPathRegex *regexp.Regexp
+	var cspHandler http.Handler
+	if conf.AngularCspReplace.Enabled {
+		cspPathRegex, err = regexp.Compile(conf.AngularCspReplace.FilePathRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid angular csp file path regex: %w", err)
+		}
+		cspFileHandler := server.NewCspFileHandler(unzipHandler, conf.AngularCspReplace.VariableName, conf.MediaTypeMap)
+		cspHandler = middleware.Compress(gzip.DefaultCompression, conf.Gzip.MediaTypes...)(cspFileHandler)
+		if watchedFs != nil {
+			watchedFs.InvalidateOnReload(cspFileHandler.Reset)
+		}
+	}
+
+	filesHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cspPathRegex != nil && cspPathRegex.MatchString(r.URL.Path) {
+			cspHandler.ServeHTTP(w, r)
+			return
+		}
+		fileHandler.ServeHTTP(w, r)
+	})
+	cacheControl := server.Optional(server.CacheControl(cacheControlRules...), len(cacheControlRules) > 0)
+	// the mount fallbacks and the cache-control rules see the request path within the mount directory
+	router, err := server.MountRouter(chi.Chain(
+		server.Optional(server.Fallback(conf.FallbackPath, http.StatusNotFound), conf.FallbackPath != ""),
+		cacheControl,
+	).Handler(filesHandler), cacheControl(filesHandler), mounts(conf)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return chi.Chain(
+		server.Header(conf.Headers),
+		server.Optional(server.HeaderRules(headerRules...), len(headerRules) > 0),
+		server.Optional(server.SessionId(conf.AngularCspReplace.SessionCookie.Name, time.Duration(conf.AngularCspReplace.SessionCookie.MaxAge)*time.Second),
+			conf.AngularCspReplace.Enabled),
+		server.Optional(server.CspHeaderReplace(conf.AngularCspReplace.VariableName), conf.AngularCspReplace.Enabled),
+		server.Redirect(unzipfs, redirects),
+	).Handler(router), nil
+}
+
+// initFs loads the fs according to the config. The in-memory fs holds precompressed sidecar files for all compressible files.
+// watchedFs is nil if memoryFs or memoryFsWatch are not set, it reloads the returned filesystem till the ctx is cancelled.
+// The ETags are provided by the fs itself, for the in-memory fs they are precomputed. The caching handler pins the current version
+// of the watched fs to each request, so that the ETag and the content of a response belong to the same version during reloads.
+func initFs(ctx context.Context, targetDir string, conf *config) (unzipfs server.ETagFS, watchedFs *filesystem.WatchedMemoryFS) {
+	addSidecars := func(memoryFs *filesystem.MemoryFS) (*filesystem.MemoryFS, error) {
+		log.Debug().Msg("Precompressing in memory filesystem")
+		return memoryFs.WithSidecars(isCompressible(conf), sidecarEncodings(conf)...)
+	}
+	if conf.MemoryFs && conf.MemoryFsWatch.Enabled {
+		log.Info().Msg("Using the in-memory-filesystem with hot reload")
+		var err error
+		watchedFs, err = filesystem.NewWatchedMemoryFs(ctx, targetDir, conf.MemoryFsWatch.Debounce, addSidecars)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error preparing watched read-only filesystem.")
+		}
+		unzipfs = watchedFs
+	} else if conf.MemoryFs {
 		log.Info().Msg("Using the in-memory-filesystem")
 		memoryFs, err := filesystem.NewMemoryFs(targetDir)
 		if err != nil {
 			log.Fatal().Err(err).Msg("Error preparing read-only filesystem.")
 		}
-		unzipfs = memoryFs
-		if conf.Gzip.Enabled {
-			log.Debug().Msg("Zipping in memory filesystem")
-			zipfs, err = memoryFs.Zip()
-			if err != nil {
-				log.Fatal().Err(err).Msg("Error preparing zipped read-only filesystem.")
-			}
+		unzipfs, err = addSidecars(memoryFs)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error preparing precompressed read-only filesystem.")
 		}
 	} else {
 		log.Info().Msg("Using the os filesystem")
@@ -182,6 +445,25 @@ func initFs(targetDir string, conf *config) (unzipfs fs.ReadFileFS, zipfs fs.Rea
 	return
 }
 
+// sidecarEncodings returns the content encodings for which precompressed sidecar files are served, empty if gzip is not active
+func sidecarEncodings(conf *config) []string {
+	if !conf.Gzip.Enabled {
+		return nil
+	}
+	return conf.Gzip.Encodings
+}
+
+// isCompressible returns a filter for file names whose media type is configured for gzip compression
+func isCompressible(conf *config) func(name string) bool {
+	return func(name string) bool {
+		mediaType, ok := conf.MediaTypeMap[path.Ext(name)]
+		if i := strings.Index(mediaType, ";"); i >= 0 {
+			mediaType = mediaType[0:i]
+		}
+		return ok && utils.Contains(conf.Gzip.MediaTypes, mediaType)
+	}
+}
+
 // logErrors listens to the provided errChan and logs the received errors
 func logErrors(errChan <-chan error) {
 	for err := range errChan {
@@ -194,17 +476,19 @@ func logErrors(errChan <-chan error) {
 	}
 }
 
-// landlockReadonlyDirs restricts file system access to only readonly permissions for the specified directories
-func landlockFsReadonlyDirs(ll landlock.Config, target ...string) error {
-	if err := ll.RestrictPaths(landlock.RODirs(target...)); err != nil {
+// landlockFsDirs restricts file system access to readonly permissions for the readonlyDirs and read-write permissions for the writableDirs
+// as well as the permissions of the additional rules
+func landlockFsDirs(ll landlock.Config, readonlyDirs []string, writableDirs []string, rules ...landlock.Rule) error {
+	rules = append(rules, landlock.RODirs(readonlyDirs...), landlock.RWDirs(writableDirs...))
+	if err := ll.RestrictPaths(rules...); err != nil {
 		return fmt.Errorf("error during landlock filesystem restriction: %w", err)
 	}
 	return nil
 }
 
-// landlockNetwork allows no additional tcp connections (connect and bind TCP)
-func landlockNetwork(ll landlock.Config) error {
-	if err := ll.RestrictNet(); err != nil {
+// landlockNetwork allows no additional tcp connections (connect and bind TCP) apart from the given rules
+func landlockNetwork(ll landlock.Config, rules ...landlock.Rule) error {
+	if err := ll.RestrictNet(rules...); err != nil {
 		return fmt.Errorf("error during landlock network restriction: %w", err)
 	}
 	return nil
@@ -1,10 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/go-viper/mapstructure/v2"
@@ -13,6 +27,7 @@ import (
 	"github.com/knadh/koanf/providers/file"
 	"github.com/knadh/koanf/providers/structs"
 	"github.com/knadh/koanf/v2"
+	"github.com/ngergs/websrv/v5/server"
 	"github.com/rs/zerolog"
 
 	stdlog "log"
@@ -22,13 +37,22 @@ import (
 
 var (
 	ErrInvalidLogLevel        = errors.New("invalid loglevel, only error, warn, info and debug are valid")
-	ErrInvalidNumberArguments = errors.New("invalid number of argument, has to be 1")
+	ErrInvalidNumberArguments = errors.New("invalid number of argument, has to be 1 (or at most 1 if vhosts are configured)")
+	ErrInvalidVHost           = errors.New("vhosts require a root and at least one host")
+	ErrInvalidProxyProtocol   = errors.New("invalid proxy protocol mode, only strict and lenient are valid")
 
 	version = "snapshot"
 )
 
-// readConfig reads the configuration. Order is (least one takes precedence) defaults > config file > env vars.
+// readConfig parses the command line flags and reads the configuration, see loadConfig
 func readConfig() (*config, error) {
+	confFile := flag.String("conf", "", "config file to load")
+	flag.Parse()
+	return loadConfig(*confFile)
+}
+
+// loadConfig reads the configuration. Order is (least one takes precedence) defaults > config file > env vars.
+func loadConfig(confFile string) (*config, error) {
 	k := koanf.New(".")
 	var conf config
 
@@ -38,45 +62,111 @@ func readConfig() (*config, error) {
 	}
 
 	// Load config from file
-	confFile := flag.String("conf", "", "config file to load")
-	flag.Parse()
-	if *confFile != "" {
-		if err := k.Load(file.Provider(*confFile), yaml.Parser()); err != nil {
+	if confFile != "" {
+		if err := k.Load(file.Provider(confFile), yaml.Parser()); err != nil {
 			return nil, fmt.Errorf("error loading config file: %w", err)
 		}
 	}
 
 	// Load config from env
 	envPrefix := "WEBSRV_"
-	err := k.Load(env.Provider(envPrefix, ".", func(s string) string {
-		return strings.ReplaceAll(strings.ToLower(
-			strings.TrimPrefix(s, envPrefix)), "_", ".")
+	err := k.Load(env.ProviderWithValue(envPrefix, ".", func(key string, value string) (string, interface{}) {
+		key = strings.ReplaceAll(strings.ToLower(
+			strings.TrimPrefix(key, envPrefix)), "_", ".")
+		return key, parseEnvValue(key, value)
 	}), nil)
 	if err != nil {
 		return nil, fmt.Errorf("error loading config from env vars:%w", err)
 	}
 
+	if err := unmarshalConfig(k, &conf); err != nil {
+		return nil, fmt.Errorf("error unmarshalling collected config: %w", err)
+	}
+	if conf.VHosts, err = readVHosts(k); err != nil {
+		return nil, err
+	}
+	return &conf, nil
+}
+
+// unmarshalConfig decodes the koanf config into the result
+func unmarshalConfig(k *koanf.Koanf, result interface{}) error {
 	// fail on config settings that do not match any internal setting, see https://github.com/knadh/koanf/issues/189
-	err = k.UnmarshalWithConf("", &conf, koanf.UnmarshalConf{DecoderConfig: &mapstructure.DecoderConfig{
+	return k.UnmarshalWithConf("", result, koanf.UnmarshalConf{DecoderConfig: &mapstructure.DecoderConfig{
 		DecodeHook: mapstructure.ComposeDecodeHookFunc(
 			mapstructure.StringToTimeDurationHookFunc(),
 			mapstructure.StringToSliceHookFunc(","),
 			mapstructure.TextUnmarshallerHookFunc()),
 		Metadata:         nil,
-		Result:           &conf,
+		Result:           result,
 		ErrorUnused:      true,
 		WeaklyTypedInput: true,
 	}})
-	if err != nil {
-		return nil, fmt.Errorf("error unmarshalling collected config: %w", err)
+}
+
+// readVHosts reads the virtual hosts, their site settings default to the top-level values
+func readVHosts(k *koanf.Koanf) ([]vhostConfig, error) {
+	vhostKs := k.Slices("vhosts")
+	vhosts := make([]vhostConfig, len(vhostKs))
+	for i, vhostK := range vhostKs {
+		merged := koanf.New(".")
+		for _, key := range vhostSiteKeys {
+			if value := k.Get(key); value != nil {
+				if err := merged.Set(key, value); err != nil {
+					return nil, fmt.Errorf("error merging vhost %d defaults: %w", i, err)
+				}
+			}
+		}
+		if err := merged.Merge(vhostK); err != nil {
+			return nil, fmt.Errorf("error merging vhost %d: %w", i, err)
+		}
+		if err := unmarshalConfig(merged, &vhosts[i]); err != nil {
+			return nil, fmt.Errorf("error unmarshalling vhost %d: %w", i, err)
+		}
+		if vhosts[i].Root == "" || len(vhosts[i].Hosts) == 0 {
+			return nil, fmt.Errorf("%w: vhost %d", ErrInvalidVHost, i)
+		}
 	}
-	return &conf, nil
+	return vhosts, nil
+}
+
+// jsonEnvKeys are the config keys of lists of objects and of maps, their values can only be set via JSON in env vars
+var jsonEnvKeys = collectJSONEnvKeys(reflect.TypeFor[config](), "")
+
+// collectJSONEnvKeys returns the koanf keys of the fields of the struct type that hold lists of structs or maps
+func collectJSONEnvKeys(structType reflect.Type, prefix string) map[string]bool {
+	result := make(map[string]bool)
+	for i := range structType.NumField() {
+		field := structType.Field(i)
+		key := prefix + field.Tag.Get("koanf")
+		switch {
+		case field.Type.Kind() == reflect.Map, field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct:
+			result[key] = true
+		case field.Type.Kind() == reflect.Struct:
+			maps.Copy(result, collectJSONEnvKeys(field.Type, key+"."))
+		}
+	}
+	return result
+}
+
+// parseEnvValue decodes JSON lists and objects for the jsonEnvKeys, e.g. for rule lists like WEBSRV_HEADERRULES='[{"prefix":"/fonts/"}]'.
+// All other values are returned as plain string.
+func parseEnvValue(key string, value string) interface{} {
+	trimmed := strings.TrimSpace(value)
+	if !jsonEnvKeys[key] || (!strings.HasPrefix(trimmed, "[") && !strings.HasPrefix(trimmed, "{")) {
+		return value
+	}
+	var result interface{}
+	if err := json.Unmarshal([]byte(trimmed), &result); err != nil {
+		return value
+	}
+	return result
 }
 
 // setup uses the configuration to set log levels, it also reads input args and returns the targetDir
 func setup(conf *config) (string, error) {
 	flag.Usage = func() {
-		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s {options} [target-path]\nOptions:\n", os.Args[0])
+		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s {options} [target-path]\n       %s sign {options} url...\n"+
+			"The target-path is optional if vhosts are configured. See %s sign -h for the signing of URLs.\nOptions:\n", os.Args[0], os.Args[0], os.Args[0])
 		flag.PrintDefaults()
 	}
 
@@ -100,6 +190,10 @@ func setup(conf *config) (string, error) {
 	log.Info().Msgf("This is websrv version %s", version)
 
 	args := flag.Args()
+	if len(args) == 0 && len(conf.VHosts) > 0 {
+		log.Info().Msg("No target-path argument, requests for unknown hosts are answered with 404")
+		return "", nil
+	}
 	if len(args) != 1 {
 		flag.Usage()
 		return "", fmt.Errorf("%w: %d", ErrInvalidNumberArguments, len(args))
@@ -107,3 +201,462 @@ func setup(conf *config) (string, error) {
 
 	return args[0], nil
 }
+
+// cacheControlRules compiles the Cache-Control rules from the config
+func cacheControlRules(conf *config) ([]server.CacheControlRule, error) {
+	rules := make([]server.CacheControlRule, len(conf.CacheControl))
+	for i, ruleConf := range conf.CacheControl {
+		matcher, err := server.NewPathMatcher(server.PathMatch{Glob: ruleConf.Glob, Regex: ruleConf.Regex, Hashed: ruleConf.Hashed})
+		if err != nil {
+			return nil, fmt.Errorf("cache-control rule %d: %w", i, err)
+		}
+		rules[i] = server.CacheControlRule{Matcher: matcher, Value: ruleConf.Value}
+	}
+	return rules, nil
+}
+
+// headerRules compiles the HTTP response header rules from the config
+func headerRules(conf *config) ([]server.HeaderRule, error) {
+	rules := make([]server.HeaderRule, len(conf.HeaderRules))
+	for i, ruleConf := range conf.HeaderRules {
+		matcher, err := server.NewPathMatcher(server.PathMatch{Prefix: ruleConf.Prefix, Glob: ruleConf.Glob, Regex: ruleConf.Regex})
+		if err != nil {
+			return nil, fmt.Errorf("header rule %d: %w", i, err)
+		}
+		rules[i] = server.HeaderRule{
+			Matcher:    matcher,
+			MediaTypes: ruleConf.MediaTypes,
+			Set:        ruleConf.Set,
+			Append:     ruleConf.Append,
+			Delete:     ruleConf.Delete,
+		}
+	}
+	return rules, nil
+}
+
+// mounts converts the mount points from the config
+func mounts(conf *config) []server.Mount {
+	result := make([]server.Mount, len(conf.Mounts))
+	for i, mountConf := range conf.Mounts {
+		fallbackCodes := mountConf.FallbackCodes
+		if len(fallbackCodes) == 0 {
+			fallbackCodes = []int{http.StatusNotFound}
+		}
+		result[i] = server.Mount{Prefix: mountConf.Prefix, Dir: mountConf.Dir, FallbackPath: mountConf.FallbackPath, FallbackCodes: fallbackCodes}
+	}
+	return result
+}
+
+// proxyProtocol sets up the PROXY protocol parsing from the config, nil if disabled
+func proxyProtocol(conf *config) (*server.ProxyProtocol, error) {
+	if !conf.ProxyProtocol.Enabled {
+		return nil, nil
+	}
+	var strict bool
+	switch conf.ProxyProtocol.Mode {
+	case "strict":
+		strict = true
+	case "lenient":
+		strict = false
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidProxyProtocol, conf.ProxyProtocol.Mode)
+	}
+	return server.NewProxyProtocol(strict, conf.ProxyProtocol.ReadHeaderTimeout, conf.ProxyProtocol.Allowed...)
+}
+
+// ipFilterRules sets up the client IP filter from the config, the list files are watched till the context is cancelled
+func ipFilterRules(ctx context.Context, conf *config) (*server.IPFilterRules, error) {
+	rules := make([]server.IPFilterRule, len(conf.IPFilter.Rules))
+	for i, ruleConf := range conf.IPFilter.Rules {
+		rules[i] = server.IPFilterRule{
+			Prefix:    ruleConf.Prefix,
+			Allow:     ruleConf.Allow,
+			Deny:      ruleConf.Deny,
+			AllowFile: ruleConf.AllowFile,
+			DenyFile:  ruleConf.DenyFile,
+		}
+	}
+	return server.NewIPFilterRules(ctx, conf.IPFilter.ReloadDebounce, rules...)
+}
+
+// ipFilterDirs returns the directories of the ip filter list files
+func ipFilterDirs(conf *config) []string {
+	var result []string
+	for _, ruleConf := range conf.IPFilter.Rules {
+		for _, file := range []string{ruleConf.AllowFile, ruleConf.DenyFile} {
+			if file != "" {
+				result = append(result, filepath.Dir(file))
+			}
+		}
+	}
+	return result
+}
+
+// basicAuth sets up the HTTP Basic authentication from the config, the htpasswd file is watched till the context is cancelled
+func basicAuth(ctx context.Context, conf *config) (*server.BasicAuthenticator, error) {
+	rules := make([]server.BasicAuthRule, len(conf.BasicAuth.Rules))
+	for i, ruleConf := range conf.BasicAuth.Rules {
+		rules[i] = server.BasicAuthRule{Prefix: ruleConf.Prefix, Realm: ruleConf.Realm}
+	}
+	return server.NewBasicAuthenticator(ctx, conf.BasicAuth.Htpasswd, conf.BasicAuth.ReloadDebounce, conf.BasicAuth.MaxFailures, conf.BasicAuth.FailureWindow, rules...)
+}
+
+// rateLimiter sets up the rate limits from the config
+func rateLimiter(conf *config) (*server.RateLimiter, error) {
+	overrides := make([]server.RateLimitRule, len(conf.RateLimit.Rules))
+	for i, ruleConf := range conf.RateLimit.Rules {
+		overrides[i] = server.RateLimitRule{Prefix: ruleConf.Prefix, MaxRequests: ruleConf.MaxRequests, TimeWindow: ruleConf.TimeWindow}
+	}
+	return server.NewRateLimiter(conf.RateLimit.ByIP, server.RateLimitRule{MaxRequests: conf.RateLimit.MaxRequests, TimeWindow: conf.RateLimit.TimeWindow}, overrides...)
+}
+
+// proxyRoutes sets up the reverse proxy handlers from the config, their health checks run till the context is cancelled
+func proxyRoutes(ctx context.Context, conf *config) (map[string]http.Handler, error) {
+	result := make(map[string]http.Handler, len(conf.Proxy))
+	for i, routeConf := range conf.Proxy {
+		upstreams := make([]*url.URL, len(routeConf.Upstreams))
+		for j, rawURL := range routeConf.Upstreams {
+			var err error
+			if upstreams[j], err = url.Parse(rawURL); err != nil {
+				return nil, fmt.Errorf("proxy route %d: invalid upstream url: %w", i, err)
+			}
+		}
+		handler, err := server.NewProxyHandler(ctx, server.ProxyRoute{
+			Prefix:          routeConf.Prefix,
+			Upstreams:       upstreams,
+			StripPrefix:     routeConf.StripPrefix,
+			PreserveHost:    routeConf.PreserveHost,
+			RequestHeaders:  server.HeaderRewrite{Set: routeConf.RequestHeaders.Set, Delete: routeConf.RequestHeaders.Delete},
+			ResponseHeaders: server.HeaderRewrite{Set: routeConf.ResponseHeaders.Set, Delete: routeConf.ResponseHeaders.Delete},
+			ConnectTimeout:  routeConf.ConnectTimeout,
+			Timeout:         routeConf.Timeout,
+			Retries:         routeConf.Retries,
+			HealthCheck:     server.HealthCheck{Path: routeConf.HealthCheck.Path, Interval: routeConf.HealthCheck.Interval, Timeout: routeConf.HealthCheck.Timeout},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("proxy route %d: %w", i, err)
+		}
+		result[routeConf.Prefix] = handler
+	}
+	return result, nil
+}
+
+// proxyPrefixes returns the path prefixes of the proxy routes
+func proxyPrefixes(conf *config) []string {
+	result := make([]string, len(conf.Proxy))
+	for i, routeConf := range conf.Proxy {
+		result[i] = routeConf.Prefix
+	}
+	return result
+}
+
+// redirectRules compiles the redirect rules from the config followed by those from the redirects file in the fsys (if present)
+func redirectRules(conf *config, fsys fs.FS) ([]*server.RedirectRule, error) {
+	rules := make([]*server.RedirectRule, len(conf.Redirects))
+	for i, ruleConf := range conf.Redirects {
+		var err error
+		rules[i], err = server.NewRedirectRule(server.RedirectMatch{
+			Host:   ruleConf.Host,
+			Path:   ruleConf.Path,
+			Prefix: ruleConf.Prefix,
+			Regex:  ruleConf.Regex,
+			To:     ruleConf.To,
+			Status: ruleConf.Status,
+			Force:  ruleConf.Force,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("redirect rule %d: %w", i, err)
+		}
+	}
+	if conf.RedirectsFile == "" {
+		return rules, nil
+	}
+	data, err := fs.ReadFile(fsys, conf.RedirectsFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return rules, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading redirects file: %w", err)
+	}
+	fileRules, err := server.ParseRedirectsFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Msgf("Loaded %d rules from the redirects file %s", len(fileRules), conf.RedirectsFile)
+	return append(rules, fileRules...), nil
+}
+
+// sniCertificates loads the default certificate and the SNI certificates from the config and reloads each of them on changes till the context is cancelled.
+// The first SNI certificate is used as default if no default certificate is configured.
+func sniCertificates(ctx context.Context, conf *config) (*server.SNICertificates, error) {
+	certConfs := conf.TLS.SNI
+	if conf.TLS.Cert != "" || conf.TLS.Key != "" || len(certConfs) == 0 {
+		certConfs = append([]sniCertConfig{{Cert: conf.TLS.Cert, Key: conf.TLS.Key}}, certConfs...)
+	}
+	var certs *server.SNICertificates
+	for i, certConf := range certConfs {
+		reloader, err := server.NewCertReloader(ctx, certConf.Cert, certConf.Key, conf.TLS.ReloadDebounce)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			if certs, err = server.NewSNICertificates(reloader); err != nil {
+				return nil, err
+			}
+		}
+		if err := certs.Add(reloader, certConf.Names...); err != nil {
+			return nil, fmt.Errorf("SNI certificate %s: %w", certConf.Cert, err)
+		}
+	}
+	return certs, nil
+}
+
+// initTLS returns the TLS configuration that uses the certificates.
+// If ACME is enabled the certificates are obtained via ACME instead, acmeHandler answers the HTTP-01 challenges. It is nil otherwise.
+func initTLS(conf *config, certs *server.SNICertificates) (tlsConf *tls.Config, acmeHandler http.Handler, err error) {
+	minVersion, err := server.ParseTLSVersion(conf.TLS.MinVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	cipherSuites, err := server.ParseCipherSuites(conf.TLS.CipherSuites)
+	if err != nil {
+		return nil, nil, err
+	}
+	if conf.TLS.ACME.Enabled {
+		acmeConf := conf.TLS.ACME
+		manager := server.NewACMEManager(acmeConf.Domains, acmeConf.Email, acmeConf.CacheDir, acmeConf.Directory, acmeConf.RenewBefore)
+		tlsConf, acmeHandler = server.ACMETLSConfig(manager, minVersion, cipherSuites), server.ACMEHTTPHandler(manager)
+	} else {
+		tlsConf = server.TLSConfig(minVersion, cipherSuites, certs.GetCertificate)
+	}
+
+	tlsConf.ClientAuth, err = server.ParseClientAuth(conf.TLS.ClientAuth.Mode)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tlsConf.ClientAuth != tls.NoClientCert {
+		tlsConf.ClientCAs, err = server.LoadCertPool(conf.TLS.ClientAuth.CA)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return tlsConf, acmeHandler, nil
+}
+
+// clientCertRules converts the client certificate rules from the config
+func clientCertRules(conf *config) []server.ClientCertRule {
+	rules := make([]server.ClientCertRule, len(conf.TLS.ClientAuth.Rules))
+	for i, ruleConf := range conf.TLS.ClientAuth.Rules {
+		rules[i] = server.ClientCertRule{Prefix: ruleConf.Prefix, Subjects: ruleConf.Subjects, SANs: ruleConf.SANs}
+	}
+	return rules
+}
+
+// isClientAuth checks whether client certificates are verified
+func isClientAuth(conf *config) bool {
+	return conf.TLS.Enabled && conf.TLS.ClientAuth.Mode != "" && conf.TLS.ClientAuth.Mode != "none"
+}
+
+// isHTTP3 checks whether the HTTP/3 listener is active, QUIC requires TLS
+func isHTTP3(conf *config) bool {
+	return conf.TLS.Enabled && conf.HTTP3.Enabled
+}
+
+// caCertFiles and caCertDirs are the default locations of the system CA certificates that crypto/x509 reads on linux
+var (
+	caCertFiles = []string{
+		"/etc/ssl/certs/ca-certificates.crt",
+		"/etc/pki/tls/certs/ca-bundle.crt",
+		"/etc/ssl/ca-bundle.pem",
+		"/etc/pki/tls/cacert.pem",
+		"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+		"/etc/ssl/cert.pem",
+	}
+	caCertDirs = []string{"/etc/ssl/certs", "/etc/pki/tls/certs"}
+)
+
+// resolverFiles are read by the go resolver to look up the host names of outbound connections
+var resolverFiles = []string{"/etc/resolv.conf", "/etc/hosts", "/etc/nsswitch.conf"}
+
+// outboundPaths returns the locations of the system CA certificates (readonlyDirs and readonlyFiles) and the resolver files (readonlyFiles)
+// if outbound connections are configured. SSL_CERT_FILE and SSL_CERT_DIR override the CA certificate locations like for crypto/x509.
+// Most of the locations only exist on some distributions.
+func outboundPaths(conf *config) (readonlyDirs []string, readonlyFiles []string) {
+	if !hasOutboundConnections(conf) {
+		return nil, nil
+	}
+	readonlyDirs, readonlyFiles = caCertDirs, caCertFiles
+	if file := os.Getenv("SSL_CERT_FILE"); file != "" {
+		readonlyFiles = []string{file}
+	}
+	if dir := os.Getenv("SSL_CERT_DIR"); dir != "" {
+		readonlyDirs = filepath.SplitList(dir)
+	}
+	return readonlyDirs, append(slices.Clone(readonlyFiles), resolverFiles...)
+}
+
+// hasOutboundConnections checks whether the config requires outbound connections: the ACME client, the proxy upstreams,
+// the JWKS URL or the OIDC identity provider
+func hasOutboundConnections(conf *config) bool {
+	return (conf.TLS.Enabled && conf.TLS.ACME.Enabled) || len(conf.Proxy) > 0 || (conf.JWT.Enabled && conf.JWT.JWKSURL != "") || conf.OIDC.Enabled
+}
+
+// tlsDirs returns the directories that hold the TLS certificates and CA files (readonly) and the ACME cache directory (writable)
+func tlsDirs(conf *config) (readonlyDirs []string, writableDirs []string) {
+	if !conf.TLS.Enabled {
+		return nil, nil
+	}
+	if isClientAuth(conf) {
+		readonlyDirs = append(readonlyDirs, filepath.Dir(conf.TLS.ClientAuth.CA))
+	}
+	if conf.TLS.ACME.Enabled {
+		return readonlyDirs, []string{conf.TLS.ACME.CacheDir}
+	}
+	if conf.TLS.Cert != "" || conf.TLS.Key != "" || len(conf.TLS.SNI) == 0 {
+		readonlyDirs = append(readonlyDirs, filepath.Dir(conf.TLS.Cert), filepath.Dir(conf.TLS.Key))
+	}
+	for _, certConf := range conf.TLS.SNI {
+		readonlyDirs = append(readonlyDirs, filepath.Dir(certConf.Cert), filepath.Dir(certConf.Key))
+	}
+	return readonlyDirs, nil
+}
+
+// oidc sets up the OpenID Connect relying party from the config, the endpoints of the identity provider are discovered
+func oidc(ctx context.Context, conf *config) (*server.OIDCRelyingParty, error) {
+	return server.NewOIDCRelyingParty(ctx, server.OIDCConfig{
+		IssuerURL:       conf.OIDC.Issuer,
+		ClientID:        conf.OIDC.ClientID,
+		ClientSecret:    conf.OIDC.ClientSecret,
+		RedirectURL:     conf.OIDC.RedirectURL,
+		Scopes:          conf.OIDC.Scopes,
+		Prefixes:        conf.OIDC.Prefixes,
+		AllowedDomains:  conf.OIDC.AllowedDomains,
+		AllowedGroups:   conf.OIDC.AllowedGroups,
+		GroupsClaim:     conf.OIDC.GroupsClaim,
+		CookieName:      conf.OIDC.CookieName,
+		CookieSecret:    []byte(conf.OIDC.CookieSecret),
+		SessionDuration: conf.OIDC.SessionDuration,
+	})
+}
+
+// signedURLKeys decodes the keys for signed URLs from the config
+func signedURLKeys(conf *config) ([]server.SignedURLKey, error) {
+	keys := make([]server.SignedURLKey, len(conf.SignedURLs.Keys))
+	for i, keyConf := range conf.SignedURLs.Keys {
+		keys[i] = server.SignedURLKey{ID: keyConf.ID, Secret: []byte(keyConf.Secret)}
+		if keyConf.PublicKey != "" {
+			publicKey, err := base64.StdEncoding.DecodeString(keyConf.PublicKey)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ed25519 public key of signed url key %s: %w", keyConf.ID, err)
+			}
+			keys[i].PublicKey = publicKey
+		}
+		if keyConf.PrivateKey != "" {
+			seed, err := base64.StdEncoding.DecodeString(keyConf.PrivateKey)
+			if err != nil || len(seed) != ed25519.SeedSize {
+				return nil, fmt.Errorf("%w: the ed25519 private key of signed url key %s has to be a base64 encoded 32 byte seed", server.ErrInvalidSignedURLKey, keyConf.ID)
+			}
+			keys[i].PrivateKey = ed25519.NewKeyFromSeed(seed)
+		}
+	}
+	return keys, nil
+}
+
+// jwtVerifier sets up the JWT verification from the config, the JWKS is watched or refreshed till the context is cancelled
+func jwtVerifier(ctx context.Context, conf *config) (*server.JWTVerifier, error) {
+	rules := make([]server.JWTRule, len(conf.JWT.Rules))
+	for i, ruleConf := range conf.JWT.Rules {
+		rules[i] = server.JWTRule{Prefix: ruleConf.Prefix, Claims: ruleConf.Claims}
+	}
+	return server.NewJWTVerifier(ctx, server.JWTConfig{
+		Issuer:          conf.JWT.Issuer,
+		Audience:        conf.JWT.Audience,
+		JWKSFile:        conf.JWT.JWKSFile,
+		JWKSURL:         conf.JWT.JWKSURL,
+		RefreshInterval: conf.JWT.RefreshInterval,
+		ReloadDebounce:  conf.JWT.ReloadDebounce,
+		CookieName:      conf.JWT.CookieName,
+		Leeway:          conf.JWT.Leeway,
+	}, rules...)
+}
+
+// jwksPort returns the TCP port of the JWKS URL if the JWT verification is enabled with a JWKS URL, the verifier has to be able to connect to it
+func jwksPort(conf *config) (port uint16, ok bool, err error) {
+	if !conf.JWT.Enabled || conf.JWT.JWKSURL == "" {
+		return 0, false, nil
+	}
+	jwksURL, err := url.Parse(conf.JWT.JWKSURL)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid jwks url: %w", err)
+	}
+	port, err = urlPort(jwksURL)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid jwks port: %w", err)
+	}
+	return port, true, nil
+}
+
+// oidcPort returns the TCP port of the issuer if the OIDC login is enabled, the relying party has to be able to connect to it.
+// The discovered endpoints are expected to be served on the same port.
+func oidcPort(conf *config) (port uint16, ok bool, err error) {
+	if !conf.OIDC.Enabled {
+		return 0, false, nil
+	}
+	issuer, err := url.Parse(conf.OIDC.Issuer)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid oidc issuer url: %w", err)
+	}
+	port, err = urlPort(issuer)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid oidc issuer port: %w", err)
+	}
+	return port, true, nil
+}
+
+// acmePort returns the TCP port of the ACME directory if ACME is enabled, the ACME client has to be able to connect to it
+func acmePort(conf *config) (port uint16, ok bool, err error) {
+	if !conf.TLS.Enabled || !conf.TLS.ACME.Enabled {
+		return 0, false, nil
+	}
+	directory, err := url.Parse(conf.TLS.ACME.Directory)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid ACME directory url: %w", err)
+	}
+	port, err = urlPort(directory)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid ACME directory port: %w", err)
+	}
+	return port, true, nil
+}
+
+// upstreamPorts returns the TCP ports of all proxy upstreams, the proxy has to be able to connect to them
+func upstreamPorts(conf *config) ([]uint16, error) {
+	var ports []uint16
+	for _, route := range conf.Proxy {
+		for _, rawURL := range route.Upstreams {
+			upstream, err := url.Parse(rawURL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid upstream url: %w", err)
+			}
+			port, err := urlPort(upstream)
+			if err != nil {
+				return nil, fmt.Errorf("invalid upstream port: %w", err)
+			}
+			ports = append(ports, port)
+		}
+	}
+	return ports, nil
+}
+
+// urlPort returns the explicit port of the URL or the default port of its scheme
+func urlPort(target *url.URL) (uint16, error) {
+	portName := target.Port()
+	if portName == "" {
+		portName = target.Scheme
+	}
+	portNumber, err := net.LookupPort("tcp", portName)
+	if err != nil {
+		return 0, err
+	}
+	return uint16(portNumber), nil //nolint:gosec // LookupPort returns valid port numbers
+}
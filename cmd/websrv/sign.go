@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/ngergs/websrv/v5/server"
+)
+
+var (
+	ErrMissingURLs         = errors.New("at least one url to sign is required")
+	ErrUnknownSignedURLKey = errors.New("unknown signed url key")
+)
+
+// sign is the sign subcommand, it prints a signed URL per argument with the keys of the configuration
+func sign(args []string) error {
+	flags := flag.NewFlagSet("sign", flag.ContinueOnError)
+	confFile := flags.String("conf", "", "config file to load")
+	keyID := flags.String("key", "", "id of the signedurls key to sign with, defaults to the first key")
+	expiresIn := flags.Duration("expires", time.Hour, "duration till the urls expire")
+	clientIP := flags.String("ip", "", "client IP or CIDR the urls are bound to, optional")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(flags.Output(), "Usage: %s sign {options} url...\nThe urls can be paths like /downloads/report.pdf or absolute urls.\nOptions:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return ErrMissingURLs
+	}
+
+	conf, err := loadConfig(*confFile)
+	if err != nil {
+		return err
+	}
+	keys, err := signedURLKeys(conf)
+	if err != nil {
+		return err
+	}
+	keyIndex := 0
+	if *keyID != "" {
+		keyIndex = slices.IndexFunc(keys, func(key server.SignedURLKey) bool { return key.ID == *keyID })
+	}
+	if keyIndex < 0 || keyIndex >= len(keys) {
+		return fmt.Errorf("%w: %s", ErrUnknownSignedURLKey, *keyID)
+	}
+
+	expires := time.Now().Add(*expiresIn)
+	for _, target := range flags.Args() {
+		signed, err := server.SignURL(target, keys[keyIndex], expires, *clientIP)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(os.Stdout, signed)
+	}
+	return nil
+}
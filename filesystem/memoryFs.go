@@ -1,12 +1,14 @@
 package filesystem
 
 import (
-	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"maps"
 	"math"
 	"os"
 	"path"
@@ -34,6 +36,7 @@ type MemoryFS struct {
 
 type memoryFile struct {
 	data    []byte
+	eTag    string
 	info    fs.FileInfo
 	dirInfo []fs.DirEntry
 }
@@ -88,7 +91,7 @@ func getReadFileFunc(filesystem *MemoryFS, targetDirLength int) func(path string
 			if err != nil {
 				return err
 			}
-			result = &memoryFile{data: data, info: info}
+			result = &memoryFile{data: data, eTag: computeETag(data), info: info}
 		}
 		log.Debug().Msgf("Read into memory-fs: %s", subPath)
 		filesystem.files[subPath] = result
@@ -114,6 +117,22 @@ func (f *MemoryFS) ReadFile(name string) ([]byte, error) {
 	return file.data, nil
 }
 
+// ETag returns the ETag of the given file which has been computed when the file has been read into memory.
+// Compressed versions of a file have their own ETag. Directories have no ETag and return fs.ErrNotExist.
+func (f *MemoryFS) ETag(name string) (string, error) {
+	file, ok := f.files[name]
+	if !ok || file.info.IsDir() {
+		return "", fs.ErrNotExist
+	}
+	return file.eTag, nil
+}
+
+// computeETag computes the ETag as base64 encoded SHA-256 hash of the file content
+func computeETag(data []byte) string {
+	hash := sha256.Sum256(data)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
 type modifiedSizeInfo struct {
 	fs.FileInfo
 	size int64
@@ -123,20 +142,77 @@ func (mod *modifiedSizeInfo) Size() int64 {
 	return mod.size
 }
 
-// Zip returns a deep copy of the filesystem where all files that match the given zip file extension are zipped.
-// Files that do not match are absent in the zipped version of the in memoryfilesystem.
+// Zip returns a deep copy of the filesystem where all files are gzipped, see Compress.
 func (f *MemoryFS) Zip() (*MemoryFS, error) {
-	zippedFiles := make(map[string]*memoryFile)
+	return f.Compress(utils.EncodingGzip)
+}
+
+// Compress returns a deep copy of the filesystem where all files are compressed with the given content encoding.
+// Supported encodings are gzip, br and zstd, the best compression level is used for each of them.
+func (f *MemoryFS) Compress(encoding string) (*MemoryFS, error) {
+	compressedFiles := make(map[string]*memoryFile)
 	for filepath, file := range f.files {
-		log.Debug().Msgf("Zipping %s", filepath)
-		zipped, err := utils.Zip(file.data, gzip.BestCompression)
+		log.Debug().Msgf("Compressing %s with %s", filepath, encoding)
+		compressed, err := utils.Compress(file.data, encoding)
 		if err != nil {
 			return nil, err
 		}
-		info := &modifiedSizeInfo{size: int64(len(zipped)), FileInfo: file.info}
-		zippedFiles[filepath] = &memoryFile{data: zipped, info: info}
+		info := &modifiedSizeInfo{size: int64(len(compressed)), FileInfo: file.info}
+		compressedFiles[filepath] = &memoryFile{data: compressed, eTag: computeETag(compressed), info: info}
 	}
-	return &MemoryFS{files: zippedFiles}, nil
+	return &MemoryFS{files: compressedFiles}, nil
+}
+
+// WithSidecars returns a shallow copy of the filesystem that additionally holds precompressed sidecar files for the given content encodings,
+// e.g. main.js.br for main.js. Sidecars are only added for files accepted by the filter (nil accepts all files)
+// and are not overwritten if they already exist, e.g. because the frontend build already produced them.
+func (f *MemoryFS) WithSidecars(filter func(name string) bool, encodings ...string) (*MemoryFS, error) {
+	files := maps.Clone(f.files)
+	for filepath, file := range f.files {
+		if file.info.IsDir() || isSidecar(filepath) || (filter != nil && !filter(filepath)) {
+			continue
+		}
+		for _, encoding := range encodings {
+			extension, ok := utils.SidecarExtensions[encoding]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", utils.ErrUnsupportedEncoding, encoding)
+			}
+			if _, ok := f.files[filepath+extension]; ok {
+				continue
+			}
+			log.Debug().Msgf("Compressing %s with %s", filepath, encoding)
+			compressed, err := utils.Compress(file.data, encoding)
+			if err != nil {
+				return nil, err
+			}
+			info := &sidecarInfo{
+				modifiedSizeInfo: modifiedSizeInfo{size: int64(len(compressed)), FileInfo: file.info},
+				name:             file.info.Name() + extension,
+			}
+			files[filepath+extension] = &memoryFile{data: compressed, eTag: computeETag(compressed), info: info}
+		}
+	}
+	return &MemoryFS{files: files}, nil
+}
+
+// isSidecar checks whether the file extension corresponds to a precompressed sidecar file
+func isSidecar(name string) bool {
+	extension := path.Ext(name)
+	for _, sidecarExtension := range utils.SidecarExtensions {
+		if extension == sidecarExtension {
+			return true
+		}
+	}
+	return false
+}
+
+type sidecarInfo struct {
+	modifiedSizeInfo
+	name string
+}
+
+func (sidecar *sidecarInfo) Name() string {
+	return sidecar.name
 }
 
 // Stat returns the file stats.
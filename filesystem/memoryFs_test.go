@@ -58,6 +58,80 @@ func TestMemoryFsZip(t *testing.T) {
 	require.Equal(t, originalDataZipped, memoryDataZipped)
 }
 
+// TestMemoryFsCompress tests the brotli and zstd compression of the memoryFs
+func TestMemoryFsCompress(t *testing.T) {
+	memoryFs, err := filesystem.NewMemoryFs(testDir)
+	require.NoError(t, err)
+	originalData, err := os.ReadFile(path.Join(testDir, testFile))
+	require.NoError(t, err)
+
+	brotliFs, err := memoryFs.Compress(utils.EncodingBrotli)
+	require.NoError(t, err)
+	brotliData, err := brotliFs.ReadFile(testFile)
+	require.NoError(t, err)
+	brotliData, err = utils.Unbrotli(brotliData)
+	require.NoError(t, err)
+	require.Equal(t, originalData, brotliData)
+
+	zstdFs, err := memoryFs.Compress(utils.EncodingZstd)
+	require.NoError(t, err)
+	zstdData, err := zstdFs.ReadFile(testFile)
+	require.NoError(t, err)
+	zstdData, err = utils.Unzstd(zstdData)
+	require.NoError(t, err)
+	require.Equal(t, originalData, zstdData)
+}
+
+// TestMemoryFsWithSidecars tests that precompressed sidecar files are added for the files accepted by the filter
+func TestMemoryFsWithSidecars(t *testing.T) {
+	memoryFs, err := filesystem.NewMemoryFs(testDir)
+	require.NoError(t, err)
+	sidecarFs, err := memoryFs.WithSidecars(func(name string) bool { return name == testFile }, utils.EncodingBrotli)
+	require.NoError(t, err)
+
+	originalData, err := os.ReadFile(path.Join(testDir, testFile))
+	require.NoError(t, err)
+	plainData, err := sidecarFs.ReadFile(testFile)
+	require.NoError(t, err)
+	require.Equal(t, originalData, plainData)
+	brotliData, err := sidecarFs.ReadFile(testFile + ".br")
+	require.NoError(t, err)
+	brotliData, err = utils.Unbrotli(brotliData)
+	require.NoError(t, err)
+	require.Equal(t, originalData, brotliData)
+	stat, err := fs.Stat(sidecarFs, testFile+".br")
+	require.NoError(t, err)
+	require.Equal(t, testFile+".br", stat.Name())
+
+	_, err = sidecarFs.ReadFile("index.html.br")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = memoryFs.ReadFile(testFile + ".br")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = memoryFs.WithSidecars(nil, "deflate")
+	require.ErrorIs(t, err, utils.ErrUnsupportedEncoding)
+}
+
+// TestMemoryFsETag tests that the precomputed ETags differ between the plain and compressed versions of a file
+func TestMemoryFsETag(t *testing.T) {
+	memoryFs, err := filesystem.NewMemoryFs(testDir)
+	require.NoError(t, err)
+	sidecarFs, err := memoryFs.WithSidecars(nil, utils.EncodingGzip)
+	require.NoError(t, err)
+
+	eTag, err := sidecarFs.ETag(testFile)
+	require.NoError(t, err)
+	require.NotEmpty(t, eTag)
+	zippedETag, err := sidecarFs.ETag(testFile + ".gz")
+	require.NoError(t, err)
+	require.NotEmpty(t, zippedETag)
+	require.NotEqual(t, eTag, zippedETag)
+
+	_, err = sidecarFs.ETag(".")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = sidecarFs.ETag("missing.js")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
 func getStatsContent(t *testing.T, fs fs.FS, path string) ([]byte, fs.FileInfo) {
 	file, err := fs.Open(path)
 	require.NoError(t, err)
@@ -1,24 +1,202 @@
 package filesystem
 
 import (
+	"context"
+	"errors"
 	"io"
 	"io/fs"
+	"sync"
+	"time"
+
+	"github.com/ngergs/websrv/v5/internal/utils"
 )
 
-// make sure that we implement the fs.ReadFileFS interface
-var _ fs.ReadFileFS = &ReadFileFS{}
+var (
+	// make sure that we implement the fs.ReadFileFS interface
+	_ fs.ReadFileFS = &ReadFileFS{}
+	_ io.Seeker     = &viewedFile{}
+)
 
 // ReadFileFS wraps a fs.FS and adds the ReadFile method
 type ReadFileFS struct {
 	fs.FS
+	// eTags caches the content hashes per file name as *cachedETag
+	eTags sync.Map
+}
+
+// cachedETag is a content hash together with the modification time and size of the file it has been computed for
+type cachedETag struct {
+	eTag    string
+	modTime time.Time
+	size    int64
 }
 
 // ReadFile is a more concise way to directly read a file into memory.
-func (fs *ReadFileFS) ReadFile(name string) ([]byte, error) {
-	file, err := fs.Open(name)
+func (f *ReadFileFS) ReadFile(name string) ([]byte, error) {
+	file, err := f.Open(name)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
+	defer utils.Close(context.Background(), file)
 	return io.ReadAll(file)
 }
+
+// ETag returns the base64 encoded SHA-256 hash of the file content. The hash is cached till the modification time or size of the file changes.
+// Directories have no ETag and return fs.ErrNotExist.
+func (f *ReadFileFS) ETag(name string) (string, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer utils.Close(context.Background(), file)
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fs.ErrNotExist
+	}
+	eTag, _, err := f.eTag(name, file, info)
+	return eTag, err
+}
+
+// eTag returns the cached ETag of the opened file if its modification time and size match the info. Otherwise, the content is read
+// from the file to compute the ETag and returned as data as well.
+func (f *ReadFileFS) eTag(name string, file fs.File, info fs.FileInfo) (eTag string, data []byte, err error) {
+	if cached, ok := f.eTags.Load(name); ok {
+		if cached := cached.(*cachedETag); cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+			return cached.eTag, nil, nil
+		}
+	}
+	data, err = io.ReadAll(file)
+	if err != nil {
+		return "", nil, err
+	}
+	eTag = computeETag(data)
+	f.eTags.Store(name, &cachedETag{eTag: eTag, modTime: info.ModTime(), size: info.Size()})
+	return eTag, data, nil
+}
+
+// Snapshot returns a view of the filesystem for a single request. Each regular file is only opened once by the view, so that its ETag,
+// info and content belong to the same version even if the file is replaced in between. Content that has been read to compute the ETag
+// is served from memory. The view has to be closed after the request.
+func (f *ReadFileFS) Snapshot() fs.FS {
+	return &readFileFSView{readFileFs: f, files: make(map[string]*viewFile)}
+}
+
+// readFileFSView is the view of a ReadFileFS for a single request, see ReadFileFS.Snapshot
+type readFileFSView struct {
+	readFileFs *ReadFileFS
+	mu         sync.Mutex
+	files      map[string]*viewFile
+}
+
+// viewFile is a regular file that has been opened by a readFileFSView. The data is set if the content has been read to compute the ETag.
+type viewFile struct {
+	file fs.File
+	info fs.FileInfo
+	eTag string
+	data []byte
+}
+
+// viewedFile is a viewFile that has been returned from readFileFSView.Open, it is only closed together with the view
+type viewedFile struct {
+	*viewFile
+}
+
+// open returns the regular file with the given name, which is opened if this has not been done yet. Directories return nil.
+func (v *readFileFSView) open(name string) (*viewFile, error) {
+	if file, ok := v.files[name]; ok {
+		return file, nil
+	}
+	file, err := v.readFileFs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		utils.Close(context.Background(), file)
+		return nil, err
+	}
+	result := &viewFile{file: file, info: info}
+	v.files[name] = result
+	return result, nil
+}
+
+// Open returns the file that has been opened by the view, directories are opened from the underlying filesystem.
+func (v *readFileFSView) Open(name string) (fs.File, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	file, err := v.open(name)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return v.readFileFs.Open(name)
+	}
+	// empty content is served from the file, as the seek of in-memory files does not support it
+	if len(file.data) > 0 {
+		return &openMemoryFile{file: &memoryFile{data: file.data, eTag: file.eTag, info: file.info}}, nil
+	}
+	result := &viewedFile{viewFile: file}
+	if _, err := result.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ETag returns the ETag of the file that has been opened by the view, see ReadFileFS.ETag.
+func (v *readFileFSView) ETag(name string) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	file, err := v.open(name)
+	if err != nil {
+		return "", err
+	}
+	if file == nil {
+		return "", fs.ErrNotExist
+	}
+	if file.eTag == "" {
+		if _, err := (&viewedFile{viewFile: file}).Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+		file.eTag, file.data, err = v.readFileFs.eTag(name, file.file, file.info)
+	}
+	return file.eTag, err
+}
+
+// Close closes all files that have been opened by the view.
+func (v *readFileFSView) Close() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	errs := make([]error, 0, len(v.files))
+	for _, file := range v.files {
+		errs = append(errs, file.file.Close())
+	}
+	clear(v.files)
+	return errors.Join(errs...)
+}
+
+// Stat returns the info of the file from the time it has been opened by the view.
+func (f *viewedFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// Read reads from the underlying file.
+func (f *viewedFile) Read(dst []byte) (int, error) {
+	return f.file.Read(dst)
+}
+
+// Seek moves the offset of the underlying file, which has to implement io.Seeker.
+func (f *viewedFile) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := f.file.(io.Seeker)
+	if !ok {
+		return 0, errors.New("filesystem seek error: the underlying file does not support seeking")
+	}
+	return seeker.Seek(offset, whence)
+}
+
+// Close does nothing, the underlying file is closed together with the view.
+func (f *viewedFile) Close() error {
+	return nil
+}
@@ -1,6 +1,8 @@
 package filesystem_test
 
 import (
+	"io"
+	"io/fs"
 	"os"
 	"path"
 	"testing"
@@ -21,3 +23,68 @@ func TestReadFileFs(t *testing.T) {
 
 	require.Equal(t, originalData, readFileFsData)
 }
+
+func TestReadFileFsETag(t *testing.T) {
+	readFileFs := &filesystem.ReadFileFS{FS: os.DirFS(testDir)}
+	eTag, err := readFileFs.ETag(testFile)
+	require.NoError(t, err)
+	require.NotEmpty(t, eTag)
+	otherETag, err := readFileFs.ETag("index.html")
+	require.NoError(t, err)
+	require.NotEqual(t, eTag, otherETag)
+
+	// the ETag is the content hash
+	memoryFs, err := filesystem.NewMemoryFs(testDir)
+	require.NoError(t, err)
+	memoryETag, err := memoryFs.ETag(testFile)
+	require.NoError(t, err)
+	require.Equal(t, memoryETag, eTag)
+
+	_, err = readFileFs.ETag(".")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = readFileFs.ETag("missing.js")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+// TestReadFileFsSnapshot tests that the ETag and the content of a snapshot belong to the same version of a replaced file
+func TestReadFileFsSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	replace := func(content string) {
+		require.NoError(t, os.WriteFile(path.Join(dir, "tmp"), []byte(content), 0o600))
+		require.NoError(t, os.Rename(path.Join(dir, "tmp"), path.Join(dir, testFile)))
+	}
+	replace("old")
+	readFileFs := &filesystem.ReadFileFS{FS: os.DirFS(dir)}
+	oldETag, err := readFileFs.ETag(testFile)
+	require.NoError(t, err)
+
+	for _, testCase := range []struct {
+		name     string
+		content  string
+		eTag     string
+		replaced string
+	}{
+		{name: "cached etag", content: "old", eTag: oldETag, replaced: "new"},
+		{name: "computed etag", content: "new", replaced: "newer"},
+	} {
+		snapshot, ok := readFileFs.Snapshot().(interface {
+			fs.FS
+			io.Closer
+			ETag(name string) (string, error)
+		})
+		require.True(t, ok)
+		eTag, err := snapshot.ETag(testFile)
+		require.NoError(t, err, testCase.name)
+		if testCase.eTag != "" {
+			require.Equal(t, testCase.eTag, eTag, testCase.name)
+		}
+		replace(testCase.replaced)
+		data, err := fs.ReadFile(snapshot, testFile)
+		require.NoError(t, err, testCase.name)
+		require.Equal(t, testCase.content, string(data), testCase.name)
+		require.NoError(t, snapshot.Close())
+	}
+	newerETag, err := readFileFs.ETag(testFile)
+	require.NoError(t, err)
+	require.NotEqual(t, oldETag, newerETag)
+}
@@ -0,0 +1,129 @@
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/ngergs/websrv/v5/internal/utils"
+)
+
+// make sure that we implement the fs.ReadFileFS interface
+var _ fs.ReadFileFS = &WatchedMemoryFS{}
+
+// WatchedMemoryFS is an in-memory filesystem that watches the underlying directory and rebuilds itself in the background on changes.
+// The rebuilt filesystem (including e.g. precompressed sidecar files) is swapped in atomically.
+type WatchedMemoryFS struct {
+	targetPath string
+	prepare    func(*MemoryFS) (*MemoryFS, error)
+	watcher    *fsnotify.Watcher
+	snapshot   atomic.Pointer[MemoryFS]
+	mu         sync.Mutex
+	onReload   []func()
+	invalidate []func()
+}
+
+// NewWatchedMemoryFs reads the targetPath into memory and watches it for changes till the context is cancelled.
+// The optional prepare function is applied to each newly read MemoryFS before it is swapped in, e.g. to add sidecars via MemoryFS.WithSidecars.
+// A reload is executed once no further change has been observed for the debounce duration.
+func NewWatchedMemoryFs(ctx context.Context, targetPath string, debounce time.Duration, prepare func(*MemoryFS) (*MemoryFS, error)) (*WatchedMemoryFS, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("error setting up filesystem watcher: %w", err)
+	}
+	w := &WatchedMemoryFS{
+		targetPath: path.Clean(targetPath),
+		prepare:    prepare,
+		watcher:    watcher,
+	}
+	if err := w.reload(); err != nil {
+		utils.Close(ctx, watcher)
+		return nil, err
+	}
+	// the directories are watched recursively and new subdirectories are added on each reload, see reload
+	go utils.WatchDebounced(ctx, "in-memory-filesystem", w.watcher, debounce, w.reload)
+	return w, nil
+}
+
+// OnReload registers functions that are called after the new version of the filesystem has been swapped in, e.g. to re-read files.
+func (w *WatchedMemoryFS) OnReload(f ...func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.onReload = append(w.onReload, f...)
+}
+
+// InvalidateOnReload registers functions that are called right before and after the new version of the filesystem is swapped in
+// to invalidate caches. Caches that have been filled from the previous version by concurrent requests in between would otherwise
+// mix its content with the new one.
+func (w *WatchedMemoryFS) InvalidateOnReload(f ...func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.invalidate = append(w.invalidate, f...)
+}
+
+// Open opens the given file from the current in-memory filesystem.
+func (w *WatchedMemoryFS) Open(name string) (fs.File, error) {
+	return w.snapshot.Load().Open(name)
+}
+
+// ReadFile reads the given file from the current in-memory filesystem.
+func (w *WatchedMemoryFS) ReadFile(name string) ([]byte, error) {
+	return w.snapshot.Load().ReadFile(name)
+}
+
+// Snapshot returns the current in-memory filesystem, it is not affected by later reloads.
+func (w *WatchedMemoryFS) Snapshot() fs.FS {
+	return w.snapshot.Load()
+}
+
+// ETag returns the precomputed ETag of the given file from the current in-memory filesystem, see MemoryFS.ETag.
+func (w *WatchedMemoryFS) ETag(name string) (string, error) {
+	return w.snapshot.Load().ETag(name)
+}
+
+// reload builds a new snapshot, swaps it in and informs the InvalidateOnReload listeners before and after and the OnReload listeners after the swap.
+// Also makes sure that all (new) subdirectories are watched.
+func (w *WatchedMemoryFS) reload() error {
+	err := filepath.WalkDir(w.targetPath, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return w.watcher.Add(filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error watching directories: %w", err)
+	}
+
+	snapshot, err := NewMemoryFs(w.targetPath)
+	if err != nil {
+		return err
+	}
+	if w.prepare != nil {
+		snapshot, err = w.prepare(snapshot)
+		if err != nil {
+			return fmt.Errorf("error preparing in-memory-fs: %w", err)
+		}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, f := range w.invalidate {
+		f()
+	}
+	w.snapshot.Store(snapshot)
+	for _, f := range w.invalidate {
+		f()
+	}
+	for _, f := range w.onReload {
+		f()
+	}
+	return nil
+}
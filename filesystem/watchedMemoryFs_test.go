@@ -0,0 +1,81 @@
+package filesystem_test
+
+import (
+	"compress/gzip"
+	"context"
+	"os"
+	"path"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ngergs/websrv/v5/filesystem"
+	"github.com/ngergs/websrv/v5/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+const watchDebounce = 10 * time.Millisecond
+
+// TestWatchedMemoryFsReload tests that changes to the target dir are picked up for the plain files and the prepared sidecars
+func TestWatchedMemoryFsReload(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(dir, testFile), []byte("old"), 0o600))
+
+	watchedFs, err := filesystem.NewWatchedMemoryFs(ctx, dir, watchDebounce, func(memoryFs *filesystem.MemoryFS) (*filesystem.MemoryFS, error) {
+		return memoryFs.WithSidecars(nil, utils.EncodingGzip)
+	})
+	require.NoError(t, err)
+	var reloaded, invalidated atomic.Int32
+	var lastSeen atomic.Value
+	watchedFs.InvalidateOnReload(func() { invalidated.Add(1) })
+	watchedFs.OnReload(func() {
+		// the invalidation listeners have been called before and after the swap
+		if invalidated.Load() != 2*reloaded.Add(1) {
+			lastSeen.Store("invalidation missing")
+			return
+		}
+		data, err := watchedFs.ReadFile(testFile)
+		if err == nil {
+			lastSeen.Store(string(data))
+		}
+	})
+	data, err := watchedFs.ReadFile(testFile)
+	require.NoError(t, err)
+	require.Equal(t, []byte("old"), data)
+
+	require.NoError(t, os.WriteFile(path.Join(dir, testFile), []byte("new"), 0o600))
+	require.Eventually(t, func() bool {
+		data, err := watchedFs.ReadFile(testFile)
+		return err == nil && string(data) == "new"
+	}, time.Second, watchDebounce)
+	require.Eventually(t, func() bool { return lastSeen.Load() == "new" }, time.Second, watchDebounce)
+
+	zipped, err := watchedFs.ReadFile(testFile + ".gz")
+	require.NoError(t, err)
+	expected, err := utils.Zip([]byte("new"), gzip.BestCompression)
+	require.NoError(t, err)
+	require.Equal(t, expected, zipped)
+}
+
+// TestWatchedMemoryFsNewSubdir tests that files in newly created subdirectories are picked up
+func TestWatchedMemoryFsNewSubdir(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := t.TempDir()
+
+	watchedFs, err := filesystem.NewWatchedMemoryFs(ctx, dir, watchDebounce, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, os.Mkdir(path.Join(dir, "sub"), 0o700))
+	require.Eventually(t, func() bool {
+		_, err := watchedFs.Open("sub")
+		return err == nil
+	}, time.Second, watchDebounce)
+	require.NoError(t, os.WriteFile(path.Join(dir, "sub", testFile), []byte("test"), 0o600))
+	require.Eventually(t, func() bool {
+		data, err := watchedFs.ReadFile("sub/" + testFile)
+		return err == nil && string(data) == "test"
+	}, time.Second, watchDebounce)
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/rs/zerolog/log"
+)
+
+// Content-Encoding values of the supported compression algorithms
+const (
+	EncodingGzip   = "gzip"
+	EncodingBrotli = "br"
+	EncodingZstd   = "zstd"
+)
+
+var ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// SidecarExtensions maps the supported content encodings to the file extension of precompressed sidecar files, e.g. main.js.br for main.js
+var SidecarExtensions = map[string]string{
+	EncodingGzip:   ".gz",
+	EncodingBrotli: ".br",
+	EncodingZstd:   ".zst",
+}
+
+// Compress compresses the input byte slice with the best compression level of the given content encoding.
+func Compress(in []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case EncodingGzip:
+		return Zip(in, gzip.BestCompression)
+	case EncodingBrotli:
+		return Brotli(in, brotli.BestCompression)
+	case EncodingZstd:
+		return Zstd(in, zstd.SpeedBestCompression)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, encoding)
+	}
+}
+
+// Brotli compresses the input byte slice with the given brotli compression level.
+func Brotli(in []byte, level int) ([]byte, error) {
+	var result bytes.Buffer
+	brotliWriter := brotli.NewWriterLevel(&result, level)
+	_, err := io.Copy(brotliWriter, bytes.NewReader(in))
+	if err != nil {
+		return nil, err
+	}
+	// the brotli writer errors on repeated closing, so we can not defer it
+	err = brotliWriter.Close()
+	if err != nil {
+		return nil, err
+	}
+	return result.Bytes(), nil
+}
+
+// Unbrotli decompresses the brotli compressed input byte slice.
+func Unbrotli(in []byte) ([]byte, error) {
+	var result bytes.Buffer
+	_, err := result.ReadFrom(brotli.NewReader(bytes.NewReader(in)))
+	if err != nil {
+		return nil, err
+	}
+	return result.Bytes(), nil
+}
+
+// Zstd compresses the input byte slice with the given zstd compression level.
+func Zstd(in []byte, level zstd.EncoderLevel) ([]byte, error) {
+	zstdWriter, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(level))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := zstdWriter.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to close zstd writer")
+		}
+	}()
+	return zstdWriter.EncodeAll(in, nil), nil
+}
+
+// Unzstd decompresses the zstd compressed input byte slice.
+func Unzstd(in []byte) ([]byte, error) {
+	zstdReader, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer zstdReader.Close()
+	return zstdReader.DecodeAll(in, nil)
+}
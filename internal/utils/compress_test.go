@@ -0,0 +1,30 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/ngergs/websrv/v5/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompress(t *testing.T) {
+	testMsg := []byte("test123test123test123")
+	decompress := map[string]func([]byte) ([]byte, error){
+		utils.EncodingGzip:   utils.Unzip,
+		utils.EncodingBrotli: utils.Unbrotli,
+		utils.EncodingZstd:   utils.Unzstd,
+	}
+	for encoding, decompressFunc := range decompress {
+		compressed, err := utils.Compress(testMsg, encoding)
+		require.NoError(t, err)
+		require.NotEqual(t, testMsg, compressed)
+		decompressed, err := decompressFunc(compressed)
+		require.NoError(t, err)
+		require.Equal(t, testMsg, decompressed)
+	}
+}
+
+func TestCompressUnsupportedEncoding(t *testing.T) {
+	_, err := utils.Compress([]byte("test123"), "deflate")
+	require.ErrorIs(t, err, utils.ErrUnsupportedEncoding)
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// WatchDebounced calls reload once no further event of the watcher has been observed for the debounce duration.
+// Blocks till the context is cancelled and closes the watcher afterwards. The name is used for logging.
+func WatchDebounced(ctx context.Context, name string, watcher *fsnotify.Watcher, debounce time.Duration, reload func() error) {
+	defer Close(ctx, watcher)
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			log.Debug().Msgf("Received %s filesystem event: %s", name, event)
+			timer.Reset(debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Warn().Err(err).Msgf("Error watching the %s directory", name)
+		case <-timer.C:
+			log.Info().Msgf("Reloading %s", name)
+			if err := reload(); err != nil {
+				log.Error().Err(err).Msgf("Error reloading %s, keeping the previous version", name)
+			}
+		}
+	}
+}
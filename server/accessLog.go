@@ -14,11 +14,16 @@ import (
 
 var DomainLabel = "domain"
 var StatusLabel = "status"
+var SourceLabel = "source"
+var PrefixLabel = "prefix"
 
 // PrometheusRegistration wraps a prometheus registerer and corresponding registered types.
 type PrometheusRegistration struct {
-	bytesSend  *prometheus.CounterVec
-	statusCode *prometheus.CounterVec
+	bytesSend      *prometheus.CounterVec
+	statusCode     *prometheus.CounterVec
+	clientIPSource *prometheus.CounterVec
+	// ipFilterDecisions is counted by the IPFilterHandler
+	ipFilterDecisions *prometheus.CounterVec
 }
 
 // AccessMetricsRegister registrates the relevant prometheus types and returns a custom registration type
@@ -35,6 +40,18 @@ func AccessMetricsRegister(registerer prometheus.Registerer, prometheusNamespace
 		Name:      "http_statuscode",
 		Help:      "HTTP Response status code.",
 	}, []string{DomainLabel, StatusLabel})
+	var clientIPSource = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: prometheusNamespace,
+		Subsystem: "access",
+		Name:      "client_ip_source",
+		Help:      "Number of requests by the source of the client IP, direct peer or forwarding headers of trusted proxies.",
+	}, []string{DomainLabel, SourceLabel})
+	var ipFilterDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: prometheusNamespace,
+		Subsystem: "access",
+		Name:      "ipfilter_decisions",
+		Help:      "Number of requests allowed or denied by the IP filter rules.",
+	}, []string{DomainLabel, PrefixLabel, DecisionLabel})
 
 	err := registerer.Register(bytesSend)
 	if err != nil {
@@ -44,9 +61,19 @@ func AccessMetricsRegister(registerer prometheus.Registerer, prometheusNamespace
 	if err != nil {
 		return nil, fmt.Errorf("failed to register http_statuscode metric: %w", err)
 	}
+	err = registerer.Register(clientIPSource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register client_ip_source metric: %w", err)
+	}
+	err = registerer.Register(ipFilterDecisions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register ipfilter_decisions metric: %w", err)
+	}
 	return &PrometheusRegistration{
-		bytesSend:  bytesSend,
-		statusCode: statusCode,
+		bytesSend:         bytesSend,
+		statusCode:        statusCode,
+		clientIPSource:    clientIPSource,
+		ipFilterDecisions: ipFilterDecisions,
 	}, nil
 }
 
@@ -58,6 +85,11 @@ func AccessMetricsHandler(next http.Handler, registration *PrometheusRegistratio
 
 		registration.statusCode.With(map[string]string{DomainLabel: r.Host, StatusLabel: strconv.Itoa(m.Code)}).Inc()
 		registration.bytesSend.With(map[string]string{DomainLabel: r.Host}).Add(float64(m.Written))
+		source := "direct"
+		if isForwarded(r) {
+			source = "forwarded"
+		}
+		registration.clientIPSource.With(map[string]string{DomainLabel: r.Host, SourceLabel: source}).Inc()
 	})
 }
 
@@ -77,13 +109,19 @@ func AccessLogHandler(next http.Handler) http.Handler {
 				log.Warn().Msgf("Request id is not, but not a string value: %v", requestId)
 			}
 		}
+		if identity := GetClientIdentity(r); identity != nil {
+			logEvent = logEvent.Str("clientSubject", identity.Subject)
+		}
+		if isForwarded(r) {
+			logEvent = logEvent.Str("peerAddr", r.RemoteAddr)
+		}
 		logEvent.Dict("httpRequest", zerolog.Dict().
 			Str("requestMethod", r.Method).
 			Str("requestUrl", getFullUrl(r)).
 			Int("status", m.Code).
 			Str("responseSize", strconv.FormatInt(m.Written, 10)).
 			Str("userAgent", r.UserAgent()).
-			Str("remoteIp", r.RemoteAddr).
+			Str("remoteIp", GetClientIP(r).String()).
 			Str("referer", r.Referer()).
 			Str("latency", fmt.Sprintf("%.09fs", m.Duration.Seconds()))).
 			Msg("")
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// NewACMEManager returns an autocert.Manager that obtains certificates for the domains from the ACME directoryURL (empty uses Let's Encrypt)
+// and renews them automatically renewBefore they expire (zero uses the autocert default). The terms of service are accepted.
+// Certificates and the account key are cached in the cacheDir, which has to be writable.
+// The HTTP-01 challenge requires that the ACMEHTTPHandler is served on port 80, e.g. via HTTPSRedirectHandler.
+// The TLS-ALPN-01 challenge requires a TLS listener on port 443 that uses the ACMETLSConfig.
+func NewACMEManager(domains []string, email string, cacheDir string, directoryURL string, renewBefore time.Duration) *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:      autocert.AcceptTOS,
+		Cache:       autocert.DirCache(cacheDir),
+		HostPolicy:  autocert.HostWhitelist(domains...),
+		RenewBefore: renewBefore,
+		Client:      &acme.Client{DirectoryURL: directoryURL},
+		Email:       email,
+	}
+}
+
+// ACMEHTTPHandler answers the ACME HTTP-01 challenges, all other requests receive a 404.
+// The port is removed from the request host, as the host policy of the manager only knows the domains.
+func ACMEHTTPHandler(manager *autocert.Manager) http.Handler {
+	handler := manager.HTTPHandler(http.NotFoundHandler())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if host, _, err := net.SplitHostPort(r.Host); err == nil {
+			r = r.Clone(r.Context())
+			r.Host = host
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// ACMETLSConfig returns a TLS configuration like TLSConfig that uses the manager for the certificates and also answers the ACME TLS-ALPN-01 challenges.
+func ACMETLSConfig(manager *autocert.Manager, minVersion uint16, cipherSuites []uint16) *tls.Config {
+	config := TLSConfig(minVersion, cipherSuites, manager.GetCertificate)
+	config.NextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
+	return config
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var BasicAuthUserKey = &ContextKey{val: "basicAuthUser"}
+
+// dummyHash is verified for unknown users, so that the response time does not reveal whether a user exists
+var dummyHash = sync.OnceValue(func() bcryptHash {
+	hash, err := bcrypt.GenerateFromPassword([]byte("websrv"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+// BasicAuthRule protects the requests with the path Prefix
+type BasicAuthRule struct {
+	// Prefix is a path prefix like /preview/, empty for all paths
+	Prefix string
+	// Realm is shown by the browser in the login dialog
+	Realm string
+}
+
+func (rule BasicAuthRule) pathPrefix() string {
+	return rule.Prefix
+}
+
+// BasicAuthenticator verifies the credentials of HTTP Basic authentication against the users of a htpasswd file, which is reloaded on changes.
+type BasicAuthenticator struct {
+	file  string
+	users atomic.Pointer[map[string]passwordHash]
+	// rules are sorted by descending prefix length
+	rules    []BasicAuthRule
+	failures *failureLimiter
+}
+
+// NewBasicAuthenticator reads the htpasswd file with bcrypt, {SHA} or argon2 hashes and watches it for changes till the context is cancelled.
+// A reload is executed once no further change has been observed for the debounce duration. Clients are rejected with 429
+// after maxFailures failed attempts per failureWindow, counted per client IP (see GetClientIP).
+func NewBasicAuthenticator(ctx context.Context, htpasswdFile string, debounce time.Duration, maxFailures int, failureWindow time.Duration,
+	rules ...BasicAuthRule) (*BasicAuthenticator, error) {
+	auth := &BasicAuthenticator{
+		file:     htpasswdFile,
+		rules:    sortByPrefixLength(rules),
+		failures: &failureLimiter{max: maxFailures, window: failureWindow, entries: make(map[string]*failureEntry)},
+	}
+	if err := auth.Reload(); err != nil {
+		return nil, err
+	}
+	if err := watchFiles(ctx, "htpasswd file", debounce, auth.Reload, htpasswdFile); err != nil {
+		return nil, err
+	}
+	return auth, nil
+}
+
+// Reload reads the htpasswd file. The previous users are kept on errors.
+func (auth *BasicAuthenticator) Reload() error {
+	users, err := readHtpasswd(auth.file)
+	if err != nil {
+		return err
+	}
+	auth.users.Store(&users)
+	return nil
+}
+
+// verify checks the credentials in constant time regarding the password and the existence of the user
+func (auth *BasicAuthenticator) verify(user string, password string) bool {
+	hash, ok := (*auth.users.Load())[user]
+	if !ok {
+		dummyHash().verify([]byte(password))
+		return false
+	}
+	return hash.verify([]byte(password))
+}
+
+// GetBasicAuthUser returns the user that has been authenticated by the BasicAuthHandler, empty if none
+func GetBasicAuthUser(r *http.Request) string {
+	user, _ := r.Context().Value(BasicAuthUserKey).(string)
+	return user
+}
+
+// BasicAuthHandler requires HTTP Basic authentication for the paths with a matching rule prefix, the longest matching prefix applies.
+// The request path has to be cleaned beforehand, see ValidateHandler. The authenticated user is stored in the request context.
+func BasicAuthHandler(next http.Handler, auth *BasicAuthenticator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rule, ok := longestPrefixMatch(auth.rules, r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		clientIP := GetClientIP(r).String()
+		if retryAfter, limited := auth.failures.limited(clientIP); limited {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		user, password, ok := r.BasicAuth()
+		if !ok || !auth.verify(user, password) {
+			if ok {
+				auth.failures.add(clientIP)
+				log.Debug().Msgf("Failed basic authentication for user %s from %s", user, clientIP)
+			}
+			w.Header().Set("WWW-Authenticate", "Basic realm="+strconv.Quote(rule.Realm)+`, charset="UTF-8"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), BasicAuthUserKey, user)))
+	})
+}
+
+// failureEntry counts the failures of a key within a window
+type failureEntry struct {
+	count int
+	reset time.Time
+}
+
+// failureLimiter limits the failed attempts per key within fixed windows, a maximum of zero disables the limit
+type failureLimiter struct {
+	max       int
+	window    time.Duration
+	mu        sync.Mutex
+	entries   map[string]*failureEntry
+	lastSweep time.Time
+}
+
+// limited checks whether the key has reached the maximal failures and returns the remaining duration of the window
+func (limiter *failureLimiter) limited(key string) (time.Duration, bool) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	entry, ok := limiter.entries[key]
+	if !ok {
+		return 0, false
+	}
+	remaining := time.Until(entry.reset)
+	if remaining <= 0 {
+		delete(limiter.entries, key)
+		return 0, false
+	}
+	return remaining, entry.count >= limiter.max
+}
+
+// add counts a failure for the key, expired entries are removed once per window
+func (limiter *failureLimiter) add(key string) {
+	if limiter.max <= 0 {
+		return
+	}
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	now := time.Now()
+	if now.Sub(limiter.lastSweep) >= limiter.window {
+		for entryKey, entry := range limiter.entries {
+			if !now.Before(entry.reset) {
+				delete(limiter.entries, entryKey)
+			}
+		}
+		limiter.lastSweep = now
+	}
+	entry, ok := limiter.entries[key]
+	if !ok {
+		entry = &failureEntry{reset: now.Add(limiter.window)}
+		limiter.entries[key] = entry
+	}
+	entry.count++
+}
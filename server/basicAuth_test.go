@@ -0,0 +1,135 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/stretchr/testify/require"
+)
+
+func basicAuthRequest(handler http.Handler, target string, user string, password string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	if user != "" {
+		r.SetBasicAuth(user, password)
+	}
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+// userHandler answers with the authenticated user
+var userHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte(server.GetBasicAuthUser(r)))
+})
+
+func TestBasicAuth(t *testing.T) {
+	file := filepath.Join(t.TempDir(), ".htpasswd")
+	schemes := []string{"bcrypt", "sha", "argon2i", "argon2id"}
+	lines := []string{"# preview users"}
+	for _, scheme := range schemes {
+		lines = append(lines, htpasswdLine(t, scheme, scheme, "secret-"+scheme))
+	}
+	writeHtpasswd(t, file, lines...)
+	auth, err := server.NewBasicAuthenticator(context.Background(), file, time.Second, 0, time.Minute,
+		server.BasicAuthRule{Prefix: "/preview/", Realm: "Preview"},
+		server.BasicAuthRule{Prefix: "/preview/internal/", Realm: `Internal "docs"`},
+	)
+	require.NoError(t, err)
+	handler := server.BasicAuthHandler(userHandler, auth)
+
+	for _, scheme := range schemes {
+		w := basicAuthRequest(handler, "/preview/index.html", scheme, "secret-"+scheme)
+		require.Equal(t, http.StatusOK, w.Code, scheme)
+		require.Equal(t, scheme, w.Body.String())
+		require.Equal(t, http.StatusUnauthorized, basicAuthRequest(handler, "/preview/", scheme, "wrong").Code, scheme)
+	}
+	w := basicAuthRequest(handler, "/preview", "", "")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Equal(t, `Basic realm="Preview", charset="UTF-8"`, w.Header().Get("WWW-Authenticate"))
+	w = basicAuthRequest(handler, "/preview/internal/docs", "unknown", "secret-sha")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Equal(t, `Basic realm="Internal \"docs\"", charset="UTF-8"`, w.Header().Get("WWW-Authenticate"))
+	// paths without matching rule are not protected
+	require.Equal(t, http.StatusOK, basicAuthRequest(handler, "/public", "", "").Code)
+}
+
+func TestBasicAuthRewrite(t *testing.T) {
+	file := filepath.Join(t.TempDir(), ".htpasswd")
+	writeHtpasswd(t, file, htpasswdLine(t, "bcrypt", "admin", "secret"))
+	auth, err := server.NewBasicAuthenticator(context.Background(), file, time.Second, 0, time.Minute, server.BasicAuthRule{Prefix: "/admin/"})
+	require.NoError(t, err)
+	handler := rewriteHandler(t, userHandler, server.BasicAuth(auth))
+	require.Equal(t, http.StatusUnauthorized, basicAuthRequest(handler, "/pub/a", "", "").Code)
+	w := basicAuthRequest(handler, "/pub/a", "admin", "secret")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "admin", w.Body.String())
+}
+
+func TestBasicAuthFailureLimit(t *testing.T) {
+	file := filepath.Join(t.TempDir(), ".htpasswd")
+	writeHtpasswd(t, file, htpasswdLine(t, "sha", "user", "secret"))
+	auth, err := server.NewBasicAuthenticator(context.Background(), file, time.Second, 2, time.Minute, server.BasicAuthRule{Realm: "websrv"})
+	require.NoError(t, err)
+	handler := server.BasicAuthHandler(userHandler, auth)
+
+	// missing credentials are no failed attempts
+	require.Equal(t, http.StatusUnauthorized, basicAuthRequest(handler, "/", "", "").Code)
+	require.Equal(t, http.StatusUnauthorized, basicAuthRequest(handler, "/", "user", "wrong").Code)
+	require.Equal(t, http.StatusOK, basicAuthRequest(handler, "/", "user", "secret").Code)
+	require.Equal(t, http.StatusUnauthorized, basicAuthRequest(handler, "/", "user", "wrong").Code)
+	w := basicAuthRequest(handler, "/", "user", "secret")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.NotEmpty(t, w.Header().Get("Retry-After"))
+}
+
+func TestBasicAuthFailureLimitForgedForwarded(t *testing.T) {
+	file := filepath.Join(t.TempDir(), ".htpasswd")
+	writeHtpasswd(t, file, htpasswdLine(t, "sha", "user", "secret"))
+	auth, err := server.NewBasicAuthenticator(context.Background(), file, time.Second, 1, time.Minute, server.BasicAuthRule{Realm: "websrv"})
+	require.NoError(t, err)
+	resolver, err := server.NewClientIPResolver("X-Forwarded-For", "10.0.0.0/8")
+	require.NoError(t, err)
+	handler := server.RealIPHandler(server.BasicAuthHandler(userHandler, auth), resolver)
+
+	// the failed attempts are counted for the client IP appended by the trusted proxy, rotating forged Forwarded headers are ignored
+	for i, expected := range []int{http.StatusUnauthorized, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("X-Forwarded-For", "203.0.113.1")
+		r.Header.Set("Forwarded", "for=192.0.2."+strconv.Itoa(i+1))
+		r.SetBasicAuth("user", "wrong")
+		handler.ServeHTTP(w, r)
+		require.Equal(t, expected, w.Code, i)
+	}
+}
+
+func TestBasicAuthReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), ".htpasswd")
+	writeHtpasswd(t, file, htpasswdLine(t, "sha", "old", "secret"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	auth, err := server.NewBasicAuthenticator(ctx, file, 10*time.Millisecond, 0, time.Minute, server.BasicAuthRule{Realm: "websrv"})
+	require.NoError(t, err)
+	handler := server.BasicAuthHandler(userHandler, auth)
+	require.Equal(t, http.StatusOK, basicAuthRequest(handler, "/", "old", "secret").Code)
+
+	writeHtpasswd(t, file, htpasswdLine(t, "sha", "new", "secret"), htpasswdLine(t, "sha", "old", "changed"))
+	// the old user is kept and checked first, as unknown users are verified against a bcrypt hash, which is slow with the race detector
+	require.Eventually(t, func() bool {
+		return basicAuthRequest(handler, "/", "old", "secret").Code == http.StatusUnauthorized &&
+			basicAuthRequest(handler, "/", "new", "secret").Code == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// invalid files keep the previous users
+	writeHtpasswd(t, file, "invalid")
+	require.Error(t, auth.Reload())
+	require.Equal(t, http.StatusOK, basicAuthRequest(handler, "/", "new", "secret").Code)
+}
@@ -1,99 +1,133 @@
 package server
 
 import (
-	"bytes"
-	"crypto/sha256"
-	"encoding/base64"
+	"context"
 	"io"
+	"io/fs"
 	"net/http"
+	"strings"
+	"time"
 
-	"github.com/felixge/httpsnoop"
 	"github.com/ngergs/websrv/v5/internal/utils"
-	"github.com/puzpuzpuz/xsync"
 	"github.com/rs/zerolog/log"
 )
 
-// cacheHandler implements a http.Handler that supports Caching via the ETag and If-None-Match HTTP-Headers.
-// The CacheHandler required that all following handlers only serve static resources.
-// The next handler in the chain is only called when a cache mismatch occurs.
-type cacheHandler struct {
-	Next   http.Handler
-	Hashes *xsync.MapOf[string, string]
+// ETagFS is a filesystem that provides the ETags of its files without reading their content on each request.
+type ETagFS interface {
+	fs.FS
+	ETag(name string) (string, error)
 }
 
-//nolint:contextcheck // context is obtained from request
-func (handler *cacheHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	eTag, ok := handler.Hashes.Load(r.URL.Path)
-	if ok {
-		if r.Header.Get("If-None-Match") == eTag {
-			log.Debug().Msgf("Returned not modified for %s: %s", r.URL.Path, eTag)
-			w.WriteHeader(http.StatusNotModified)
-			return
+// SnapshotFS is an ETagFS whose content changes, e.g. on reloads. Snapshot returns the current version of the files with the same
+// capabilities (e.g. ETags), which is pinned to the request by the CacheHandler and the PrecompressedHandler, see FileServer.
+// Snapshots that implement io.Closer are closed once the request has been served.
+type SnapshotFS interface {
+	ETagFS
+	Snapshot() fs.FS
+}
+
+// snapshotKey is the context key of the snapshot of a SnapshotFS that has been pinned to the request
+type snapshotKey struct {
+	fsys SnapshotFS
+}
+
+// pinSnapshot pins the current snapshot of the fsys to the request context if it is a SnapshotFS without pinned snapshot.
+// The returned release function closes a newly pinned snapshot and has to be called once the request has been served.
+func pinSnapshot(r *http.Request, fsys fs.FS) (*http.Request, func()) {
+	snapshotFs, ok := fsys.(SnapshotFS)
+	if !ok || r.Context().Value(snapshotKey{snapshotFs}) != nil {
+		return r, func() {}
+	}
+	snapshot := snapshotFs.Snapshot()
+	release := func() {}
+	if closer, ok := snapshot.(io.Closer); ok {
+		release = func() { utils.Close(r.Context(), closer) }
+	}
+	return r.WithContext(context.WithValue(r.Context(), snapshotKey{snapshotFs}, snapshot)), release
+}
+
+// pinnedSnapshot returns the snapshot of the fsys that has been pinned to the request context, the fsys itself if there is none
+func pinnedSnapshot[T fs.FS](r *http.Request, fsys T) T {
+	if snapshotFs, ok := any(fsys).(SnapshotFS); ok {
+		if snapshot, ok := r.Context().Value(snapshotKey{snapshotFs}).(T); ok {
+			return snapshot
 		}
-		// we have the hash but not present in the request, add e-tag and continue
-		log.Debug().Msgf("Returned already stored eTag for %s: %s", r.URL.Path, eTag)
-		w.Header().Set("ETag", eTag)
-		handler.Next.ServeHTTP(w, r)
-		return
 	}
+	return fsys
+}
 
-	// We do not have the hash yet, get it and add ETag
-	status := http.StatusOK
-	pr, pw := io.Pipe()
-	defer utils.Close(r.Context(), pr)
-	wrappedW := httpsnoop.Wrap(w, httpsnoop.Hooks{
-		WriteHeader: func(headerFunc httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
-			return func(code int) {
-				status = code
-				headerFunc(code)
-			}
-		},
-		Write: func(writeFunc httpsnoop.WriteFunc) httpsnoop.WriteFunc {
-			return func(b []byte) (int, error) {
-				if status == http.StatusOK {
-					return pw.Write(b)
-				}
-				return writeFunc(b)
-			}
-		},
-		ReadFrom: func(fromFunc httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
-			return func(src io.Reader) (int64, error) {
-				if status == http.StatusOK {
-					return io.Copy(pw, src)
-				}
-				return fromFunc(src)
-			}
-		},
+// FileServer serves the files of the fsys like http.FileServer. The files are read from the snapshot that has been pinned to
+// the request, so that the content belongs to the same version as the ETag of the CacheHandler.
+func FileServer(fsys fs.FS) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.FileServer(http.FS(pinnedSnapshot(r, fsys))).ServeHTTP(w, r)
 	})
-	go func() {
-		handler.Next.ServeHTTP(wrappedW, r)
-		utils.Close(r.Context(), pw)
-	}()
-	data, err := io.ReadAll(pr)
-	if status != http.StatusOK {
+}
+
+// CacheHandler implements a http.Handler that supports conditional requests according to RFC 9110 via the ETag and Last-Modified HTTP-Headers.
+// Supported are If-Match, If-None-Match, If-Modified-Since, If-Unmodified-Since and If-Range (together with Range requests).
+// The CacheHandler requires that all following handlers only serve static resources from the FS.
+// The ETags are read from the FS, so responses are never buffered. For a SnapshotFS the ETag, the modification time and the content
+// (see FileServer) are read from the same snapshot. Precompressed sidecar files have their own ETag,
+// responses that are compressed dynamically by following handlers receive a weak version of the ETag of the uncompressed file.
+// The next handler in the chain is only called when the content has to be served.
+type CacheHandler struct {
+	Next http.Handler
+	FS   ETagFS
+}
+
+func (handler *CacheHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r, release := pinSnapshot(r, handler.FS)
+	defer release()
+	fsys := pinnedSnapshot(r, handler.FS)
+	name := resolveFileName(fsys, r.URL.Path)
+	eTag, err := fsys.ETag(name)
+	if err != nil {
+		// e.g. missing files, leave the response to the next handler
+		handler.Next.ServeHTTP(w, r)
 		return
 	}
-	if err != nil {
-		log.Err(err).Msgf("error storing response in middleware to determine hash %s", r.URL.Path)
-		http.Error(w, "Error serving file.", http.StatusInternalServerError)
+	eTag = quoteETag(eTag)
+	var modTime time.Time
+	if stat, err := fs.Stat(fsys, name); err == nil {
+		modTime = stat.ModTime()
 	}
-	hash := sha256.Sum256(data)
-	eTag = base64.StdEncoding.EncodeToString(hash[:])
-	log.Debug().Msgf("Computed missing eTag for %s: %s", r.URL.Path, eTag)
-	handler.Hashes.Store(r.URL.Path, eTag)
-	w.Header().Set("ETag", eTag)
 
-	_, err = io.Copy(w, bytes.NewReader(data))
-	if err != nil {
-		log.Err(err).Msgf("error coping response in middleware after determining hash %s", r.URL.Path)
+	w.Header().Set("ETag", eTag)
+	if !modTime.IsZero() {
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	status, ignoreRange := evaluatePreconditions(r, eTag, modTime)
+	if status != 0 {
+		// the client has cached a dynamically compressed response, so the weak ETag is returned as for the full response
+		if status == http.StatusNotModified && matchesWeakETagOnly(r.Header.Get("If-None-Match"), eTag) {
+			w.Header().Set("ETag", "W/"+eTag)
+		}
+		log.Debug().Msgf("Returned %d for conditional request %s: %s", status, r.URL.Path, w.Header().Get("ETag"))
+		w.WriteHeader(status)
+		return
 	}
+	r = withoutPreconditions(r, ignoreRange)
+
+	encoding := w.Header().Get("Content-Encoding")
+	wrappedW := beforeWriteHeader(w, func(int) {
+		// the content has been compressed on the fly, so it is only semantically equivalent
+		if w.Header().Get("Content-Encoding") != encoding {
+			w.Header().Set("ETag", "W/"+eTag)
+		}
+	})
+	handler.Next.ServeHTTP(wrappedW, r)
+}
+
+// trimWeak removes the weakness indicator from the ETag
+func trimWeak(eTag string) string {
+	return strings.TrimPrefix(eTag, "W/")
 }
 
-// NewCacheHandler computes and stores the hashes for all files
-func NewCacheHandler(next http.Handler) *cacheHandler {
-	// compute hashes
-	return &cacheHandler{
-		Next:   next,
-		Hashes: xsync.NewMapOf[string](),
+// NewCacheHandler returns a CacheHandler which reads the ETags for the requests from the fsys.
+func NewCacheHandler(next http.Handler, fsys ETagFS) *CacheHandler {
+	return &CacheHandler{
+		Next: next,
+		FS:   fsys,
 	}
 }
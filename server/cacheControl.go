@@ -0,0 +1,32 @@
+package server
+
+import (
+	"net/http"
+)
+
+// CacheControlRule sets the Cache-Control HTTP-Header to the Value for all request paths that are matched by the Matcher.
+type CacheControlRule struct {
+	Matcher *PathMatcher
+	Value   string
+}
+
+// CacheControlHandler sets the Cache-Control HTTP-Header according to the first rule that matches the request path.
+// Already present Cache-Control headers (e.g. from the static headers) are overwritten. If no rule matches, the response headers are not modified.
+// The rules are only applied to 2xx and 304 responses right before the headers are sent, so error responses and the content that
+// a preceding FallbackHandler serves for them are not cached according to the rule for the original path.
+func CacheControlHandler(next http.Handler, rules ...CacheControlRule) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wrappedW := beforeWriteHeader(w, func(code int) {
+			if (code < 200 || code >= 300) && code != http.StatusNotModified {
+				return
+			}
+			for _, rule := range rules {
+				if rule.Matcher.Matches(r.URL.Path) {
+					w.Header().Set("Cache-Control", rule.Value)
+					return
+				}
+			}
+		})
+		next.ServeHTTP(wrappedW, r)
+	})
+}
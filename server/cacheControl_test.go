@@ -0,0 +1,63 @@
+package server_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheControlRules(t *testing.T) {
+	hashedMatcher, err := server.NewPathMatcher(server.PathMatch{Hashed: true})
+	require.NoError(t, err)
+	indexMatcher, err := server.NewPathMatcher(server.PathMatch{Glob: "/**.html"})
+	require.NoError(t, err)
+	rules := []server.CacheControlRule{
+		{Matcher: hashedMatcher, Value: "public, max-age=31536000, immutable"},
+		{Matcher: indexMatcher, Value: "no-cache"},
+	}
+	for requestPath, expected := range map[string]string{
+		"/main.3f9a1c.js": "public, max-age=31536000, immutable",
+		"/index.html":     "no-cache",
+		"/main.js":        "static",
+	} {
+		for _, status := range []int{http.StatusOK, http.StatusNotModified} {
+			w, r, next := getDefaultHandlerMocks()
+			next.serveHttpFunc = func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(status) }
+			w.Header().Set("Cache-Control", "static")
+			r.URL = &url.URL{Path: requestPath}
+			server.CacheControlHandler(next, rules...).ServeHTTP(w, r)
+			require.Equal(t, expected, w.Header().Get("Cache-Control"), requestPath)
+		}
+	}
+
+	// error responses are not modified
+	w, r, next := getDefaultHandlerMocks()
+	next.serveHttpFunc = func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNotFound) }
+	w.Header().Set("Cache-Control", "static")
+	r.URL = &url.URL{Path: "/main.3f9a1c.js"}
+	server.CacheControlHandler(next, rules...).ServeHTTP(w, r)
+	require.Equal(t, "static", w.Header().Get("Cache-Control"))
+}
+
+func TestCacheControlFallback(t *testing.T) {
+	hashedMatcher, err := server.NewPathMatcher(server.PathMatch{Hashed: true})
+	require.NoError(t, err)
+	w, r, next := getDefaultHandlerMocks()
+	next.serveHttpFunc = func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/index.html" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("index"))
+	}
+	handler := server.FallbackHandler(server.CacheControlHandler(next, server.CacheControlRule{Matcher: hashedMatcher, Value: "immutable"}),
+		"/index.html", http.StatusNotFound)
+	r.URL = &url.URL{Path: "/main.3f9a1c.js"}
+	handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "index", w.Body.String())
+	require.Empty(t, w.Header().Get("Cache-Control"))
+}
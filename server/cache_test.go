@@ -1,9 +1,13 @@
 package server_test
 
 import (
+	"io/fs"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/ngergs/websrv/v5/server"
 
@@ -11,15 +15,65 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+const eTag = "abc123"
+const quotedETag = `"` + eTag + `"`
+
+var modTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// mockETagFs provides static ETags for the files in the underlying MapFS
+type mockETagFs struct {
+	fstest.MapFS
+	eTags map[string]string
+}
+
+func (fsys *mockETagFs) ETag(name string) (string, error) {
+	eTag, ok := fsys.eTags[name]
+	if !ok {
+		return "", fs.ErrNotExist
+	}
+	return eTag, nil
+}
+
+// mockSnapshotFs swaps in the next version of the files right after a snapshot has been taken, like a concurrent reload
+type mockSnapshotFs struct {
+	*mockETagFs
+	next *mockETagFs
+}
+
+func (fsys *mockSnapshotFs) Snapshot() fs.FS {
+	snapshot := fsys.mockETagFs
+	fsys.mockETagFs = fsys.next
+	return snapshot
+}
+
+func getMockedETagFs() *mockETagFs {
+	return &mockETagFs{
+		MapFS: fstest.MapFS{"dummy_random.js": {Data: []byte(dummyResponse), ModTime: modTime}},
+		eTags: map[string]string{"dummy_random.js": eTag},
+	}
+}
+
+func TestCacheHandlerSnapshot(t *testing.T) {
+	reloaded := getMockedETagFs()
+	reloaded.MapFS["dummy_random.js"] = &fstest.MapFile{Data: []byte("reloaded"), ModTime: modTime}
+	reloaded.eTags["dummy_random.js"] = "def456"
+	fsys := &mockSnapshotFs{mockETagFs: getMockedETagFs(), next: reloaded}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/dummy_random.js", nil)
+	server.NewCacheHandler(server.FileServer(fsys), fsys).ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, quotedETag, w.Header().Get("ETag"))
+	require.Equal(t, dummyResponse, w.Body.String())
+}
+
 func TestEtagSetting(t *testing.T) {
-	path := "dummy_random.js"
 	w, r, next := getDefaultHandlerMocks()
 	next.serveHttpFunc = func(w http.ResponseWriter, r *http.Request) {
-		_, err := w.Write([]byte{}) // dummy write to trigger ETAg setting
+		_, err := w.Write([]byte(dummyResponse))
 		assert.NoError(t, err)
 	}
-	cacheHandler := server.NewCacheHandler(next)
-	r.URL = &url.URL{Path: path}
+	cacheHandler := server.NewCacheHandler(next, getMockedETagFs())
+	r.URL = &url.URL{Path: "/dummy_random.js"}
 	cacheHandler.ServeHTTP(w, r)
 	result := w.Result()
 	defer func() {
@@ -27,34 +81,27 @@ func TestEtagSetting(t *testing.T) {
 		require.NoError(t, err)
 	}()
 	require.Equal(t, http.StatusOK, result.StatusCode)
-	hash, ok := cacheHandler.Hashes.Load(path)
-	require.True(t, ok)
-	require.Equal(t, hash, w.Header().Get("ETag"))
+	require.Equal(t, quotedETag, result.Header.Get("ETag"))
+	require.Equal(t, modTime.Format(http.TimeFormat), result.Header.Get("Last-Modified"))
 }
-func TestNoEtagOnError(t *testing.T) {
-	path := "dummy_random.js"
+
+func TestNoEtagOnMissingFile(t *testing.T) {
 	w, r, next := getDefaultHandlerMocks()
 	next.serveHttpFunc = func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusAccepted)
-		_, err := w.Write([]byte{}) // dummy write to trigger ETAg setting
-		assert.NoError(t, err)
+		w.WriteHeader(http.StatusNotFound)
 	}
-	cacheHandler := server.NewCacheHandler(next)
-	r.URL = &url.URL{Path: path}
+	cacheHandler := server.NewCacheHandler(next, getMockedETagFs())
+	r.URL = &url.URL{Path: "/missing.js"}
 	cacheHandler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusNotFound, w.Code)
 	require.Empty(t, w.Header().Get("ETag"))
 }
 
 func TestNotModifiedResponse(t *testing.T) {
-	path := "dummy_random.js"
 	w, r, next := getDefaultHandlerMocks()
-	cacheHandler := server.NewCacheHandler(next)
-	r.URL = &url.URL{Path: path}
-	cacheHandler.ServeHTTP(w, r) // initial request to warm up the cache
-	hash, ok := cacheHandler.Hashes.Load(path)
-	require.True(t, ok)
-	r.Header.Set("If-None-Match", hash)
-	w, _, _ = getDefaultHandlerMocks()
+	cacheHandler := server.NewCacheHandler(next, getMockedETagFs())
+	r.URL = &url.URL{Path: "/dummy_random.js"}
+	r.Header.Set("If-None-Match", quotedETag)
 	cacheHandler.ServeHTTP(w, r)
 	result := w.Result()
 	defer func() {
@@ -62,4 +109,32 @@ func TestNotModifiedResponse(t *testing.T) {
 		require.NoError(t, err)
 	}()
 	require.Equal(t, http.StatusNotModified, result.StatusCode)
+	require.Nil(t, next.r)
+}
+
+// TestWeakEtagOnDynamicCompression tests that content compressed by following handlers receives a weak ETag
+func TestWeakEtagOnDynamicCompression(t *testing.T) {
+	w, r, next := getDefaultHandlerMocks()
+	next.serveHttpFunc = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		_, err := w.Write([]byte(dummyResponse))
+		assert.NoError(t, err)
+	}
+	cacheHandler := server.NewCacheHandler(next, getMockedETagFs())
+	r.URL = &url.URL{Path: "/dummy_random.js"}
+	cacheHandler.ServeHTTP(w, r)
+	require.Equal(t, "W/"+quotedETag, w.Header().Get("ETag"))
+
+	w, _, _ = getDefaultHandlerMocks()
+	r.Header.Set("If-None-Match", "W/"+quotedETag)
+	cacheHandler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusNotModified, w.Code)
+	require.Equal(t, "W/"+quotedETag, w.Header().Get("ETag"))
+
+	// the strong ETag is kept if the client also holds the uncompressed representation
+	w, _, _ = getDefaultHandlerMocks()
+	r.Header.Set("If-None-Match", "W/"+quotedETag+", "+quotedETag)
+	cacheHandler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusNotModified, w.Code)
+	require.Equal(t, quotedETag, w.Header().Get("ETag"))
 }
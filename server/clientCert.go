@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrInvalidClientAuthMode = errors.New("invalid client auth mode, only none, optional and required are valid")
+	ErrNoCertificates        = errors.New("no PEM encoded certificates found")
+)
+
+// ClientIdentityKey is the ContextKey under which the *ClientIdentity of a verified client certificate can be found
+var ClientIdentityKey = &ContextKey{val: "clientIdentity"}
+
+// ClientIdentity holds the identity of a verified TLS client certificate
+type ClientIdentity struct {
+	// Subject is the distinguished name of the certificate subject
+	Subject        string
+	CommonName     string
+	DNSNames       []string
+	EmailAddresses []string
+	URIs           []string
+}
+
+// GetClientIdentity returns the identity of the verified client certificate of the request, nil if there is none.
+func GetClientIdentity(r *http.Request) *ClientIdentity {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	identity := &ClientIdentity{
+		Subject:        cert.Subject.String(),
+		CommonName:     cert.Subject.CommonName,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		URIs:           make([]string, len(cert.URIs)),
+	}
+	for i, uri := range cert.URIs {
+		identity.URIs[i] = uri.String()
+	}
+	return identity
+}
+
+// ParseClientAuth converts the client auth mode none, optional or required to the tls.ClientAuthType.
+// Optional and required both verify presented client certificates.
+func ParseClientAuth(mode string) (tls.ClientAuthType, error) {
+	switch mode {
+	case "", "none":
+		return tls.NoClientCert, nil
+	case "optional":
+		return tls.VerifyClientCertIfGiven, nil
+	case "required":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("%w: %s", ErrInvalidClientAuthMode, mode)
+	}
+}
+
+// LoadCertPool reads the PEM encoded CA bundle file into a certificate pool
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%w: %s", ErrNoCertificates, file)
+	}
+	return pool, nil
+}
+
+// ClientCertRule restricts the paths with the Prefix to verified client certificates.
+// If Subjects or SANs are set, the certificate has to match at least one of them.
+type ClientCertRule struct {
+	Prefix string
+	// Subjects are compared against the common name and the distinguished name of the certificate subject
+	Subjects []string
+	// SANs are compared against the DNS, email and URI subject alternative names of the certificate
+	SANs []string
+}
+
+func (rule ClientCertRule) pathPrefix() string {
+	return rule.Prefix
+}
+
+// allows checks whether the client identity fulfills the rule
+func (rule *ClientCertRule) allows(identity *ClientIdentity) bool {
+	if identity == nil {
+		return false
+	}
+	if len(rule.Subjects) == 0 && len(rule.SANs) == 0 {
+		return true
+	}
+	if slices.Contains(rule.Subjects, identity.CommonName) || slices.Contains(rule.Subjects, identity.Subject) {
+		return true
+	}
+	for _, san := range rule.SANs {
+		if slices.Contains(identity.DNSNames, san) || slices.Contains(identity.EmailAddresses, san) || slices.Contains(identity.URIs, san) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientCertHandler adds the ClientIdentity of verified client certificates to the request context under the ClientIdentityKey.
+// Requests are rejected with 403 if the client certificate does not fulfill the rule with the longest matching prefix.
+func ClientCertHandler(next http.Handler, rules ...ClientCertRule) http.Handler {
+	rules = sortByPrefixLength(rules)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity := GetClientIdentity(r)
+		if rule, ok := longestPrefixMatch(rules, r.URL.Path); ok && !rule.allows(identity) {
+			log.Debug().Msgf("Client certificate %v not allowed for %s", identity, r.URL.Path)
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		if identity != nil {
+			r = r.WithContext(context.WithValue(r.Context(), ClientIdentityKey, identity))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
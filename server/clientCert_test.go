@@ -0,0 +1,142 @@
+package server_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/stretchr/testify/require"
+)
+
+var clientCertRules = []server.ClientCertRule{
+	{Prefix: "/admin/", Subjects: []string{"admin"}, SANs: []string{"ops.example.com"}},
+	{Prefix: "/internal/"},
+	{Prefix: "/admin/secure/", Subjects: []string{"root"}},
+}
+
+// getVerifiedConnectionState returns a TLS connection state with a verified client certificate
+func getVerifiedConnectionState(t *testing.T, commonName string, dnsNames ...string) *tls.ConnectionState {
+	certPEM, _ := generateCert(t, commonName, dnsNames...)
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+}
+
+func TestClientCert(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		tls    *tls.ConnectionState
+		status int
+	}{
+		{name: "unrestricted without cert", path: "/index.html", status: http.StatusOK},
+		{name: "restricted without cert", path: "/internal/a", status: http.StatusForbidden},
+		{name: "restricted directory without cert", path: "/internal", status: http.StatusForbidden},
+		{name: "restricted with any cert", path: "/internal/a", tls: getVerifiedConnectionState(t, "user"), status: http.StatusOK},
+		{name: "subject match", path: "/admin/a", tls: getVerifiedConnectionState(t, "admin"), status: http.StatusOK},
+		{name: "san match", path: "/admin/a", tls: getVerifiedConnectionState(t, "user", "ops.example.com"), status: http.StatusOK},
+		{name: "no match", path: "/admin/a", tls: getVerifiedConnectionState(t, "user", "dev.example.com"), status: http.StatusForbidden},
+		{name: "longest prefix match", path: "/admin/secure/a", tls: getVerifiedConnectionState(t, "root"), status: http.StatusOK},
+		{name: "longest prefix no match", path: "/admin/secure/a", tls: getVerifiedConnectionState(t, "admin"), status: http.StatusForbidden},
+		{name: "unverified cert", path: "/internal/a", tls: &tls.ConnectionState{}, status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, r, next := getDefaultHandlerMocks()
+			r.URL = &url.URL{Path: tt.path}
+			r.TLS = tt.tls
+			server.ClientCertHandler(next, clientCertRules...).ServeHTTP(w, r)
+			require.Equal(t, tt.status, w.Code)
+			if tt.status != http.StatusOK {
+				require.Nil(t, next.r)
+			}
+		})
+	}
+}
+
+func TestClientCertRewrite(t *testing.T) {
+	w, r, next := getDefaultHandlerMocks()
+	r.URL = &url.URL{Path: "/pub/a"}
+	rewriteHandler(t, next, server.ClientCert(clientCertRules...)).ServeHTTP(w, r)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Nil(t, next.r)
+
+	w, r, next = getDefaultHandlerMocks()
+	r.URL = &url.URL{Path: "/pub/a"}
+	r.TLS = getVerifiedConnectionState(t, "admin")
+	rewriteHandler(t, next, server.ClientCert(clientCertRules...)).ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "/admin/a", next.r.URL.Path)
+}
+
+func TestClientCertIdentityContext(t *testing.T) {
+	w, r, next := getDefaultHandlerMocks()
+	r.URL = &url.URL{Path: "/admin/a"}
+	r.TLS = getVerifiedConnectionState(t, "admin", "ops.example.com")
+	server.ClientCertHandler(next, clientCertRules...).ServeHTTP(w, r)
+	identity, ok := next.r.Context().Value(server.ClientIdentityKey).(*server.ClientIdentity)
+	require.True(t, ok)
+	require.Equal(t, "admin", identity.CommonName)
+	require.Equal(t, "CN=admin", identity.Subject)
+	require.Equal(t, []string{"ops.example.com"}, identity.DNSNames)
+}
+
+// TestClientAuthHandshake tests the client certificate verification against the CA bundle during the TLS handshake
+func TestClientAuthHandshake(t *testing.T) {
+	dir := t.TempDir()
+	clientCertFile, clientKeyFile := writeCert(t, dir, "client", "client")
+	pool, err := server.LoadCertPool(clientCertFile)
+	require.NoError(t, err)
+	clientAuth, err := server.ParseClientAuth("optional")
+	require.NoError(t, err)
+
+	srv := httptest.NewUnstartedServer(server.ClientCertHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := r.Context().Value(server.ClientIdentityKey).(*server.ClientIdentity)
+		if identity != nil {
+			_, _ = w.Write([]byte(identity.CommonName))
+		}
+	}), server.ClientCertRule{Prefix: "/admin/"}))
+	srv.TLS = &tls.Config{ClientAuth: clientAuth, ClientCAs: pool, MinVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL + "/admin/")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	clientCert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+	require.NoError(t, err)
+	serverCAs := x509.NewCertPool()
+	serverCAs.AddCert(srv.Certificate())
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      serverCAs,
+		Certificates: []tls.Certificate{clientCert},
+		MinVersion:   tls.VersionTLS12,
+	}}}
+	defer client.CloseIdleConnections()
+	resp, err = client.Get(srv.URL + "/admin/")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, resp.Body.Close())
+	}()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, []byte("client"), getReceivedData(t, resp.Body))
+}
+
+func TestLoadCertPoolInvalid(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(file, []byte("invalid"), 0o600))
+	_, err := server.LoadCertPool(file)
+	require.ErrorIs(t, err, server.ErrNoCertificates)
+	_, err = server.ParseClientAuth("maybe")
+	require.ErrorIs(t, err, server.ErrInvalidClientAuthMode)
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+var ClientIPKey = &ContextKey{val: "clientIP"}
+
+var ErrInvalidClientIPHeader = errors.New("invalid client ip header, only X-Forwarded-For, Forwarded and X-Real-IP are valid")
+
+// ClientIPResolver determines the client IP of a request. The forwarding header is only considered if the direct peer is one of
+// the trusted proxies, as it can be set arbitrarily by clients otherwise.
+type ClientIPResolver struct {
+	header         string
+	trustedProxies []netip.Prefix
+}
+
+// NewClientIPResolver parses the trusted proxy CIDRs like 10.0.0.0/8. Single IPs are treated as /32 respectively /128 networks.
+// The header is the one of X-Forwarded-For, Forwarded or X-Real-IP that the trusted proxies set, all other forwarding headers are
+// ignored as the proxies usually pass them through unchanged from the clients.
+func NewClientIPResolver(header string, trustedProxies ...string) (*ClientIPResolver, error) {
+	header = http.CanonicalHeaderKey(header)
+	if header != "X-Forwarded-For" && header != "Forwarded" && header != "X-Real-Ip" {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidClientIPHeader, header)
+	}
+	resolver := &ClientIPResolver{header: header, trustedProxies: make([]netip.Prefix, len(trustedProxies))}
+	for i, cidr := range trustedProxies {
+		prefix, err := parsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+		resolver.trustedProxies[i] = prefix
+	}
+	return resolver, nil
+}
+
+// parsePrefix parses a CIDR or a single IP
+func parsePrefix(cidr string) (netip.Prefix, error) {
+	if !strings.Contains(cidr, "/") {
+		addr, err := netip.ParseAddr(cidr)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid IP %s: %w", cidr, err)
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid CIDR %s: %w", cidr, err)
+	}
+	if prefix.Addr().Is4In6() {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+	return prefix.Masked(), nil
+}
+
+// isTrusted checks whether the address belongs to one of the trusted proxies
+func (resolver *ClientIPResolver) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range resolver.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the client IP of the request. If the direct peer is a trusted proxy the forwarding header of the resolver is evaluated
+// from right to left and the first address that is not a trusted proxy is returned. Returns an invalid address if the RemoteAddr cannot be parsed.
+func (resolver *ClientIPResolver) ClientIP(r *http.Request) netip.Addr {
+	remote := remoteAddr(r.RemoteAddr)
+	if !remote.IsValid() || !resolver.isTrusted(remote) {
+		return remote
+	}
+	var chain []string
+	switch resolver.header {
+	case "Forwarded":
+		chain = forwardedFor(r.Header.Values("Forwarded"))
+	case "X-Forwarded-For":
+		chain = commaSeparated(r.Header.Values("X-Forwarded-For"))
+	default:
+		if value := r.Header.Get("X-Real-IP"); value != "" {
+			chain = []string{value}
+		}
+	}
+	result := remote
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr := parseForwardedAddr(chain[i])
+		if !addr.IsValid() {
+			// malformed or obfuscated entries cannot be attributed, so the last valid hop is used
+			break
+		}
+		result = addr
+		if !resolver.isTrusted(addr) {
+			break
+		}
+	}
+	return result
+}
+
+// RealIPHandler resolves the client IP of the request via the resolver and stores it in the request context, see GetClientIP.
+// The RemoteAddr of the request is left untouched. It holds the source address of the PROXY protocol header if the listener uses it.
+func RealIPHandler(next http.Handler, resolver *ClientIPResolver) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), ClientIPKey, resolver.ClientIP(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// GetClientIP returns the client IP resolved by the RealIPHandler. Falls back to the RemoteAddr of the request if the handler has not been applied.
+func GetClientIP(r *http.Request) netip.Addr {
+	if addr, ok := r.Context().Value(ClientIPKey).(netip.Addr); ok {
+		return addr
+	}
+	return remoteAddr(r.RemoteAddr)
+}
+
+// isForwarded checks whether the client IP has been resolved from forwarding headers instead of the direct peer
+func isForwarded(r *http.Request) bool {
+	return GetClientIP(r) != remoteAddr(r.RemoteAddr)
+}
+
+// remoteAddr parses the ip:port RemoteAddr of a request
+func remoteAddr(addr string) netip.Addr {
+	if addrPort, err := netip.ParseAddrPort(addr); err == nil {
+		return addrPort.Addr().Unmap()
+	}
+	result, _ := netip.ParseAddr(addr)
+	return result.Unmap()
+}
+
+// commaSeparated splits and trims comma separated header values
+func commaSeparated(values []string) []string {
+	var result []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			result = append(result, strings.TrimSpace(element))
+		}
+	}
+	return result
+}
+
+// forwardedFor returns the for parameters of the RFC 7239 Forwarded header values in order
+func forwardedFor(values []string) []string {
+	var result []string
+	for _, element := range commaSeparated(values) {
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "for") {
+				result = append(result, strings.Trim(value, `"`))
+			}
+		}
+	}
+	return result
+}
+
+// parseForwardedAddr parses an IP with an optional port, IPv6 addresses may be enclosed in brackets
+func parseForwardedAddr(value string) netip.Addr {
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	addr, err := netip.ParseAddr(strings.Trim(value, "[]"))
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
@@ -0,0 +1,75 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientIP(t *testing.T) {
+	for _, testCase := range []struct {
+		name       string
+		header     string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{name: "direct", header: "X-Forwarded-For", remoteAddr: "198.51.100.7:1234", expected: "198.51.100.7"},
+		{name: "untrusted peer", header: "X-Forwarded-For", remoteAddr: "198.51.100.7:1234", headers: map[string]string{"X-Forwarded-For": "203.0.113.1"}, expected: "198.51.100.7"},
+		{name: "x-forwarded-for", header: "X-Forwarded-For", remoteAddr: "10.0.0.1:1234", headers: map[string]string{"X-Forwarded-For": "203.0.113.9, 203.0.113.1, 10.1.1.1"}, expected: "203.0.113.1"},
+		{name: "single trusted ip", header: "X-Forwarded-For", remoteAddr: "192.0.2.1:1234", headers: map[string]string{"X-Forwarded-For": "203.0.113.1"}, expected: "203.0.113.1"},
+		{name: "forwarded", header: "Forwarded", remoteAddr: "[2001:db8::1]:1234", headers: map[string]string{
+			"Forwarded":       `for=203.0.113.9, for="[2001:db8:cafe::17]:4711";proto=https, for="203.0.113.1:80";by=10.0.0.1`,
+			"X-Forwarded-For": "203.0.113.99",
+		}, expected: "203.0.113.1"},
+		{name: "forged forwarded", header: "X-Forwarded-For", remoteAddr: "10.0.0.1:1234", headers: map[string]string{
+			"Forwarded":       "for=192.0.2.77",
+			"X-Forwarded-For": "203.0.113.1",
+		}, expected: "203.0.113.1"},
+		{name: "x-real-ip", header: "X-Real-IP", remoteAddr: "10.0.0.1:1234", headers: map[string]string{"X-Real-IP": "203.0.113.1"}, expected: "203.0.113.1"},
+		{name: "other header", header: "X-Real-IP", remoteAddr: "10.0.0.1:1234", headers: map[string]string{"X-Forwarded-For": "203.0.113.1"}, expected: "10.0.0.1"},
+		{name: "only trusted", header: "X-Forwarded-For", remoteAddr: "10.0.0.1:1234", headers: map[string]string{"X-Forwarded-For": "10.0.0.2"}, expected: "10.0.0.2"},
+		{name: "obfuscated", header: "forwarded", remoteAddr: "10.0.0.1:1234", headers: map[string]string{"Forwarded": "for=_hidden, for=10.0.0.2"}, expected: "10.0.0.2"},
+	} {
+		resolver, err := server.NewClientIPResolver(testCase.header, "10.0.0.0/8", "192.0.2.1", "2001:db8::/32")
+		require.NoError(t, err)
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = testCase.remoteAddr
+		for key, value := range testCase.headers {
+			r.Header.Set(key, value)
+		}
+		require.Equal(t, testCase.expected, resolver.ClientIP(r).String(), testCase.name)
+	}
+}
+
+func TestRealIPHandler(t *testing.T) {
+	resolver, err := server.NewClientIPResolver("X-Forwarded-For", "10.0.0.0/8")
+	require.NoError(t, err)
+	var clientIP string
+	handler := server.RealIPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientIP = server.GetClientIP(r).String()
+	}), resolver)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "203.0.113.1")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	require.Equal(t, "203.0.113.1", clientIP)
+	require.Equal(t, "10.0.0.1:1234", r.RemoteAddr)
+	// without the handler the remote address is used
+	require.Equal(t, "10.0.0.1", server.GetClientIP(r).String())
+}
+
+func TestClientIPInvalidCIDR(t *testing.T) {
+	_, err := server.NewClientIPResolver("X-Forwarded-For", "10.0.0.0/33")
+	require.Error(t, err)
+	_, err = server.NewClientIPResolver("X-Forwarded-For", "proxy")
+	require.Error(t, err)
+}
+
+func TestClientIPInvalidHeader(t *testing.T) {
+	_, err := server.NewClientIPResolver("X-Client-IP", "10.0.0.0/8")
+	require.ErrorIs(t, err, server.ErrInvalidClientIPHeader)
+}
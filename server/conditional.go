@@ -0,0 +1,167 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// conditionalHeaders are the request headers that are evaluated by evaluatePreconditions
+var conditionalHeaders = []string{"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since", "If-Range"}
+
+// evaluatePreconditions evaluates the conditional request headers against the current eTag and modTime with the precedence of RFC 9110 section 13.2.2.
+// A zero modTime disables the date based conditions. Returns the status code that should be returned instead of the content, or 0 if the request should be served.
+// ignoreRange signals that a Range request has to be answered with the complete content, because the If-Range condition is not fulfilled.
+func evaluatePreconditions(r *http.Request, eTag string, modTime time.Time) (status int, ignoreRange bool) {
+	// an empty method means GET for client requests
+	isGet := r.Method == http.MethodGet || r.Method == ""
+	isGetOrHead := isGet || r.Method == http.MethodHead
+	modTime = modTime.Truncate(time.Second)
+
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		if !matchesETag(ifMatch, eTag, true) {
+			return http.StatusPreconditionFailed, false
+		}
+	} else if ifUnmodifiedSince, ok := parseHttpTime(r.Header.Get("If-Unmodified-Since")); ok && !modTime.IsZero() {
+		if modTime.After(ifUnmodifiedSince) {
+			return http.StatusPreconditionFailed, false
+		}
+	}
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if matchesETag(ifNoneMatch, eTag, false) {
+			if isGetOrHead {
+				return http.StatusNotModified, false
+			}
+			return http.StatusPreconditionFailed, false
+		}
+	} else if ifModifiedSince, ok := parseHttpTime(r.Header.Get("If-Modified-Since")); ok && isGetOrHead && !modTime.IsZero() {
+		if !modTime.After(ifModifiedSince) {
+			return http.StatusNotModified, false
+		}
+	}
+
+	if ifRange := r.Header.Get("If-Range"); ifRange != "" && isGet && r.Header.Get("Range") != "" {
+		return 0, !matchesIfRange(ifRange, eTag, modTime)
+	}
+	return 0, false
+}
+
+// matchesIfRange evaluates the If-Range header which holds either a strong ETag or an exact HTTP-date, see RFC 9110 section 13.1.5.
+func matchesIfRange(ifRange string, eTag string, modTime time.Time) bool {
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		entry, _ := scanETag(ifRange)
+		return entry != "" && strongETagMatch(entry, eTag)
+	}
+	ifRangeTime, ok := parseHttpTime(ifRange)
+	return ok && !modTime.IsZero() && modTime.Equal(ifRangeTime)
+}
+
+// matchesETag checks whether the eTag is contained in the list of the If-Match or If-None-Match header value. * matches every eTag.
+// strong selects the strong comparison function (If-Match), otherwise the weak one is used (If-None-Match), see RFC 9110 section 8.8.3.2.
+func matchesETag(headerValue string, eTag string, strong bool) bool {
+	if strings.TrimSpace(headerValue) == "*" {
+		return true
+	}
+	for remaining := headerValue; ; {
+		remaining = strings.TrimLeft(remaining, " \t,")
+		if remaining == "" {
+			return false
+		}
+		var entry string
+		entry, remaining = scanETag(remaining)
+		if entry == "" {
+			return false
+		}
+		if (strong && strongETagMatch(entry, eTag)) || (!strong && weakETagMatch(entry, eTag)) {
+			return true
+		}
+	}
+}
+
+// matchesWeakETagOnly checks whether the If-None-Match header value contains the weak version of the strong eTag but not the eTag itself
+func matchesWeakETagOnly(headerValue string, eTag string) bool {
+	weak := false
+	for remaining := headerValue; ; {
+		remaining = strings.TrimLeft(remaining, " \t,")
+		var entry string
+		entry, remaining = scanETag(remaining)
+		switch entry {
+		case "":
+			return weak
+		case eTag:
+			return false
+		case "W/" + eTag:
+			weak = true
+		}
+	}
+}
+
+// scanETag reads the leading ETag from s and returns it together with the unread remainder. Returns an empty ETag if s does not start with a valid one.
+func scanETag(s string) (eTag string, remaining string) {
+	start := 0
+	if strings.HasPrefix(s, "W/") {
+		start = 2
+	}
+	if len(s) <= start || s[start] != '"' {
+		return "", ""
+	}
+	for i := start + 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			return s[:i+1], s[i+1:]
+		// etagc = %x21 / %x23-7E / obs-text
+		case c == 0x21 || (c >= 0x23 && c != 0x7f):
+		default:
+			return "", ""
+		}
+	}
+	return "", ""
+}
+
+// strongETagMatch implements the strong comparison, both ETags have to be strong and identical.
+func strongETagMatch(a string, b string) bool {
+	return a == b && !strings.HasPrefix(a, "W/")
+}
+
+// weakETagMatch implements the weak comparison, the opaque tags have to be identical irrespective of their weakness.
+func weakETagMatch(a string, b string) bool {
+	return trimWeak(a) == trimWeak(b)
+}
+
+// quoteETag makes sure that the ETag is a quoted string as required by RFC 9110 section 8.8.3.
+func quoteETag(eTag string) string {
+	if strings.HasPrefix(trimWeak(eTag), `"`) {
+		return eTag
+	}
+	return `"` + eTag + `"`
+}
+
+// parseHttpTime parses the HTTP-date, ok is false for empty or invalid values
+func parseHttpTime(value string) (t time.Time, ok bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	t, err := http.ParseTime(value)
+	return t, err == nil
+}
+
+// withoutPreconditions returns a shallow copy of the request without the already evaluated conditional headers.
+// The Range header is also removed if ignoreRange is set.
+func withoutPreconditions(r *http.Request, ignoreRange bool) *http.Request {
+	hasConditionalHeader := ignoreRange
+	for _, header := range conditionalHeaders {
+		hasConditionalHeader = hasConditionalHeader || r.Header.Get(header) != ""
+	}
+	if !hasConditionalHeader {
+		return r
+	}
+	result := r.Clone(r.Context())
+	for _, header := range conditionalHeaders {
+		result.Header.Del(header)
+	}
+	if ignoreRange {
+		result.Header.Del("Range")
+	}
+	return result
+}
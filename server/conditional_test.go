@@ -0,0 +1,97 @@
+package server_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	before := modTime.Add(-time.Hour).Format(http.TimeFormat)
+	after := modTime.Add(time.Hour).Format(http.TimeFormat)
+	exact := modTime.Format(http.TimeFormat)
+	tests := []struct {
+		name           string
+		method         string
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{"no conditions", http.MethodGet, nil, http.StatusOK},
+		{"if-none-match list", http.MethodGet, map[string]string{"If-None-Match": `"a,b", ` + quotedETag}, http.StatusNotModified},
+		{"if-none-match mismatch", http.MethodGet, map[string]string{"If-None-Match": `"other"`}, http.StatusOK},
+		{"if-none-match wildcard", http.MethodGet, map[string]string{"If-None-Match": "*"}, http.StatusNotModified},
+		{"if-none-match weak", http.MethodHead, map[string]string{"If-None-Match": "W/" + quotedETag}, http.StatusNotModified},
+		{"if-none-match unquoted", http.MethodGet, map[string]string{"If-None-Match": eTag}, http.StatusOK},
+		{"if-none-match non-get", http.MethodPost, map[string]string{"If-None-Match": quotedETag}, http.StatusPreconditionFailed},
+		{"if-match", http.MethodGet, map[string]string{"If-Match": `"other", ` + quotedETag}, http.StatusOK},
+		{"if-match mismatch", http.MethodGet, map[string]string{"If-Match": `"other"`}, http.StatusPreconditionFailed},
+		{"if-match weak", http.MethodGet, map[string]string{"If-Match": "W/" + quotedETag}, http.StatusPreconditionFailed},
+		{"if-match wildcard", http.MethodGet, map[string]string{"If-Match": "*"}, http.StatusOK},
+		{"if-match precedence", http.MethodGet, map[string]string{"If-Match": quotedETag, "If-Unmodified-Since": before}, http.StatusOK},
+		{"if-unmodified-since", http.MethodGet, map[string]string{"If-Unmodified-Since": exact}, http.StatusOK},
+		{"if-unmodified-since modified", http.MethodGet, map[string]string{"If-Unmodified-Since": before}, http.StatusPreconditionFailed},
+		{"if-modified-since", http.MethodGet, map[string]string{"If-Modified-Since": after}, http.StatusNotModified},
+		{"if-modified-since modified", http.MethodGet, map[string]string{"If-Modified-Since": before}, http.StatusOK},
+		{"if-modified-since invalid", http.MethodGet, map[string]string{"If-Modified-Since": "yesterday"}, http.StatusOK},
+		{"if-none-match precedence", http.MethodGet, map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": after}, http.StatusOK},
+		{"if-match before if-none-match", http.MethodGet, map[string]string{"If-Match": `"other"`, "If-None-Match": quotedETag}, http.StatusPreconditionFailed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w, r, next := getDefaultHandlerMocks()
+			handler := server.NewCacheHandler(next, getMockedETagFs())
+			r.Method = test.method
+			r.URL = &url.URL{Path: "/dummy_random.js"}
+			for k, v := range test.headers {
+				r.Header.Set(k, v)
+			}
+			handler.ServeHTTP(w, r)
+			require.Equal(t, test.expectedStatus, w.Code)
+			expectedETag := quotedETag
+			if test.headers["If-None-Match"] == "W/"+quotedETag {
+				// the client holds a dynamically compressed representation
+				expectedETag = "W/" + quotedETag
+			}
+			require.Equal(t, expectedETag, w.Header().Get("ETag"))
+			if test.expectedStatus == http.StatusOK {
+				require.NotNil(t, next.r)
+				for _, header := range []string{"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"} {
+					require.Empty(t, next.r.Header.Get(header))
+				}
+			} else {
+				require.Nil(t, next.r)
+			}
+		})
+	}
+}
+
+func TestConditionalIfRange(t *testing.T) {
+	tests := []struct {
+		name          string
+		ifRange       string
+		expectedRange string
+	}{
+		{"etag match", quotedETag, "bytes=0-1"},
+		{"etag mismatch", `"other"`, ""},
+		{"weak etag", "W/" + quotedETag, ""},
+		{"date match", modTime.Format(http.TimeFormat), "bytes=0-1"},
+		{"date mismatch", modTime.Add(time.Hour).Format(http.TimeFormat), ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w, r, next := getDefaultHandlerMocks()
+			handler := server.NewCacheHandler(next, getMockedETagFs())
+			r.Method = http.MethodGet
+			r.URL = &url.URL{Path: "/dummy_random.js"}
+			r.Header.Set("Range", "bytes=0-1")
+			r.Header.Set("If-Range", test.ifRange)
+			handler.ServeHTTP(w, r)
+			require.Equal(t, test.expectedRange, next.r.Header.Get("Range"))
+			require.Empty(t, next.r.Header.Get("If-Range"))
+		})
+	}
+}
@@ -138,6 +138,14 @@ func (handler *CspFileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// Reset drops all cached templates, e.g. after the underlying files have changed.
+func (handler *CspFileHandler) Reset() {
+	handler.replacer.Range(func(key string, _ *ReplacerCollection) bool {
+		handler.replacer.Delete(key)
+		return true
+	})
+}
+
 // getSessionId extract the session id from the request context. Returns an empty string if it is not set.
 func getSessionId(r *http.Request) string {
 	sessionId := r.Context().Value(SessionIdKey)
@@ -43,6 +43,27 @@ func TestCspFileReplaceSessionMissing(t *testing.T) {
 	requireReplacedWith(t, "", string(getReceivedData(t, result.Body)))
 }
 
+// TestCspFileReplaceReset tests that the template is reloaded from the next handler after a reset
+func TestCspFileReplaceReset(t *testing.T) {
+	handler, w, r := getMockedCspFileHandler()
+	handler.ServeHTTP(w, r)
+	next, ok := handler.Next.(*mockHandler)
+	require.True(t, ok)
+	next.serveHttpFunc = func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write([]byte("changed"))
+		require.NoError(t, err)
+	}
+	handler.Reset()
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	result := w.Result()
+	defer func() {
+		err := result.Body.Close()
+		require.NoError(t, err)
+	}()
+	require.Equal(t, "changed", string(getReceivedData(t, result.Body)))
+}
+
 func TestCspHeaderReplace(t *testing.T) {
 	handler, w, r := getMockedCspHeaderHandler()
 	w.Header().Set(server.CspHeaderName, "test"+variableName+"456")
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+)
+
+// acceptedEncoding is a single entry of the Accept-Encoding HTTP-Header
+type acceptedEncoding struct {
+	name    string
+	quality float64
+}
+
+// NegotiateEncoding returns the content encoding that is preferred by the client according to the q-values of the acceptEncoding
+// HTTP-Header value. Only the available encodings are considered, their order is used as server preference when the client q-values are equal.
+// Returns an empty string if no available encoding is acceptable, in this case the identity encoding should be used.
+func NegotiateEncoding(acceptEncoding string, available ...string) string {
+	accepted := parseAcceptEncoding(acceptEncoding)
+	best := ""
+	bestQuality := 0.
+	for _, encoding := range available {
+		quality := encodingQuality(accepted, encoding)
+		if quality > bestQuality {
+			best = encoding
+			bestQuality = quality
+		}
+	}
+	return best
+}
+
+// encodingQuality returns the q-value for the encoding. Explicit entries take precedence over the * wildcard.
+func encodingQuality(accepted []acceptedEncoding, encoding string) float64 {
+	wildcard := 0.
+	for _, entry := range accepted {
+		if strings.EqualFold(entry.name, encoding) {
+			return entry.quality
+		}
+		if entry.name == "*" {
+			wildcard = entry.quality
+		}
+	}
+	return wildcard
+}
+
+// parseAcceptEncoding splits the Accept-Encoding HTTP-Header value into its entries and q-values. Malformed q-values are treated as 0.
+func parseAcceptEncoding(acceptEncoding string) []acceptedEncoding {
+	entries := strings.Split(acceptEncoding, ",")
+	result := make([]acceptedEncoding, 0, len(entries))
+	for _, entry := range entries {
+		name, params, _ := strings.Cut(entry, ";")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		quality := 1.
+		for _, param := range strings.Split(params, ";") {
+			key, val, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(key), "q") {
+				var err error
+				quality, err = strconv.ParseFloat(strings.TrimSpace(val), 64)
+				if err != nil {
+					quality = 0
+				}
+			}
+		}
+		result = append(result, acceptedEncoding{name: name, quality: quality})
+	}
+	return result
+}
@@ -0,0 +1,21 @@
+package server_test
+
+import (
+	"testing"
+
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	available := []string{"br", "zstd", "gzip"}
+	require.Equal(t, "br", server.NegotiateEncoding("gzip, deflate, br, zstd", available...))
+	require.Equal(t, "gzip", server.NegotiateEncoding("gzip", available...))
+	require.Equal(t, "zstd", server.NegotiateEncoding("gzip;q=0.5, zstd, br;q=0.8", available...))
+	require.Equal(t, "gzip", server.NegotiateEncoding("*;q=0.1, gzip;q=0.2", available...))
+	require.Equal(t, "br", server.NegotiateEncoding("*", available...))
+	require.Equal(t, "zstd", server.NegotiateEncoding("*, br;q=0", available...))
+	require.Empty(t, server.NegotiateEncoding("gzip;q=0, deflate", available...))
+	require.Empty(t, server.NegotiateEncoding("gzip;q=abc", available...))
+	require.Empty(t, server.NegotiateEncoding("", available...))
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/ngergs/websrv/v5/internal/utils"
+)
+
+// watchFiles calls reload once no further change of the files has been observed for the debounce duration till the context is cancelled.
+// The directories of the files are watched, so the atomic symlink swaps of Kubernetes volumes are also picked up. The name is used for logging.
+func watchFiles(ctx context.Context, name string, debounce time.Duration, reload func() error, files ...string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error setting up %s watcher: %w", name, err)
+	}
+	var dirs []string
+	for _, file := range files {
+		if dir := filepath.Dir(file); !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			utils.Close(ctx, watcher)
+			return fmt.Errorf("error watching %s directory %s: %w", name, dir, err)
+		}
+	}
+	go utils.WatchDebounced(ctx, name, watcher, debounce, reload)
+	return nil
+}
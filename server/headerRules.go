@@ -0,0 +1,77 @@
+package server
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// HeaderRule modifies the HTTP response headers for all requests that match the path Matcher and (if set) one of the MediaTypes.
+type HeaderRule struct {
+	Matcher *PathMatcher
+	// MediaTypes are compared against the response Content-Type, wildcards like font/* are supported. Empty matches all media types.
+	MediaTypes []string
+	// Set overwrites the given HTTP headers
+	Set map[string]string
+	// Append adds the given HTTP header values to already present ones
+	Append map[string]string
+	// Delete removes the given HTTP headers
+	Delete []string
+}
+
+// HeaderRulesHandler applies all matching rules in the given order to the HTTP response headers. The order of operation per rule is delete, set, append.
+// The rules are applied right before the headers are sent, so headers (including the Content-Type) from the following handlers are visible to them.
+func HeaderRulesHandler(next http.Handler, rules ...HeaderRule) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the path can be modified by following handlers, e.g. fallback routing, we match the original one
+		requestPath := r.URL.Path
+		wrappedW := beforeWriteHeader(w, func(int) {
+			for _, rule := range rules {
+				if rule.matches(requestPath, w.Header().Get("Content-Type")) {
+					rule.apply(w.Header())
+				}
+			}
+		})
+		next.ServeHTTP(wrappedW, r)
+	})
+}
+
+// matches checks the path and media type conditions of the rule
+func (rule *HeaderRule) matches(requestPath string, contentType string) bool {
+	if !rule.Matcher.Matches(requestPath) {
+		return false
+	}
+	if len(rule.MediaTypes) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, expected := range rule.MediaTypes {
+		if matchesMediaType(expected, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply executes the header operations of the rule
+func (rule *HeaderRule) apply(header http.Header) {
+	for _, key := range rule.Delete {
+		header.Del(key)
+	}
+	for key, val := range rule.Set {
+		header.Set(key, val)
+	}
+	for key, val := range rule.Append {
+		header.Add(key, val)
+	}
+}
+
+// matchesMediaType compares the media types case-insensitive, the expected media type supports wildcards like font/* or */*.
+func matchesMediaType(expected string, mediaType string) bool {
+	expectedType, expectedSubtype, _ := strings.Cut(strings.ToLower(expected), "/")
+	actualType, actualSubtype, _ := strings.Cut(mediaType, "/")
+	return (expectedType == "*" || expectedType == actualType) && (expectedSubtype == "*" || expectedSubtype == actualSubtype)
+}
@@ -0,0 +1,60 @@
+package server_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/stretchr/testify/require"
+)
+
+func getHeaderRules(t *testing.T) []server.HeaderRule {
+	fontMatcher, err := server.NewPathMatcher(server.PathMatch{Prefix: "/fonts/"})
+	require.NoError(t, err)
+	allMatcher, err := server.NewPathMatcher(server.PathMatch{})
+	require.NoError(t, err)
+	return []server.HeaderRule{
+		{Matcher: fontMatcher, Set: map[string]string{"Cross-Origin-Resource-Policy": "cross-origin"}},
+		{Matcher: allMatcher, MediaTypes: []string{"font/*"}, Append: map[string]string{"Vary": "Origin"}, Delete: []string{"X-Frame-Options"}},
+	}
+}
+
+func TestHeaderRules(t *testing.T) {
+	w, r, next := getDefaultHandlerMocks()
+	next.serveHttpFunc = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "font/woff2")
+		w.Header().Set("Vary", "Accept-Encoding")
+		w.WriteHeader(http.StatusOK)
+	}
+	w.Header().Set("X-Frame-Options", "deny")
+	r.URL = &url.URL{Path: "/fonts/roboto.woff2"}
+	server.HeaderRulesHandler(next, getHeaderRules(t)...).ServeHTTP(w, r)
+	result := w.Result()
+	defer func() {
+		err := result.Body.Close()
+		require.NoError(t, err)
+	}()
+	require.Equal(t, "cross-origin", result.Header.Get("Cross-Origin-Resource-Policy"))
+	require.Equal(t, []string{"Accept-Encoding", "Origin"}, result.Header.Values("Vary"))
+	require.Empty(t, result.Header.Get("X-Frame-Options"))
+}
+
+func TestHeaderRulesNoMatch(t *testing.T) {
+	w, r, next := getDefaultHandlerMocks()
+	next.serveHttpFunc = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, err := w.Write([]byte(dummyResponse))
+		require.NoError(t, err)
+	}
+	w.Header().Set("X-Frame-Options", "deny")
+	r.URL = &url.URL{Path: "/index.html"}
+	server.HeaderRulesHandler(next, getHeaderRules(t)...).ServeHTTP(w, r)
+	result := w.Result()
+	defer func() {
+		err := result.Body.Close()
+		require.NoError(t, err)
+	}()
+	require.Empty(t, result.Header.Get("Cross-Origin-Resource-Policy"))
+	require.Equal(t, "deny", result.Header.Get("X-Frame-Options"))
+}
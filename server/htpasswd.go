@@ -0,0 +1,145 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1" //nolint:gosec // required for the {SHA} htpasswd scheme
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrUnsupportedPasswordHash = errors.New("unsupported password hash, only bcrypt, {SHA} and argon2i/argon2id are supported")
+
+// passwordHash verifies passwords against a stored hash
+type passwordHash interface {
+	verify(password []byte) bool
+}
+
+// bcryptHash is a $2a$, $2b$ or $2y$ bcrypt hash
+type bcryptHash []byte
+
+func (hash bcryptHash) verify(password []byte) bool {
+	return bcrypt.CompareHashAndPassword(hash, password) == nil
+}
+
+// shaHash is the SHA-1 digest of the {SHA} scheme
+type shaHash []byte
+
+func (hash shaHash) verify(password []byte) bool {
+	digest := sha1.Sum(password) //nolint:gosec // required for the {SHA} htpasswd scheme
+	return subtle.ConstantTimeCompare(hash, digest[:]) == 1
+}
+
+// argon2Hash is an argon2i or argon2id hash in the PHC string format, e.g. $argon2id$v=19$m=65536,t=3,p=4$salt$key
+type argon2Hash struct {
+	id      bool
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func (hash *argon2Hash) verify(password []byte) bool {
+	var key []byte
+	keyLen := uint32(len(hash.key)) //nolint:gosec // the key length is bounded by the htpasswd line length
+	if hash.id {
+		key = argon2.IDKey(password, hash.salt, hash.time, hash.memory, hash.threads, keyLen)
+	} else {
+		key = argon2.Key(password, hash.salt, hash.time, hash.memory, hash.threads, keyLen)
+	}
+	return subtle.ConstantTimeCompare(hash.key, key) == 1
+}
+
+// parseArgon2Hash parses the PHC string format of argon2 hashes
+func parseArgon2Hash(value string) (*argon2Hash, error) {
+	parts := strings.Split(value, "$")
+	if len(parts) != 6 || (parts[1] != "argon2id" && parts[1] != "argon2i") {
+		return nil, ErrUnsupportedPasswordHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("%w: argon2 version %s", ErrUnsupportedPasswordHash, parts[2])
+	}
+	hash := &argon2Hash{id: parts[1] == "argon2id"}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &hash.memory, &hash.time, &hash.threads); err != nil {
+		return nil, fmt.Errorf("invalid argon2 parameters %s: %w", parts[3], err)
+	}
+	var err error
+	if hash.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("invalid argon2 salt: %w", err)
+	}
+	if hash.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, fmt.Errorf("invalid argon2 key: %w", err)
+	}
+	// argon2 panics for these parameters, see argon2.IDKey
+	switch {
+	case len(hash.salt) == 0:
+		return nil, errors.New("invalid argon2 hash: empty salt")
+	case len(hash.key) == 0:
+		return nil, errors.New("invalid argon2 hash: empty key")
+	case hash.time < 1 || hash.threads < 1 || hash.memory < 8*uint32(hash.threads):
+		return nil, fmt.Errorf("invalid argon2 parameters %s: t and p have to be at least 1 and m at least 8*p", parts[3])
+	}
+	return hash, nil
+}
+
+// parsePasswordHash detects the scheme of the htpasswd hash
+func parsePasswordHash(value string) (passwordHash, error) {
+	switch {
+	case strings.HasPrefix(value, "$2a$") || strings.HasPrefix(value, "$2b$") || strings.HasPrefix(value, "$2y$"):
+		if _, err := bcrypt.Cost([]byte(value)); err != nil {
+			return nil, fmt.Errorf("invalid bcrypt hash: %w", err)
+		}
+		return bcryptHash(value), nil
+	case strings.HasPrefix(value, "{SHA}"):
+		digest, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, "{SHA}"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid {SHA} hash: %w", err)
+		}
+		if len(digest) != sha1.Size {
+			return nil, fmt.Errorf("invalid {SHA} hash length %d", len(digest))
+		}
+		return shaHash(digest), nil
+	case strings.HasPrefix(value, "$argon2"):
+		return parseArgon2Hash(value)
+	default:
+		return nil, ErrUnsupportedPasswordHash
+	}
+}
+
+// readHtpasswd reads the user:hash lines of the htpasswd file. Empty lines and lines starting with # are ignored.
+func readHtpasswd(file string) (map[string]passwordHash, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading htpasswd file %s: %w", file, err)
+	}
+	result := make(map[string]passwordHash)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, value, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("invalid htpasswd line %d in %s", lineNumber, file)
+		}
+		hash, err := parsePasswordHash(value)
+		if err != nil {
+			return nil, fmt.Errorf("htpasswd line %d in %s: %w", lineNumber, file, err)
+		}
+		result[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading htpasswd file %s: %w", file, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,98 @@
+package server_test
+
+import (
+	"context"
+	"crypto/sha1" //nolint:gosec // required for the {SHA} htpasswd scheme
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// htpasswdLine returns a htpasswd line for the user with the password hashed by the scheme bcrypt, sha, argon2i or argon2id
+func htpasswdLine(t *testing.T, scheme string, user string, password string) string {
+	salt := []byte("0123456789abcdef")
+	switch scheme {
+	case "bcrypt":
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		require.NoError(t, err)
+		return user + ":" + string(hash)
+	case "sha":
+		digest := sha1.Sum([]byte(password)) //nolint:gosec // required for the {SHA} htpasswd scheme
+		return user + ":{SHA}" + base64.StdEncoding.EncodeToString(digest[:])
+	case "argon2i":
+		key := argon2.Key([]byte(password), salt, 1, 64, 1, 32)
+		return fmt.Sprintf("%s:$argon2i$v=19$m=64,t=1,p=1$%s$%s", user, base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+	case "argon2id":
+		key := argon2.IDKey([]byte(password), salt, 1, 64, 1, 32)
+		return fmt.Sprintf("%s:$argon2id$v=19$m=64,t=1,p=1$%s$%s", user, base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+	default:
+		t.Fatalf("unknown scheme %s", scheme)
+		return ""
+	}
+}
+
+func writeHtpasswd(t *testing.T, file string, lines ...string) {
+	var content string
+	for _, line := range lines {
+		content += line + "\n"
+	}
+	require.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+}
+
+func TestHtpasswdInvalid(t *testing.T) {
+	file := filepath.Join(t.TempDir(), ".htpasswd")
+	for _, line := range []string{
+		"user:$apr1$salt$hash",
+		"user:plaintext",
+		"user:{SHA}aGVsbG8=",
+		"user:$2y$05$invalid",
+		"user:$argon2id$v=16$m=64,t=1,p=1$c2FsdA$a2V5",
+		"user:$argon2id$v=19$m=64$c2FsdA$a2V5",
+		"missing-colon",
+	} {
+		writeHtpasswd(t, file, line)
+		_, err := server.NewBasicAuthenticator(context.Background(), file, time.Second, 0, time.Minute)
+		require.Error(t, err, line)
+	}
+	_, err := server.NewBasicAuthenticator(context.Background(), filepath.Join(t.TempDir(), "missing"), time.Second, 0, time.Minute)
+	require.Error(t, err)
+}
+
+func TestHtpasswdInvalidArgon2(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "empty key", line: "user:$argon2id$v=19$m=65536,t=3,p=4$c2FsdHNhbHQ$"},
+		{name: "empty salt", line: "user:$argon2id$v=19$m=65536,t=3,p=4$$a2V5a2V5"},
+		{name: "zero time", line: "user:$argon2id$v=19$m=65536,t=0,p=4$c2FsdHNhbHQ$a2V5a2V5"},
+		{name: "zero threads", line: "user:$argon2i$v=19$m=65536,t=3,p=0$c2FsdHNhbHQ$a2V5a2V5"},
+		{name: "memory below 8*p", line: "user:$argon2id$v=19$m=31,t=3,p=4$c2FsdHNhbHQ$a2V5a2V5"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), ".htpasswd")
+			writeHtpasswd(t, file, test.line)
+			_, err := server.NewBasicAuthenticator(context.Background(), file, time.Second, 0, time.Minute)
+			require.Error(t, err)
+
+			// the previous users are kept if the reload fails
+			writeHtpasswd(t, file, htpasswdLine(t, "argon2id", "user", "secret"))
+			auth, err := server.NewBasicAuthenticator(context.Background(), file, time.Hour, 0, time.Minute, server.BasicAuthRule{})
+			require.NoError(t, err)
+			writeHtpasswd(t, file, test.line)
+			require.Error(t, auth.Reload())
+			handler := server.BasicAuthHandler(userHandler, auth)
+			require.Equal(t, http.StatusOK, basicAuthRequest(handler, "/", "user", "secret").Code)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// HTTP3Server is a HTTP/3 server that listens for QUIC connections on UDP
+type HTTP3Server struct {
+	*http3.Server
+}
+
+// ListenGoServe is the HTTP/3 counterpart of Server.ListenGoServe.
+// This blocks till the UDP socket is bound, the actual Serve of the http3.Server is done in a separate (automatically spawned) goroutine.
+// All errors (including http.ErrServerClosed) are returned via the error channel.
+func (s *HTTP3Server) ListenGoServe(ctx context.Context, errChan chan<- error) {
+	lc := net.ListenConfig{}
+	conn, err := lc.ListenPacket(ctx, "udp", s.Addr)
+	if err != nil {
+		errChan <- err
+		return
+	}
+	go func() {
+		// closing the http3.Server does not close the UDP socket
+		defer func() { _ = conn.Close() }()
+		errChan <- s.Serve(conn)
+	}()
+}
+
+// BuildHTTP3 builds a HTTP/3 server from the provided options, the TLS configuration is required for QUIC.
+// idleTimeout closes connections without HTTP/3 activity, handshakeTimeout bounds the QUIC handshake.
+func BuildHTTP3(port uint16, tlsConfig *tls.Config, idleTimeout time.Duration, handshakeTimeout time.Duration,
+	handler http.Handler, handlerSetups ...HandlerMiddleware) *HTTP3Server {
+	for _, handlerSetup := range handlerSetups {
+		handler = handlerSetup(handler)
+	}
+	return &HTTP3Server{
+		&http3.Server{
+			Addr:        ":" + strconv.FormatUint(uint64(port), 10),
+			TLSConfig:   tlsConfig,
+			Handler:     handler,
+			IdleTimeout: idleTimeout,
+			QUICConfig: &quic.Config{
+				HandshakeIdleTimeout: handshakeTimeout,
+				MaxIdleTimeout:       idleTimeout,
+			},
+		},
+	}
+}
@@ -0,0 +1,62 @@
+package server_test
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/require"
+)
+
+// unusedUDPPort returns a local UDP port that is currently not bound
+func unusedUDPPort(t *testing.T) uint16 {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	udpAddr, ok := conn.LocalAddr().(*net.UDPAddr)
+	require.True(t, ok)
+	require.NoError(t, conn.Close())
+	return uint16(udpAddr.Port) //nolint:gosec // valid port number
+}
+
+func TestHTTP3Server(t *testing.T) {
+	certPEM, keyPEM := generateCert(t, "localhost", "localhost")
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	port := unusedUDPPort(t)
+	srv := server.BuildHTTP3(port, &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS13}, time.Second, time.Second,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.Proto))
+		}), server.HTTP3(port))
+	errChan := make(chan error, 1)
+	srv.ListenGoServe(context.Background(), errChan)
+
+	transport := &http3.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true, MinVersion: tls.VersionTLS13}} //nolint:gosec // self-signed test certificate
+	defer func() { _ = transport.Close() }()
+	resp, err := (&http.Client{Transport: transport}).Get("https://localhost:" + strconv.Itoa(int(port)) + "/")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, "HTTP/3.0", string(body))
+	require.Equal(t, "h3=\":"+strconv.Itoa(int(port))+"\"", resp.Header.Get("Alt-Svc"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, srv.Shutdown(ctx))
+	require.ErrorIs(t, <-errChan, http.ErrServerClosed)
+}
+
+func TestAltSvcHeaders(t *testing.T) {
+	w := httptest.NewRecorder()
+	handler := server.H2C(8081)(server.HTTP3(443)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, []string{"h2=\":8081\"", "h3=\":443\""}, w.Header().Values("Alt-Svc"))
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AcmeChallengePath is the path prefix of the ACME HTTP-01 challenges, see RFC 8555 section 8.3
+const AcmeChallengePath = "/.well-known/acme-challenge/"
+
+// defaultHTTPSPort is omitted from the redirect location
+const defaultHTTPSPort = 443
+
+// HTTPSRedirectHandler permanently redirects (308) all requests to https with the same host and path on the given httpsPort.
+// ACME HTTP-01 challenge requests are passed to the acmeHandler instead, nil answers them with 404.
+func HTTPSRedirectHandler(httpsPort uint16, acmeHandler http.Handler) http.Handler {
+	if acmeHandler == nil {
+		acmeHandler = http.NotFoundHandler()
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, AcmeChallengePath) {
+			acmeHandler.ServeHTTP(w, r)
+			return
+		}
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			// bracketed IPv6 literal without port
+			host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		}
+		if httpsPort != defaultHTTPSPort {
+			host = net.JoinHostPort(host, strconv.FormatUint(uint64(httpsPort), 10))
+		} else if strings.Contains(host, ":") {
+			// IPv6 literal
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,48 @@
+package server_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		name     string
+		port     uint16
+		host     string
+		location string
+	}{
+		{name: "default port", port: 443, host: "example.com:80", location: "https://example.com/a/b?c=d"},
+		{name: "custom port", port: 8443, host: "example.com", location: "https://example.com:8443/a/b?c=d"},
+		{name: "ipv6", port: 443, host: "[::1]:80", location: "https://[::1]/a/b?c=d"},
+		{name: "ipv6 without port", port: 443, host: "[::1]", location: "https://[::1]/a/b?c=d"},
+		{name: "ipv6 without port custom port", port: 8443, host: "[::1]", location: "https://[::1]:8443/a/b?c=d"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, r, _ := getDefaultHandlerMocks()
+			r.Host = tt.host
+			r.URL = &url.URL{Path: "/a/b", RawQuery: "c=d"}
+			server.HTTPSRedirectHandler(tt.port, nil).ServeHTTP(w, r)
+			require.Equal(t, http.StatusPermanentRedirect, w.Code)
+			require.Equal(t, tt.location, w.Header().Get("Location"))
+		})
+	}
+}
+
+func TestHTTPSRedirectAcmeChallenge(t *testing.T) {
+	w, r, next := getDefaultHandlerMocks()
+	r.Host = "example.com"
+	r.URL = &url.URL{Path: server.AcmeChallengePath + "token"}
+	server.HTTPSRedirectHandler(443, next).ServeHTTP(w, r)
+	require.Equal(t, r, next.r)
+	require.Empty(t, w.Header().Get("Location"))
+
+	w, _, _ = getDefaultHandlerMocks()
+	server.HTTPSRedirectHandler(443, nil).ServeHTTP(w, r)
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
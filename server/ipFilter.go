@@ -0,0 +1,186 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var DecisionLabel = "decision"
+
+// IPFilterRule restricts the requests with the path Prefix by the client IP, see GetClientIP.
+// Denied IPs are rejected first, if any allowed IPs are configured all other IPs are rejected as well.
+type IPFilterRule struct {
+	// Prefix is a path prefix like /internal/, empty for all paths
+	Prefix string
+	// Allow are CIDRs or single IPs that are allowed
+	Allow []string
+	// Deny are CIDRs or single IPs that are rejected
+	Deny []string
+	// AllowFile holds additional allowed CIDRs, one per line. Empty lines and lines starting with # are ignored.
+	AllowFile string
+	// DenyFile holds additional denied CIDRs in the same format as the AllowFile
+	DenyFile string
+}
+
+func (rule IPFilterRule) pathPrefix() string {
+	return rule.Prefix
+}
+
+// ipLists are the parsed allow and deny lists of a rule
+type ipLists struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// ipFilterRule is a compiled IPFilterRule
+type ipFilterRule struct {
+	IPFilterRule
+	lists atomic.Pointer[ipLists]
+}
+
+// IPFilterRules holds the compiled rules, the lists from files are reloaded on changes
+type IPFilterRules struct {
+	// rules are sorted by descending prefix length
+	rules []*ipFilterRule
+}
+
+// NewIPFilterRules parses the rules, the longest matching prefix applies. The files are watched for changes till the context is cancelled,
+// a reload is executed once no further change has been observed for the debounce duration.
+func NewIPFilterRules(ctx context.Context, debounce time.Duration, rules ...IPFilterRule) (*IPFilterRules, error) {
+	rules = sortByPrefixLength(rules)
+	filter := &IPFilterRules{rules: make([]*ipFilterRule, len(rules))}
+	var files []string
+	for i, rule := range rules {
+		filter.rules[i] = &ipFilterRule{IPFilterRule: rule}
+		if err := filter.rules[i].load(); err != nil {
+			return nil, err
+		}
+		for _, file := range []string{rule.AllowFile, rule.DenyFile} {
+			if file != "" {
+				files = append(files, file)
+			}
+		}
+	}
+	if len(files) > 0 {
+		if err := watchFiles(ctx, "ip filter lists", debounce, filter.Reload, files...); err != nil {
+			return nil, err
+		}
+	}
+	return filter, nil
+}
+
+// Reload reads the list files of all rules. The previous lists of a rule are kept on errors.
+func (filter *IPFilterRules) Reload() error {
+	var errs []error
+	for _, rule := range filter.rules {
+		if err := rule.load(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// load parses the inline lists and reads the list files
+func (rule *ipFilterRule) load() error {
+	allow, err := parsePrefixes(rule.Allow, rule.AllowFile)
+	if err != nil {
+		return err
+	}
+	deny, err := parsePrefixes(rule.Deny, rule.DenyFile)
+	if err != nil {
+		return err
+	}
+	rule.lists.Store(&ipLists{allow: allow, deny: deny})
+	return nil
+}
+
+// parsePrefixes parses the CIDRs and the CIDRs in the file if set
+func parsePrefixes(cidrs []string, file string) ([]netip.Prefix, error) {
+	cidrs = slices.Clone(cidrs)
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading ip list %s: %w", file, err)
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line != "" && !strings.HasPrefix(line, "#") {
+				cidrs = append(cidrs, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("error reading ip list %s: %w", file, err)
+		}
+	}
+	result := make([]netip.Prefix, len(cidrs))
+	for i, cidr := range cidrs {
+		prefix, err := parsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = prefix
+	}
+	return result, nil
+}
+
+// containsAddr checks whether one of the prefixes contains the address
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed checks whether the client IP is allowed for the request path and returns the matched rule, nil if no rule matches
+func (filter *IPFilterRules) allowed(requestPath string, addr netip.Addr) (*ipFilterRule, bool) {
+	rule, ok := longestPrefixMatch(filter.rules, requestPath)
+	if !ok {
+		return nil, true
+	}
+	lists := rule.lists.Load()
+	if containsAddr(lists.deny, addr) {
+		return rule, false
+	}
+	return rule, len(lists.allow) == 0 || containsAddr(lists.allow, addr)
+}
+
+// IPFilterHandler answers with 403 if the client IP is not allowed by the rule with the longest matching prefix.
+// The request path has to be cleaned beforehand, see ValidateHandler. The decisions are counted if the registration is not nil,
+// it has to be prepared via the AccessMetricsRegister function.
+func IPFilterHandler(next http.Handler, filter *IPFilterRules, registration *PrometheusRegistration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rule, ok := filter.allowed(r.URL.Path, GetClientIP(r))
+		if rule == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		decision := "allowed"
+		if !ok {
+			decision = "denied"
+		}
+		if registration != nil {
+			registration.ipFilterDecisions.With(map[string]string{DomainLabel: r.Host, PrefixLabel: rule.Prefix, DecisionLabel: decision}).Inc()
+		}
+		if !ok {
+			log.Debug().Msgf("Client IP %s denied for %s", GetClientIP(r), r.URL.Path)
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
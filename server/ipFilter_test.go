@@ -0,0 +1,133 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func ipFilterStatus(handler http.Handler, remoteAddr string, target string) int {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.RemoteAddr = remoteAddr
+	handler.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestIPFilter(t *testing.T) {
+	filter, err := server.NewIPFilterRules(context.Background(), time.Second,
+		server.IPFilterRule{Deny: []string{"198.51.100.0/24", "10.9.0.0/16"}},
+		server.IPFilterRule{Prefix: "/internal/", Allow: []string{"10.0.0.0/8", "2001:db8::/32"}, Deny: []string{"10.0.0.66"}},
+	)
+	require.NoError(t, err)
+	registry := prometheus.NewRegistry()
+	registration, err := server.AccessMetricsRegister(registry, "test")
+	require.NoError(t, err)
+	handler := server.IPFilterHandler(namedHandler("ok"), filter, registration)
+
+	for _, testCase := range []struct {
+		remoteAddr string
+		target     string
+		expected   int
+	}{
+		{remoteAddr: "203.0.113.1:1234", target: "/", expected: http.StatusOK},
+		{remoteAddr: "198.51.100.1:1234", target: "/", expected: http.StatusForbidden},
+		{remoteAddr: "10.1.2.3:1234", target: "/internal/docs", expected: http.StatusOK},
+		{remoteAddr: "[2001:db8::1]:1234", target: "/internal", expected: http.StatusOK},
+		{remoteAddr: "10.0.0.66:1234", target: "/internal/docs", expected: http.StatusForbidden},
+		{remoteAddr: "203.0.113.1:1234", target: "/internal/docs", expected: http.StatusForbidden},
+		// the rule with the longest prefix applies, the denylist of the root rule is not consulted
+		{remoteAddr: "10.9.0.1:1234", target: "/internal/docs", expected: http.StatusOK},
+		{remoteAddr: "203.0.113.1:1234", target: "/internals", expected: http.StatusOK},
+	} {
+		require.Equal(t, testCase.expected, ipFilterStatus(handler, testCase.remoteAddr, testCase.target), testCase)
+	}
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	decisions := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != "test_access_ipfilter_decisions" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			decisions[labels["prefix"]+" "+labels["decision"]] = metric.GetCounter().GetValue()
+		}
+	}
+	require.Equal(t, map[string]float64{" allowed": 2, " denied": 1, "/internal/ allowed": 3, "/internal/ denied": 2}, decisions)
+}
+
+func TestIPFilterRewrite(t *testing.T) {
+	filter, err := server.NewIPFilterRules(context.Background(), time.Second, server.IPFilterRule{Prefix: "/admin/", Allow: []string{"10.0.0.0/8"}})
+	require.NoError(t, err)
+	handler := rewriteHandler(t, namedHandler("ok"), server.IPFilter(filter, nil))
+	require.Equal(t, http.StatusForbidden, ipFilterStatus(handler, "203.0.113.1:1234", "/pub/a"))
+	require.Equal(t, http.StatusOK, ipFilterStatus(handler, "10.1.2.3:1234", "/pub/a"))
+}
+
+func TestIPFilterForgedForwarded(t *testing.T) {
+	filter, err := server.NewIPFilterRules(context.Background(), time.Second, server.IPFilterRule{Prefix: "/internal/", Allow: []string{"192.0.2.0/24"}})
+	require.NoError(t, err)
+	resolver, err := server.NewClientIPResolver("X-Forwarded-For", "10.0.0.0/8")
+	require.NoError(t, err)
+	handler := server.RealIPHandler(server.IPFilterHandler(namedHandler("ok"), filter, nil), resolver)
+	for _, testCase := range []struct {
+		forwardedFor string
+		expected     int
+	}{
+		{forwardedFor: "192.0.2.1", expected: http.StatusOK},
+		// the trusted proxy appends the client IP to X-Forwarded-For and passes the forged Forwarded header through
+		{forwardedFor: "203.0.113.1", expected: http.StatusForbidden},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/internal/docs", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("X-Forwarded-For", testCase.forwardedFor)
+		r.Header.Set("Forwarded", "for=192.0.2.1")
+		handler.ServeHTTP(w, r)
+		require.Equal(t, testCase.expected, w.Code, testCase.forwardedFor)
+	}
+}
+
+func TestIPFilterReload(t *testing.T) {
+	dir := t.TempDir()
+	allowFile := filepath.Join(dir, "allow.txt")
+	require.NoError(t, os.WriteFile(allowFile, []byte("# office\n192.0.2.0/24\n\n"), 0o600))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	filter, err := server.NewIPFilterRules(ctx, 10*time.Millisecond, server.IPFilterRule{AllowFile: allowFile})
+	require.NoError(t, err)
+	handler := server.IPFilterHandler(namedHandler("ok"), filter, nil)
+	require.Equal(t, http.StatusOK, ipFilterStatus(handler, "192.0.2.1:1234", "/"))
+	require.Equal(t, http.StatusForbidden, ipFilterStatus(handler, "203.0.113.1:1234", "/"))
+
+	require.NoError(t, os.WriteFile(allowFile, []byte("203.0.113.0/24\n"), 0o600))
+	require.Eventually(t, func() bool {
+		return ipFilterStatus(handler, "203.0.113.1:1234", "/") == http.StatusOK &&
+			ipFilterStatus(handler, "192.0.2.1:1234", "/") == http.StatusForbidden
+	}, time.Second, 10*time.Millisecond)
+
+	// invalid lists keep the previous version
+	require.NoError(t, os.WriteFile(allowFile, []byte("invalid\n"), 0o600))
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, http.StatusOK, ipFilterStatus(handler, "203.0.113.1:1234", "/"))
+}
+
+func TestIPFilterInvalid(t *testing.T) {
+	_, err := server.NewIPFilterRules(context.Background(), time.Second, server.IPFilterRule{Allow: []string{"10.0.0.0/33"}})
+	require.Error(t, err)
+	_, err = server.NewIPFilterRules(context.Background(), time.Second, server.IPFilterRule{DenyFile: filepath.Join(t.TempDir(), "missing")})
+	require.Error(t, err)
+}
@@ -0,0 +1,308 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/rs/zerolog/log"
+)
+
+// how long fetching the JWKS from the URL may take
+const jwksFetchTimeout = 10 * time.Second
+
+// minimal time between two fetches of the JWKS URL that are triggered by unknown key ids
+const minJWKSRefreshInterval = 30 * time.Second
+
+// the maximal size of the JWKS
+const maxJWKSSize = 1 << 20
+
+var (
+	JWTClaimsKey        = &ContextKey{val: "jwtClaims"}
+	ErrInvalidJWTConfig = errors.New("invalid jwt config")
+	errUnknownJWTKey    = errors.New("no matching key for the jwt")
+)
+
+// jwtAlgorithms are the accepted signature algorithms
+var jwtAlgorithms = []jose.SignatureAlgorithm{jose.RS256, jose.ES256, jose.EdDSA}
+
+// JWTConfig configures the verification of the tokens
+type JWTConfig struct {
+	// Issuer is the required iss claim
+	Issuer string
+	// Audience is the audience that has to be contained in the aud claim
+	Audience string
+	// JWKSFile is a JSON Web Key Set file, it is reloaded on changes. Either the JWKSFile or the JWKSURL has to be set.
+	JWKSFile string
+	// JWKSURL is fetched every RefreshInterval and when a token with an unknown key id is presented
+	JWKSURL string
+	// RefreshInterval of the JWKSURL, defaults to 1h if zero
+	RefreshInterval time.Duration
+	// ReloadDebounce is the time to wait for further changes of the JWKSFile before it is reloaded
+	ReloadDebounce time.Duration
+	// CookieName is the cookie that holds the token if there is no Authorization header, empty to only accept the header
+	CookieName string
+	// Leeway is the allowed clock skew for the exp, nbf and iat claims
+	Leeway time.Duration
+}
+
+// JWTRule protects the requests with the path Prefix
+type JWTRule struct {
+	// Prefix is a path prefix like /assets/, empty for all paths
+	Prefix string
+	// Claims are required in addition to the issuer and audience. A string claim has to be equal to the value,
+	// an array claim has to contain the value.
+	Claims map[string]string
+}
+
+func (rule JWTRule) pathPrefix() string {
+	return rule.Prefix
+}
+
+// JWTVerifier verifies RS256, ES256 and EdDSA signed tokens against the keys of a JSON Web Key Set
+type JWTVerifier struct {
+	config JWTConfig
+	keys   atomic.Pointer[jose.JSONWebKeySet]
+	// rules are sorted by descending prefix length
+	rules     []JWTRule
+	client    *http.Client
+	refreshMu sync.Mutex
+	// lastUnknownKeyFetch is the last fetch that has been triggered by an unknown key id
+	lastUnknownKeyFetch time.Time
+}
+
+// NewJWTVerifier loads the JSON Web Key Set. The JWKS file is watched for changes and the JWKS URL is refreshed till the context is cancelled.
+func NewJWTVerifier(ctx context.Context, config JWTConfig, rules ...JWTRule) (*JWTVerifier, error) {
+	if (config.JWKSFile == "") == (config.JWKSURL == "") {
+		return nil, fmt.Errorf("%w: either the jwks file or the jwks url has to be set", ErrInvalidJWTConfig)
+	}
+	if config.Issuer == "" || config.Audience == "" {
+		return nil, fmt.Errorf("%w: the issuer and the audience are required", ErrInvalidJWTConfig)
+	}
+	if config.RefreshInterval == 0 {
+		config.RefreshInterval = time.Hour
+	}
+	verifier := &JWTVerifier{config: config, rules: sortByPrefixLength(rules), client: &http.Client{Timeout: jwksFetchTimeout}}
+	if config.JWKSFile != "" {
+		if err := verifier.Reload(); err != nil {
+			return nil, err
+		}
+		if err := watchFiles(ctx, "jwks file", config.ReloadDebounce, verifier.Reload, config.JWKSFile); err != nil {
+			return nil, err
+		}
+		return verifier, nil
+	}
+	if err := verifier.fetch(ctx); err != nil {
+		return nil, err
+	}
+	go verifier.refresh(ctx)
+	return verifier, nil
+}
+
+// Reload reads the JWKS file. The previous keys are kept on errors.
+func (verifier *JWTVerifier) Reload() error {
+	data, err := os.ReadFile(verifier.config.JWKSFile)
+	if err != nil {
+		return fmt.Errorf("error reading jwks file %s: %w", verifier.config.JWKSFile, err)
+	}
+	return verifier.store(data)
+}
+
+// store parses the JWKS
+func (verifier *JWTVerifier) store(data []byte) error {
+	var keys jose.JSONWebKeySet
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("invalid jwks: %w", err)
+	}
+	verifier.keys.Store(&keys)
+	return nil
+}
+
+// fetch downloads the JWKS from the URL. The previous keys are kept on errors.
+func (verifier *JWTVerifier) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, verifier.config.JWKSURL, nil)
+	if err != nil {
+		return fmt.Errorf("invalid jwks url: %w", err)
+	}
+	resp, err := verifier.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error fetching jwks from %s: %w", verifier.config.JWKSURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error fetching jwks from %s: status %d", verifier.config.JWKSURL, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	if err != nil {
+		return fmt.Errorf("error fetching jwks from %s: %w", verifier.config.JWKSURL, err)
+	}
+	return verifier.store(data)
+}
+
+// refresh fetches the JWKS URL every refresh interval till the context is cancelled
+func (verifier *JWTVerifier) refresh(ctx context.Context) {
+	ticker := time.NewTicker(verifier.config.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			verifier.refreshMu.Lock()
+			if err := verifier.fetch(ctx); err != nil {
+				log.Error().Err(err).Msg("Error refreshing the jwks, keeping the previous keys")
+			}
+			verifier.refreshMu.Unlock()
+		}
+	}
+}
+
+// refreshUnknownKey fetches the JWKS URL for key ids that are not known yet, as the keys may have been rotated.
+// Fetches are limited to one per minJWKSRefreshInterval. They are decoupled from the request context,
+// as a cancelled request would otherwise use up the fetch for all waiting requests.
+//
+//nolint:contextcheck // the fetch must not be aborted by the request
+func (verifier *JWTVerifier) refreshUnknownKey(ctx context.Context) bool {
+	if verifier.config.JWKSURL == "" {
+		return false
+	}
+	verifier.refreshMu.Lock()
+	defer verifier.refreshMu.Unlock()
+	if time.Since(verifier.lastUnknownKeyFetch) < minJWKSRefreshInterval {
+		return false
+	}
+	verifier.lastUnknownKeyFetch = time.Now()
+	fetchCtx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+	defer cancel()
+	if err := verifier.fetch(fetchCtx); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Error refreshing the jwks for an unknown key id")
+		return false
+	}
+	return true
+}
+
+// candidateKeys returns the signature keys that match the key id and algorithm of the token header
+func (verifier *JWTVerifier) candidateKeys(header jose.Header) []jose.JSONWebKey {
+	var result []jose.JSONWebKey
+	for _, key := range verifier.keys.Load().Keys {
+		if key.Use == "enc" || (header.KeyID != "" && key.KeyID != header.KeyID) || (key.Algorithm != "" && key.Algorithm != header.Algorithm) {
+			continue
+		}
+		result = append(result, key)
+	}
+	return result
+}
+
+// verify checks the signature and the standard claims of the token and returns all claims
+func (verifier *JWTVerifier) verify(ctx context.Context, token string) (map[string]any, error) {
+	parsed, err := jwt.ParseSigned(token, jwtAlgorithms)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed.Headers) != 1 {
+		return nil, errors.New("jwt has to have exactly one signature")
+	}
+	keys := verifier.candidateKeys(parsed.Headers[0])
+	if len(keys) == 0 && verifier.refreshUnknownKey(ctx) {
+		keys = verifier.candidateKeys(parsed.Headers[0])
+	}
+	var standard jwt.Claims
+	var claims map[string]any
+	err = errUnknownJWTKey
+	for _, key := range keys {
+		if err = parsed.Claims(key.Key, &standard, &claims); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if standard.Expiry == nil {
+		return nil, errors.New("jwt without exp claim")
+	}
+	expected := jwt.Expected{Issuer: verifier.config.Issuer, AnyAudience: jwt.Audience{verifier.config.Audience}}
+	if err := standard.ValidateWithLeeway(expected, verifier.config.Leeway); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// token returns the bearer token of the Authorization header or the cookie
+func (verifier *JWTVerifier) token(r *http.Request) (string, bool) {
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		scheme, token, ok := strings.Cut(authorization, " ")
+		return token, ok && strings.EqualFold(scheme, "Bearer") && token != ""
+	}
+	if verifier.config.CookieName == "" {
+		return "", false
+	}
+	return readCookie(r, verifier.config.CookieName)
+}
+
+// hasClaims checks the required claims
+func hasClaims(claims map[string]any, required map[string]string) bool {
+	for name, value := range required {
+		switch claim := claims[name].(type) {
+		case string:
+			if claim != value {
+				return false
+			}
+		case []any:
+			if !slices.Contains(claim, any(value)) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// GetJWTClaims returns the claims of the token that has been verified by the JWTHandler, nil if none
+func GetJWTClaims(r *http.Request) map[string]any {
+	claims, _ := r.Context().Value(JWTClaimsKey).(map[string]any)
+	return claims
+}
+
+// JWTHandler requires a valid token with the required claims of the rule with the longest matching prefix. The token is read from
+// the Authorization header or the cookie. Missing or invalid tokens are answered with 401, missing claims with 403.
+// The request path has to be cleaned beforehand, see ValidateHandler. The claims are stored in the request context.
+func JWTHandler(next http.Handler, verifier *JWTVerifier) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rule, ok := longestPrefixMatch(verifier.rules, r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, ok := verifier.token(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		claims, err := verifier.verify(r.Context(), token)
+		if err != nil {
+			log.Ctx(r.Context()).Debug().Err(err).Msg("Invalid jwt")
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		if !hasClaims(claims, rule.Claims) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), JWTClaimsKey, claims)))
+	})
+}
@@ -0,0 +1,265 @@
+package server_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	jwtIssuer   = "https://auth.example.com"
+	jwtAudience = "assets"
+)
+
+func jwtKey(t *testing.T, kid string, algorithm jose.SignatureAlgorithm) jose.JSONWebKey {
+	var key any
+	var err error
+	switch algorithm {
+	case jose.RS256:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case jose.ES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jose.EdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case jose.HS256:
+		key = []byte("0123456789abcdef0123456789abcdef")
+	}
+	require.NoError(t, err)
+	return jose.JSONWebKey{Key: key, KeyID: kid, Algorithm: string(algorithm), Use: "sig"}
+}
+
+// jwks returns the public JSON Web Key Set of the keys
+func jwks(t *testing.T, keys ...jose.JSONWebKey) []byte {
+	set := jose.JSONWebKeySet{}
+	for _, key := range keys {
+		set.Keys = append(set.Keys, key.Public())
+	}
+	data, err := json.Marshal(set)
+	require.NoError(t, err)
+	return data
+}
+
+// signJWT signs the claims with the key, the standard claims default to a valid token
+func signJWT(t *testing.T, key jose.JSONWebKey, modify func(claims *jwt.Claims), extra map[string]any) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.SignatureAlgorithm(key.Algorithm), Key: key}, nil)
+	require.NoError(t, err)
+	claims := jwt.Claims{
+		Issuer:   jwtIssuer,
+		Subject:  "user-1",
+		Audience: jwt.Audience{"other", jwtAudience},
+		Expiry:   jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}
+	if modify != nil {
+		modify(&claims)
+	}
+	token, err := jwt.Signed(signer).Claims(claims).Claims(extra).Serialize()
+	require.NoError(t, err)
+	return token
+}
+
+func writeJWKS(t *testing.T, file string, keys ...jose.JSONWebKey) {
+	require.NoError(t, os.WriteFile(file+".tmp", jwks(t, keys...), 0o600))
+	require.NoError(t, os.Rename(file+".tmp", file))
+}
+
+func newJWTVerifier(t *testing.T, file string, rules ...server.JWTRule) *server.JWTVerifier {
+	verifier, err := server.NewJWTVerifier(context.Background(), server.JWTConfig{
+		Issuer:         jwtIssuer,
+		Audience:       jwtAudience,
+		JWKSFile:       file,
+		ReloadDebounce: 10 * time.Millisecond,
+		CookieName:     "token",
+	}, rules...)
+	require.NoError(t, err)
+	return verifier
+}
+
+// subjectHandler answers with the sub claim
+var subjectHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if claims := server.GetJWTClaims(r); claims != nil {
+		_, _ = w.Write([]byte(claims["sub"].(string)))
+	}
+})
+
+func jwtRequest(handler http.Handler, target string, authorization string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestJWTAlgorithms(t *testing.T) {
+	keys := []jose.JSONWebKey{jwtKey(t, "rsa", jose.RS256), jwtKey(t, "ec", jose.ES256), jwtKey(t, "ed", jose.EdDSA)}
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, file, keys...)
+	handler := server.JWTHandler(subjectHandler, newJWTVerifier(t, file, server.JWTRule{Prefix: "/assets/"}))
+
+	for _, key := range keys {
+		w := jwtRequest(handler, "/assets/app.js", "Bearer "+signJWT(t, key, nil, nil))
+		require.Equal(t, http.StatusOK, w.Code, key.KeyID)
+		require.Equal(t, "user-1", w.Body.String())
+	}
+	// the token can also be read from the cookie
+	r := httptest.NewRequest(http.MethodGet, "/assets/app.js", nil)
+	r.AddCookie(&http.Cookie{Name: "token", Value: signJWT(t, keys[0], nil, nil)})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	// paths without matching rule are not protected
+	require.Equal(t, http.StatusOK, jwtRequest(handler, "/public", "").Code)
+}
+
+func TestJWTRewrite(t *testing.T) {
+	key := jwtKey(t, "rsa", jose.RS256)
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, file, key)
+	handler := rewriteHandler(t, subjectHandler, server.JWT(newJWTVerifier(t, file, server.JWTRule{Prefix: "/admin/"})))
+	require.Equal(t, http.StatusUnauthorized, jwtRequest(handler, "/pub/a", "").Code)
+	w := jwtRequest(handler, "/pub/a", "Bearer "+signJWT(t, key, nil, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "user-1", w.Body.String())
+}
+
+func TestJWTInvalid(t *testing.T) {
+	key := jwtKey(t, "rsa", jose.RS256)
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, file, key)
+	handler := server.JWTHandler(subjectHandler, newJWTVerifier(t, file, server.JWTRule{}))
+
+	tests := []struct {
+		name          string
+		authorization string
+	}{
+		{name: "wrong issuer", authorization: "Bearer " + signJWT(t, key, func(claims *jwt.Claims) { claims.Issuer = "https://evil.example.com" }, nil)},
+		{name: "wrong audience", authorization: "Bearer " + signJWT(t, key, func(claims *jwt.Claims) { claims.Audience = jwt.Audience{"other"} }, nil)},
+		{name: "expired", authorization: "Bearer " + signJWT(t, key, func(claims *jwt.Claims) {
+			claims.Expiry = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+		}, nil)},
+		{name: "without expiry", authorization: "Bearer " + signJWT(t, key, func(claims *jwt.Claims) { claims.Expiry = nil }, nil)},
+		{name: "not yet valid", authorization: "Bearer " + signJWT(t, key, func(claims *jwt.Claims) {
+			claims.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Hour))
+		}, nil)},
+		{name: "unknown key", authorization: "Bearer " + signJWT(t, jwtKey(t, "rsa", jose.RS256), nil, nil)},
+		{name: "symmetric algorithm", authorization: "Bearer " + signJWT(t, jwtKey(t, "rsa", jose.HS256), nil, nil)},
+		{name: "malformed", authorization: "Bearer abc.def.ghi"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := jwtRequest(handler, "/", test.authorization)
+			require.Equal(t, http.StatusUnauthorized, w.Code)
+			require.Equal(t, `Bearer error="invalid_token"`, w.Header().Get("WWW-Authenticate"))
+		})
+	}
+	for _, authorization := range []string{"", "Basic " + signJWT(t, key, nil, nil)} {
+		w := jwtRequest(handler, "/", authorization)
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+		require.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+	}
+	// the scheme is case-insensitive
+	require.Equal(t, http.StatusOK, jwtRequest(handler, "/", "bearer "+signJWT(t, key, nil, nil)).Code)
+}
+
+func TestJWTRequiredClaims(t *testing.T) {
+	key := jwtKey(t, "ec", jose.ES256)
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, file, key)
+	handler := server.JWTHandler(subjectHandler, newJWTVerifier(t, file,
+		server.JWTRule{Prefix: "/assets/"},
+		server.JWTRule{Prefix: "/assets/internal/", Claims: map[string]string{"tenant": "acme", "roles": "staff"}},
+	))
+
+	tests := []struct {
+		name   string
+		claims map[string]any
+		code   int
+	}{
+		{name: "matching claims", claims: map[string]any{"tenant": "acme", "roles": []string{"user", "staff"}}, code: http.StatusOK},
+		{name: "other tenant", claims: map[string]any{"tenant": "other", "roles": []string{"staff"}}, code: http.StatusForbidden},
+		{name: "missing role", claims: map[string]any{"tenant": "acme", "roles": []any{"user", map[string]any{"staff": true}}}, code: http.StatusForbidden},
+		{name: "missing claims", claims: nil, code: http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token := "Bearer " + signJWT(t, key, nil, test.claims)
+			require.Equal(t, test.code, jwtRequest(handler, "/assets/internal/report.pdf", token).Code)
+			// the shorter prefix has no required claims
+			require.Equal(t, http.StatusOK, jwtRequest(handler, "/assets/app.js", token).Code)
+		})
+	}
+}
+
+func TestJWTFileReload(t *testing.T) {
+	oldKey := jwtKey(t, "old", jose.EdDSA)
+	newKey := jwtKey(t, "new", jose.EdDSA)
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, file, oldKey)
+	handler := server.JWTHandler(subjectHandler, newJWTVerifier(t, file, server.JWTRule{}))
+	oldToken := "Bearer " + signJWT(t, oldKey, nil, nil)
+	newToken := "Bearer " + signJWT(t, newKey, nil, nil)
+	require.Equal(t, http.StatusOK, jwtRequest(handler, "/", oldToken).Code)
+	require.Equal(t, http.StatusUnauthorized, jwtRequest(handler, "/", newToken).Code)
+
+	writeJWKS(t, file, newKey)
+	require.Eventually(t, func() bool {
+		return jwtRequest(handler, "/", newToken).Code == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, http.StatusUnauthorized, jwtRequest(handler, "/", oldToken).Code)
+}
+
+func TestJWTURLRotation(t *testing.T) {
+	oldKey := jwtKey(t, "old", jose.RS256)
+	newKey := jwtKey(t, "new", jose.RS256)
+	var served atomic.Pointer[[]byte]
+	var fetches atomic.Int32
+	served.Store(new(jwks(t, oldKey)))
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fetches.Add(1)
+		_, _ = w.Write(*served.Load())
+	}))
+	defer jwksServer.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	verifier, err := server.NewJWTVerifier(ctx, server.JWTConfig{Issuer: jwtIssuer, Audience: jwtAudience, JWKSURL: jwksServer.URL}, server.JWTRule{})
+	require.NoError(t, err)
+	handler := server.JWTHandler(subjectHandler, verifier)
+	require.Equal(t, http.StatusOK, jwtRequest(handler, "/", "Bearer "+signJWT(t, oldKey, nil, nil)).Code)
+	require.Equal(t, int32(1), fetches.Load())
+
+	// unknown key ids trigger a refresh
+	served.Store(new(jwks(t, oldKey, newKey)))
+	require.Equal(t, http.StatusOK, jwtRequest(handler, "/", "Bearer "+signJWT(t, newKey, nil, nil)).Code)
+	require.Equal(t, int32(2), fetches.Load())
+	// but only once per interval
+	require.Equal(t, http.StatusUnauthorized, jwtRequest(handler, "/", "Bearer "+signJWT(t, jwtKey(t, "unknown", jose.RS256), nil, nil)).Code)
+	require.Equal(t, int32(2), fetches.Load())
+}
+
+func TestJWTInvalidConfig(t *testing.T) {
+	for _, config := range []server.JWTConfig{
+		{Issuer: jwtIssuer, Audience: jwtAudience},
+		{Issuer: jwtIssuer, Audience: jwtAudience, JWKSFile: "jwks.json", JWKSURL: "https://auth.example.com/jwks"},
+		{Audience: jwtAudience, JWKSURL: "https://auth.example.com/jwks"},
+	} {
+		_, err := server.NewJWTVerifier(context.Background(), config)
+		require.ErrorIs(t, err, server.ErrInvalidJWTConfig)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/stretchr/testify/require"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -37,3 +38,20 @@ func getReceivedData(t *testing.T, r io.Reader) []byte {
 	require.NoError(t, err)
 	return data
 }
+
+// listen opens a local TCP listener on a random port
+func listen(t *testing.T) (net.Listener, int) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	tcpAddr, ok := l.Addr().(*net.TCPAddr)
+	require.True(t, ok)
+	return l, tcpAddr.Port
+}
+
+// unusedPort returns a local TCP port that refuses connections
+func unusedPort(t *testing.T) int {
+	l, port := listen(t)
+	require.NoError(t, l.Close())
+	return port
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+var ErrInvalidMountPrefix = errors.New("mount prefixes have to start with a slash and must not be the root")
+
+// Mount serves a sub-directory of the filesystem under a path prefix, e.g. a single page application under /admin/
+type Mount struct {
+	// Prefix is the path prefix like /admin/
+	Prefix string
+	// Dir is the sub-directory in the served filesystem. Defaults to the Prefix.
+	Dir string
+	// FallbackPath is the path within Dir that is served on the FallbackCodes, e.g. /index.html. Set to empty to disable.
+	FallbackPath string
+	// FallbackCodes are the HTTP status codes on which the FallbackPath is served
+	FallbackCodes []int
+}
+
+// MountRouter returns a chi router that passes requests with the longest matching Mount prefix to the next handler with the path rewritten to the Mount directory.
+// The mount fallbacks are applied before the next handler, which serves the files. Requests without matching mount are passed to the defaultHandler,
+// apart from requests for the directories of mounts with another prefix, which are answered with 404 so that the directories are only served under their prefix.
+func MountRouter(defaultHandler http.Handler, next http.Handler, mounts ...Mount) (chi.Router, error) {
+	r := chi.NewRouter()
+	var hiddenDirs []string
+	for _, mount := range mounts {
+		prefix := strings.TrimSuffix(mount.Prefix, "/")
+		if !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMountPrefix, mount.Prefix)
+		}
+		dir := mount.Dir
+		if dir == "" {
+			dir = prefix
+		}
+		dir = path.Join("/", dir)
+		if dir != prefix && dir != "/" {
+			hiddenDirs = append(hiddenDirs, dir+"/")
+		}
+		handler := next
+		if mount.FallbackPath != "" {
+			handler = FallbackHandler(handler, mountFallbackPath(dir, mount.FallbackPath), mount.FallbackCodes...)
+		}
+		handler = mountHandler(handler, prefix, dir)
+		// the request paths are cleaned by the Validate handler, so the prefix without trailing slash has to be handled as well
+		r.Handle(prefix, handler)
+		r.Handle(prefix+"/*", handler)
+	}
+	r.Handle("/*", hideDirsHandler(defaultHandler, hiddenDirs...))
+	return r, nil
+}
+
+// hideDirsHandler answers requests for the dirs with 404
+func hideDirsHandler(next http.Handler, dirs ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, dir := range dirs {
+			if hasPathPrefix(r.URL.Path, dir) {
+				http.NotFound(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// mountFallbackPath joins the fallback path to the dir.
+// http.FileServer redirects requests for index.html to the directory, so the directory itself is used in this case.
+func mountFallbackPath(dir string, fallbackPath string) string {
+	result := path.Join(dir, fallbackPath)
+	if parent, ok := strings.CutSuffix(result, "/index.html"); ok {
+		return parent + "/"
+	}
+	if strings.HasSuffix(fallbackPath, "/") && result != "/" {
+		return result + "/"
+	}
+	return result
+}
+
+// mountHandler rewrites the prefix of the request path to the dir
+func mountHandler(next http.Handler, prefix string, dir string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest := strings.TrimPrefix(r.URL.Path, prefix)
+		if rest == "" {
+			rest = "/"
+		}
+		r = r.Clone(r.Context())
+		r.URL.Path = strings.TrimSuffix(dir, "/") + rest
+		r.URL.RawPath = ""
+		next.ServeHTTP(w, r)
+	})
+}
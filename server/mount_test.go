@@ -0,0 +1,80 @@
+package server_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/stretchr/testify/require"
+)
+
+func getMountRouter(t *testing.T) http.Handler {
+	fsys := fstest.MapFS{
+		"index.html":                   {Data: []byte("root")},
+		"admin-dist/index.html":        {Data: []byte("admin")},
+		"admin-dist/main.js":           {Data: []byte("admin.js")},
+		"admin-dist/legacy/index.html": {Data: []byte("legacy")},
+		"app/index.html":               {Data: []byte("app")},
+	}
+	fileServer := http.FileServer(http.FS(fsys))
+	router, err := server.MountRouter(server.FallbackHandler(fileServer, "/", http.StatusNotFound), fileServer,
+		server.Mount{Prefix: "/admin/", Dir: "admin-dist", FallbackPath: "/index.html", FallbackCodes: []int{http.StatusNotFound}},
+		server.Mount{Prefix: "/admin/legacy/", Dir: "admin-dist/legacy", FallbackPath: "/index.html", FallbackCodes: []int{http.StatusNotFound}},
+		server.Mount{Prefix: "/app/", FallbackPath: "/index.html", FallbackCodes: []int{http.StatusNotFound}},
+		server.Mount{Prefix: "/nofallback/"},
+	)
+	require.NoError(t, err)
+	return router
+}
+
+func TestMountRouter(t *testing.T) {
+	router := getMountRouter(t)
+	for requestPath, expected := range map[string]string{
+		"/":                   "root",
+		"/unknown":            "root",
+		"/admin":              "admin",
+		"/admin/":             "admin",
+		"/admin/main.js":      "admin.js",
+		"/admin/users/1":      "admin",
+		"/admin/legacy/":      "legacy",
+		"/admin/legacy/users": "legacy",
+		"/app/settings":       "app",
+		"/application":        "root",
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, requestPath, nil))
+		require.Equal(t, http.StatusOK, w.Code, requestPath)
+		body, err := io.ReadAll(w.Body)
+		require.NoError(t, err)
+		require.Equal(t, expected, string(body), requestPath)
+	}
+}
+
+func TestMountRouterWithoutFallback(t *testing.T) {
+	w := httptest.NewRecorder()
+	getMountRouter(t).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/nofallback/missing", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestMountRouterHidesDirs(t *testing.T) {
+	router := getMountRouter(t)
+	// the mount directories are only served under their prefix
+	for _, requestPath := range []string{"/admin-dist", "/admin-dist/", "/admin-dist/main.js", "/admin-dist/legacy/index.html"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, requestPath, nil))
+		require.Equal(t, http.StatusNotFound, w.Code, requestPath)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin-distribution", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestMountRouterInvalidPrefix(t *testing.T) {
+	_, err := server.MountRouter(http.NotFoundHandler(), http.NotFoundHandler(), server.Mount{Prefix: "/"})
+	require.ErrorIs(t, err, server.ErrInvalidMountPrefix)
+	_, err = server.MountRouter(http.NotFoundHandler(), http.NotFoundHandler(), server.Mount{Prefix: "admin/"})
+	require.ErrorIs(t, err, server.ErrInvalidMountPrefix)
+}
@@ -0,0 +1,325 @@
+package server
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/oauth2"
+)
+
+// minimal length of the secret the session cookies are encrypted with
+const minOIDCCookieSecretLength = 32
+
+// how long the login flow at the identity provider may take
+const oidcLoginTimeToLife = 10 * time.Minute
+
+var (
+	OIDCClaimsKey        = &ContextKey{val: "oidcClaims"}
+	ErrInvalidOIDCConfig = errors.New("invalid oidc config")
+	errInvalidCookie     = errors.New("invalid encrypted cookie")
+)
+
+// OIDCConfig configures the OpenID Connect relying party
+type OIDCConfig struct {
+	// IssuerURL is used to discover the endpoints of the identity provider via /.well-known/openid-configuration
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the absolute callback URL registered at the identity provider, e.g. https://dashboard.example.com/oauth2/callback.
+	// Its path is handled by the OIDCHandler.
+	RedirectURL string
+	// Scopes are requested in addition to the openid scope
+	Scopes []string
+	// Prefixes are the protected path prefixes like /dashboard/, all paths are protected if empty
+	Prefixes []string
+	// AllowedDomains restricts the logins to email addresses of these domains, the ID token has to contain the claim email_verified set to true
+	AllowedDomains []string
+	// AllowedGroups restricts the logins to members of these groups, a login is allowed if either the domain or a group matches
+	AllowedGroups []string
+	// GroupsClaim is the ID token claim that holds the groups, defaults to groups
+	GroupsClaim string
+	// CookieName is the name of the session cookie, the name of the login cookie has the suffix _login
+	CookieName string
+	// CookieSecret encrypts the session and login cookies, has to be at least 32 bytes long
+	CookieSecret []byte
+	// SessionDuration is the lifetime of the session cookie
+	SessionDuration time.Duration
+}
+
+// OIDCClaims are the claims of the ID token that are kept in the session cookie
+type OIDCClaims struct {
+	Subject string   `json:"sub"`
+	Email   string   `json:"email,omitempty"`
+	Groups  []string `json:"groups,omitempty"`
+	// Expiry is the unix time when the session expires
+	Expiry int64 `json:"exp"`
+}
+
+// oidcLogin is the state of a login flow that is kept in the login cookie till the callback
+type oidcLogin struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Target   string `json:"target"`
+	Expiry   int64  `json:"exp"`
+}
+
+// OIDCRelyingParty is an OpenID Connect relying party that uses the authorization code flow with PKCE
+type OIDCRelyingParty struct {
+	config       OIDCConfig
+	oauth2       *oauth2.Config
+	verifier     *oidc.IDTokenVerifier
+	callbackPath string
+	aead         cipher.AEAD
+}
+
+// NewOIDCRelyingParty discovers the endpoints of the identity provider, the context is also used to fetch its signing keys.
+func NewOIDCRelyingParty(ctx context.Context, config OIDCConfig) (*OIDCRelyingParty, error) {
+	if len(config.CookieSecret) < minOIDCCookieSecretLength {
+		return nil, fmt.Errorf("%w: the cookie secret has to be at least %d bytes long", ErrInvalidOIDCConfig, minOIDCCookieSecretLength)
+	}
+	if config.CookieName == "" || config.ClientID == "" {
+		return nil, fmt.Errorf("%w: the cookie name and the client id are required", ErrInvalidOIDCConfig)
+	}
+	redirectURL, err := url.Parse(config.RedirectURL)
+	if err != nil || !redirectURL.IsAbs() || redirectURL.Path == "" {
+		return nil, fmt.Errorf("%w: the redirect url %s has to be absolute with a path", ErrInvalidOIDCConfig, config.RedirectURL)
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	key := sha256.Sum256(config.CookieSecret)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("error setting up the cookie cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("error setting up the cookie cipher: %w", err)
+	}
+	provider, err := oidc.NewProvider(ctx, config.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("error discovering the oidc provider %s: %w", config.IssuerURL, err)
+	}
+	return &OIDCRelyingParty{
+		config: config,
+		oauth2: &oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  config.RedirectURL,
+			Scopes:       append([]string{oidc.ScopeOpenID}, config.Scopes...),
+		},
+		verifier:     provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+		callbackPath: redirectURL.Path,
+		aead:         aead,
+	}, nil
+}
+
+// GetOIDCClaims returns the claims of the user that has been authenticated by the OIDCHandler, nil if none
+func GetOIDCClaims(r *http.Request) *OIDCClaims {
+	claims, _ := r.Context().Value(OIDCClaimsKey).(*OIDCClaims)
+	return claims
+}
+
+// OIDCHandler requires an OIDC login for the protected path prefixes and handles the callback path. Unauthenticated GET and HEAD requests
+// are redirected to the identity provider, all other unauthenticated requests are answered with 401. The request path has to be cleaned
+// beforehand, see ValidateHandler. The claims of the session are stored in the request context.
+func OIDCHandler(next http.Handler, rp *OIDCRelyingParty) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == rp.callbackPath {
+			rp.callback(w, r)
+			return
+		}
+		if !hasAnyPathPrefix(r.URL.Path, rp.config.Prefixes) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		var claims OIDCClaims
+		if value, ok := readCookie(r, rp.config.CookieName); ok {
+			if err := rp.open(rp.config.CookieName, value, &claims); err == nil && time.Now().Unix() < claims.Expiry {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), OIDCClaimsKey, &claims)))
+				return
+			}
+			log.Ctx(r.Context()).Debug().Msg("Invalid or expired oidc session cookie")
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		rp.login(w, r)
+	})
+}
+
+// loginCookieName is the name of the cookie that holds the state of the login flow
+func (rp *OIDCRelyingParty) loginCookieName() string {
+	return rp.config.CookieName + "_login"
+}
+
+// login stores the state, nonce and PKCE verifier in the login cookie and redirects to the identity provider
+func (rp *OIDCRelyingParty) login(w http.ResponseWriter, r *http.Request) {
+	login := oidcLogin{
+		State:    rand.Text(),
+		Nonce:    rand.Text(),
+		Verifier: oauth2.GenerateVerifier(),
+		Target:   r.URL.RequestURI(),
+		Expiry:   time.Now().Add(oidcLoginTimeToLife).Unix(),
+	}
+	value, err := rp.seal(rp.loginCookieName(), login)
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("Error encrypting the oidc login cookie")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	// SameSite=Lax is required as the callback is a cross-site navigation from the identity provider
+	http.SetCookie(w, newCookie(rp.loginCookieName(), value, rp.callbackPath, oidcLoginTimeToLife, http.SameSiteLaxMode))
+	authURL := rp.oauth2.AuthCodeURL(login.State, oidc.Nonce(login.Nonce), oauth2.S256ChallengeOption(login.Verifier))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// callback verifies the login flow, exchanges the code for the ID token and sets the session cookie
+func (rp *OIDCRelyingParty) callback(w http.ResponseWriter, r *http.Request) {
+	var login oidcLogin
+	value, ok := readCookie(r, rp.loginCookieName())
+	if !ok || rp.open(rp.loginCookieName(), value, &login) != nil || time.Now().Unix() >= login.Expiry {
+		http.Error(w, "Missing or expired login", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, newCookie(rp.loginCookieName(), "", rp.callbackPath, -1, http.SameSiteLaxMode))
+	query := r.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(login.State)) != 1 {
+		http.Error(w, "Invalid state", http.StatusBadRequest)
+		return
+	}
+	if providerErr := query.Get("error"); providerErr != "" {
+		log.Ctx(r.Context()).Debug().Msgf("OIDC login failed: %s %s", providerErr, query.Get("error_description"))
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	token, err := rp.oauth2.Exchange(r.Context(), query.Get("code"), oauth2.VerifierOption(login.Verifier))
+	if err != nil {
+		log.Ctx(r.Context()).Warn().Err(err).Msg("Error exchanging the oidc authorization code")
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	claims, err := rp.verify(r.Context(), token, login.Nonce)
+	if err != nil {
+		log.Ctx(r.Context()).Warn().Err(err).Msg("Invalid oidc ID token")
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	if !rp.allowed(claims) {
+		log.Ctx(r.Context()).Debug().Msgf("OIDC user %s with email %s is not allowed", claims.Subject, claims.Email)
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	value, err = rp.seal(rp.config.CookieName, claims)
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("Error encrypting the oidc session cookie")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	// SameSite=Lax is required as the redirect chain has been started cross-site by the identity provider
+	http.SetCookie(w, newCookie(rp.config.CookieName, value, "/", rp.config.SessionDuration, http.SameSiteLaxMode))
+	http.Redirect(w, r, safeRedirectTarget(login.Target), http.StatusSeeOther)
+}
+
+// verify checks the signature, issuer, audience, expiry and nonce of the ID token and extracts the claims
+func (rp *OIDCRelyingParty) verify(ctx context.Context, token *oauth2.Token, nonce string) (*OIDCClaims, error) {
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response without id_token")
+	}
+	idToken, err := rp.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(nonce)) != 1 {
+		return nil, errors.New("invalid nonce")
+	}
+	var raw map[string]json.RawMessage
+	if err := idToken.Claims(&raw); err != nil {
+		return nil, err
+	}
+	claims := &OIDCClaims{Subject: idToken.Subject, Expiry: time.Now().Add(rp.config.SessionDuration).Unix()}
+	var email struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+	if err := idToken.Claims(&email); err != nil {
+		return nil, err
+	}
+	// unverified email addresses are dropped, they can not be used to check the domain. A missing email_verified claim counts as unverified.
+	if email.EmailVerified {
+		claims.Email = email.Email
+	}
+	if groups, ok := raw[rp.config.GroupsClaim]; ok {
+		if err := json.Unmarshal(groups, &claims.Groups); err != nil {
+			return nil, fmt.Errorf("invalid groups claim %s: %w", rp.config.GroupsClaim, err)
+		}
+	}
+	return claims, nil
+}
+
+// allowed checks the email domain and the groups, all users are allowed if neither are restricted
+func (rp *OIDCRelyingParty) allowed(claims *OIDCClaims) bool {
+	if len(rp.config.AllowedDomains) == 0 && len(rp.config.AllowedGroups) == 0 {
+		return true
+	}
+	if at := strings.LastIndex(claims.Email, "@"); at >= 0 {
+		domain := claims.Email[at+1:]
+		if slices.ContainsFunc(rp.config.AllowedDomains, func(allowed string) bool { return strings.EqualFold(allowed, domain) }) {
+			return true
+		}
+	}
+	return slices.ContainsFunc(claims.Groups, func(group string) bool { return slices.Contains(rp.config.AllowedGroups, group) })
+}
+
+// safeRedirectTarget only allows local paths to prevent open redirects
+func safeRedirectTarget(target string) string {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return "/"
+	}
+	return target
+}
+
+// seal encrypts the JSON value with AES-GCM, the cookie name is authenticated as well so that cookies can not be swapped
+func (rp *OIDCRelyingParty) seal(cookieName string, value any) (string, error) {
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, rp.aead.NonceSize(), rp.aead.NonceSize()+len(plaintext)+rp.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(rp.aead.Seal(nonce, nonce, plaintext, []byte(cookieName))), nil
+}
+
+// open decrypts the cookie value into the JSON value
+func (rp *OIDCRelyingParty) open(cookieName string, cookieValue string, value any) error {
+	ciphertext, err := base64.RawURLEncoding.DecodeString(cookieValue)
+	if err != nil || len(ciphertext) < rp.aead.NonceSize() {
+		return errInvalidCookie
+	}
+	plaintext, err := rp.aead.Open(nil, ciphertext[:rp.aead.NonceSize()], ciphertext[rp.aead.NonceSize():], []byte(cookieName))
+	if err != nil {
+		return errInvalidCookie
+	}
+	return json.Unmarshal(plaintext, value)
+}
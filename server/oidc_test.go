@@ -0,0 +1,305 @@
+package server_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/stretchr/testify/require"
+)
+
+const oidcClientID = "websrv"
+
+// mockIdP is a minimal OpenID Connect provider that issues ID tokens with the configured claims
+type mockIdP struct {
+	*httptest.Server
+	signer jose.Signer
+	claims map[string]any
+	mu     sync.Mutex
+	// codes maps the authorization codes to the PKCE challenge and nonce of the authorization request
+	codes map[string][2]string
+}
+
+func startMockIdP(t *testing.T, claims map[string]any) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: key, KeyID: "test"}}, nil)
+	require.NoError(t, err)
+	idp := &mockIdP{signer: signer, claims: claims, codes: make(map[string][2]string)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                idp.URL,
+			"authorization_endpoint":                idp.URL + "/authorize",
+			"token_endpoint":                        idp.URL + "/token",
+			"jwks_uri":                              idp.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"}}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("code_challenge_method") != "S256" || query.Get("client_id") != oidcClientID {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		code := rand.Text()
+		idp.mu.Lock()
+		idp.codes[code] = [2]string{query.Get("code_challenge"), query.Get("nonce")}
+		idp.mu.Unlock()
+		redirect, _ := url.Parse(query.Get("redirect_uri"))
+		redirect.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		request, ok := idp.codes[r.PostFormValue("code")]
+		delete(idp.codes, r.PostFormValue("code"))
+		idp.mu.Unlock()
+		challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(challenge[:]) != request[0] {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		idToken, err := jwt.Signed(idp.signer).Claims(jwt.Claims{
+			Issuer:   idp.URL,
+			Subject:  "user-1",
+			Audience: jwt.Audience{oidcClientID},
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+			Expiry:   jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		}).Claims(map[string]any{"nonce": request[1]}).Claims(idp.claims).Serialize()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "token", "token_type": "Bearer", "expires_in": 3600, "id_token": idToken})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func newOIDC(t *testing.T, idp *mockIdP, modify func(config *server.OIDCConfig)) *server.OIDCRelyingParty {
+	config := server.OIDCConfig{
+		IssuerURL:       idp.URL,
+		ClientID:        oidcClientID,
+		ClientSecret:    "secret",
+		RedirectURL:     "https://dashboard.example.com/oauth2/callback",
+		Scopes:          []string{"email"},
+		Prefixes:        []string{"/dashboard/"},
+		CookieName:      "websrv_session",
+		CookieSecret:    []byte(strings.Repeat("s", 32)),
+		SessionDuration: time.Hour,
+	}
+	if modify != nil {
+		modify(&config)
+	}
+	rp, err := server.NewOIDCRelyingParty(context.Background(), config)
+	require.NoError(t, err)
+	return rp
+}
+
+// claimsHandler answers with the email of the authenticated user
+var claimsHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if claims := server.GetOIDCClaims(r); claims != nil {
+		_, _ = w.Write([]byte(claims.Email))
+	}
+})
+
+func oidcRequest(handler http.Handler, method string, target string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, target, nil)
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func responseCookie(t *testing.T, w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	require.Failf(t, "cookie missing", "cookie %s not set", name)
+	return nil
+}
+
+// authorize follows the redirect to the identity provider and returns the callback path with code and state
+func authorize(t *testing.T, location string) string {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(location) //nolint:noctx // test
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	callback := mustParseURL(t, resp.Header.Get("Location"))
+	return callback.RequestURI()
+}
+
+// login runs the full login flow for the target and returns the response of the callback
+func login(t *testing.T, handler http.Handler, target string) *httptest.ResponseRecorder {
+	w := oidcRequest(handler, http.MethodGet, target)
+	require.Equal(t, http.StatusFound, w.Code)
+	loginCookie := responseCookie(t, w, "websrv_session_login")
+	require.Equal(t, "/oauth2/callback", loginCookie.Path)
+	require.Equal(t, http.SameSiteLaxMode, loginCookie.SameSite)
+	require.True(t, loginCookie.Secure)
+	require.True(t, loginCookie.HttpOnly)
+	return oidcRequest(handler, http.MethodGet, authorize(t, w.Header().Get("Location")), loginCookie)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := startMockIdP(t, map[string]any{"email": "alice@example.com", "email_verified": true})
+	handler := server.OIDCHandler(claimsHandler, newOIDC(t, idp, nil))
+
+	w := login(t, handler, "/dashboard/index.html?tab=1")
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	require.Equal(t, "/dashboard/index.html?tab=1", w.Header().Get("Location"))
+	session := responseCookie(t, w, "websrv_session")
+	require.Equal(t, 3600, session.MaxAge)
+	require.NotContains(t, session.Value, "alice")
+
+	w = oidcRequest(handler, http.MethodGet, "/dashboard/index.html", session)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "alice@example.com", w.Body.String())
+	w = oidcRequest(handler, http.MethodPost, "/dashboard/api", session)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// unauthenticated requests other than GET and HEAD are not redirected
+	require.Equal(t, http.StatusUnauthorized, oidcRequest(handler, http.MethodPost, "/dashboard/api").Code)
+	// paths without matching prefix are not protected
+	require.Equal(t, http.StatusOK, oidcRequest(handler, http.MethodGet, "/public").Code)
+	// tampered session cookies are rejected
+	tampered := []byte(session.Value)
+	tampered[len(tampered)/2] ^= 1
+	session.Value = string(tampered)
+	require.Equal(t, http.StatusFound, oidcRequest(handler, http.MethodGet, "/dashboard/", session).Code)
+}
+
+func TestOIDCRewrite(t *testing.T) {
+	idp := startMockIdP(t, map[string]any{"email": "alice@example.com", "email_verified": true})
+	rp := newOIDC(t, idp, func(config *server.OIDCConfig) { config.Prefixes = []string{"/admin/"} })
+	handler := server.OIDCHandler(rewriteHandler(t, claimsHandler, server.OIDC(rp)), rp)
+
+	require.Equal(t, http.StatusFound, oidcRequest(handler, http.MethodGet, "/pub/a").Code)
+	require.Equal(t, http.StatusUnauthorized, oidcRequest(handler, http.MethodPost, "/pub/a").Code)
+	w := login(t, handler, "/pub/a")
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	w = oidcRequest(handler, http.MethodGet, "/pub/a", responseCookie(t, w, "websrv_session"))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "alice@example.com", w.Body.String())
+}
+
+func TestOIDCAuthorizationRequest(t *testing.T) {
+	idp := startMockIdP(t, map[string]any{})
+	handler := server.OIDCHandler(claimsHandler, newOIDC(t, idp, nil))
+
+	w := oidcRequest(handler, http.MethodGet, "/dashboard/")
+	require.Equal(t, http.StatusFound, w.Code)
+	location := mustParseURL(t, w.Header().Get("Location"))
+	require.Equal(t, idp.URL+"/authorize", location.Scheme+"://"+location.Host+location.Path)
+	query := location.Query()
+	require.Equal(t, "code", query.Get("response_type"))
+	require.Equal(t, "openid email", query.Get("scope"))
+	require.Equal(t, "https://dashboard.example.com/oauth2/callback", query.Get("redirect_uri"))
+	require.Equal(t, "S256", query.Get("code_challenge_method"))
+	require.NotEmpty(t, query.Get("code_challenge"))
+	require.NotEmpty(t, query.Get("state"))
+	require.NotEmpty(t, query.Get("nonce"))
+	// the state and nonce are not reused
+	second := mustParseURL(t, oidcRequest(handler, http.MethodGet, "/dashboard/").Header().Get("Location")).Query()
+	require.NotEqual(t, query.Get("state"), second.Get("state"))
+	require.NotEqual(t, query.Get("nonce"), second.Get("nonce"))
+}
+
+func TestOIDCAllowed(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims map[string]any
+		code   int
+	}{
+		{name: "allowed domain", claims: map[string]any{"email": "alice@Example.com", "email_verified": true}, code: http.StatusSeeOther},
+		{name: "other domain", claims: map[string]any{"email": "alice@example.org", "email_verified": true}, code: http.StatusForbidden},
+		{name: "domain suffix", claims: map[string]any{"email": "alice@evilexample.com", "email_verified": true}, code: http.StatusForbidden},
+		{name: "unverified email", claims: map[string]any{"email": "alice@example.com", "email_verified": false}, code: http.StatusForbidden},
+		{name: "missing email_verified", claims: map[string]any{"email": "alice@example.com"}, code: http.StatusForbidden},
+		{name: "allowed group", claims: map[string]any{"email": "bob@example.org", "roles": []string{"dev", "ops"}}, code: http.StatusSeeOther},
+		{name: "other group", claims: map[string]any{"roles": []string{"dev"}}, code: http.StatusForbidden},
+		{name: "no claims", claims: map[string]any{}, code: http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			idp := startMockIdP(t, test.claims)
+			rp := newOIDC(t, idp, func(config *server.OIDCConfig) {
+				config.AllowedDomains = []string{"example.com"}
+				config.AllowedGroups = []string{"ops"}
+				config.GroupsClaim = "roles"
+			})
+			w := login(t, server.OIDCHandler(claimsHandler, rp), "/dashboard/")
+			require.Equal(t, test.code, w.Code)
+			if test.code != http.StatusSeeOther {
+				for _, cookie := range w.Result().Cookies() {
+					require.NotEqual(t, "websrv_session", cookie.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackErrors(t *testing.T) {
+	idp := startMockIdP(t, map[string]any{})
+	handler := server.OIDCHandler(claimsHandler, newOIDC(t, idp, nil))
+	w := oidcRequest(handler, http.MethodGet, "/dashboard/")
+	loginCookie := responseCookie(t, w, "websrv_session_login")
+	callback := authorize(t, w.Header().Get("Location"))
+
+	// missing login cookie
+	require.Equal(t, http.StatusBadRequest, oidcRequest(handler, http.MethodGet, callback).Code)
+	// state mismatch
+	require.Equal(t, http.StatusBadRequest, oidcRequest(handler, http.MethodGet, "/oauth2/callback?code=x&state=y", loginCookie).Code)
+	// login cookie of another login flow
+	otherLogin := responseCookie(t, oidcRequest(handler, http.MethodGet, "/dashboard/"), "websrv_session_login")
+	require.Equal(t, http.StatusBadRequest, oidcRequest(handler, http.MethodGet, callback, otherLogin).Code)
+	session := responseCookie(t, oidcRequest(handler, http.MethodGet, callback, loginCookie), "websrv_session")
+	// replayed codes are rejected by the identity provider
+	require.Equal(t, http.StatusBadGateway, oidcRequest(handler, http.MethodGet, callback, loginCookie).Code)
+	// the session cookie can not be used as login cookie
+	session.Name = "websrv_session_login"
+	require.Equal(t, http.StatusBadRequest, oidcRequest(handler, http.MethodGet, callback, session).Code)
+}
+
+func TestOIDCInvalidConfig(t *testing.T) {
+	idp := startMockIdP(t, map[string]any{})
+	for _, modify := range []func(config *server.OIDCConfig){
+		func(config *server.OIDCConfig) { config.CookieSecret = []byte("short") },
+		func(config *server.OIDCConfig) { config.RedirectURL = "/oauth2/callback" },
+		func(config *server.OIDCConfig) { config.ClientID = "" },
+	} {
+		config := server.OIDCConfig{
+			IssuerURL: idp.URL, ClientID: oidcClientID, RedirectURL: "https://dashboard.example.com/oauth2/callback",
+			CookieName: "websrv_session", CookieSecret: []byte(strings.Repeat("s", 32)),
+		}
+		modify(&config)
+		_, err := server.NewOIDCRelyingParty(context.Background(), config)
+		require.ErrorIs(t, err, server.ErrInvalidOIDCConfig)
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// hashedFileNameRegex matches the last file name part in front of the file extension, e.g. 3f9a1c for main.3f9a1c.js or BxYz12Ab for index-BxYz12Ab.js
+var hashedFileNameRegex = regexp.MustCompile(`[.-]([0-9A-Za-z_]+)\.[0-9A-Za-z]+$`)
+
+// dimensionRegex matches image dimensions like 1024x1024 in file names, which are no content hashes
+var dimensionRegex = regexp.MustCompile(`^[0-9]+x[0-9]+$`)
+
+const (
+	// minHexHashLength is the minimal length of hexadecimal content hashes in file names
+	minHexHashLength = 6
+	// minBase64HashLength is the minimal length of url-safe base64 content hashes in file names
+	minBase64HashLength = 8
+)
+
+// PathMatch holds the conditions for a PathMatcher. Empty conditions are ignored.
+type PathMatch struct {
+	// Prefix is a path prefix like /fonts/
+	Prefix string
+	// Glob is a path pattern where * and ? match within a path segment and ** matches across path segments, e.g. /assets/**.js
+	Glob string
+	// Regex is a regular expression that has to match the path
+	Regex string
+	// Hashed only matches file names that contain a content hash like main.3f9a1c.js
+	Hashed bool
+}
+
+// PathMatcher matches request paths against precompiled conditions. All conditions have to be fulfilled, an empty PathMatcher matches all paths.
+type PathMatcher struct {
+	prefix string
+	glob   *regexp.Regexp
+	regex  *regexp.Regexp
+	hashed bool
+}
+
+// NewPathMatcher compiles the PathMatch conditions into a PathMatcher.
+func NewPathMatcher(match PathMatch) (*PathMatcher, error) {
+	matcher := &PathMatcher{prefix: match.Prefix, hashed: match.Hashed}
+	var err error
+	if match.Glob != "" {
+		matcher.glob, err = compileGlob(match.Glob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %s: %w", match.Glob, err)
+		}
+	}
+	if match.Regex != "" {
+		matcher.regex, err = regexp.Compile(match.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex %s: %w", match.Regex, err)
+		}
+	}
+	return matcher, nil
+}
+
+// Matches checks whether the request path fulfills all conditions.
+func (matcher *PathMatcher) Matches(requestPath string) bool {
+	if !hasPathPrefix(requestPath, matcher.prefix) {
+		return false
+	}
+	if matcher.glob != nil && !matcher.glob.MatchString(requestPath) {
+		return false
+	}
+	if matcher.regex != nil && !matcher.regex.MatchString(requestPath) {
+		return false
+	}
+	if matcher.hashed && !IsHashedFileName(path.Base(requestPath)) {
+		return false
+	}
+	return true
+}
+
+// IsHashedFileName detects file names that contain a content hash like main.3f9a1c.js, main.3f9a1c2b4d5e6f7a.js or index-BxYz12Ab.js.
+// The hash is either hexadecimal with at least 6 characters and at least one letter or url-safe base64 with at least 8 characters
+// that contains letters as well as digits. Numbers like dates in report-20240101.pdf and dimensions like 1024x1024 are no hashes.
+func IsHashedFileName(fileName string) bool {
+	match := hashedFileNameRegex.FindStringSubmatch(fileName)
+	if match == nil {
+		return false
+	}
+	hash := match[1]
+	if len(hash) >= minHexHashLength && strings.Trim(hash, "0123456789abcdef") == "" && strings.ContainsAny(hash, "abcdef") {
+		return true
+	}
+	return len(hash) >= minBase64HashLength && strings.ContainsAny(hash, "0123456789") &&
+		strings.Trim(hash, "0123456789_") != "" && !dimensionRegex.MatchString(hash)
+}
+
+// compileGlob converts the glob pattern into an anchored regular expression.
+func compileGlob(glob string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch glob[i] {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				sb.WriteString(".*")
+				i++
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// hasPathPrefix checks whether the request path starts with the prefix. A prefix with a trailing slash like /admin/ also matches
+// the path without it (/admin), as the trailing slash is removed when the request path is cleaned, see ValidateHandler.
+func hasPathPrefix(requestPath string, prefix string) bool {
+	return strings.HasPrefix(requestPath, prefix) || (strings.HasSuffix(prefix, "/") && requestPath == strings.TrimSuffix(prefix, "/"))
+}
+
+// hasAnyPathPrefix checks whether one of the prefixes matches the request path, all paths match if there are no prefixes
+func hasAnyPathPrefix(requestPath string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(prefixes, func(prefix string) bool { return hasPathPrefix(requestPath, prefix) })
+}
+
+// prefixRule is a rule for the request paths with its prefix, an empty prefix matches all paths
+type prefixRule interface {
+	pathPrefix() string
+}
+
+// sortByPrefixLength returns a copy of the rules sorted by descending prefix length, see longestPrefixMatch
+func sortByPrefixLength[T prefixRule](rules []T) []T {
+	rules = slices.Clone(rules)
+	slices.SortStableFunc(rules, func(a T, b T) int {
+		return cmp.Compare(len(b.pathPrefix()), len(a.pathPrefix()))
+	})
+	return rules
+}
+
+// longestPrefixMatch returns the rule with the longest matching prefix, the rules have to be sorted via sortByPrefixLength
+func longestPrefixMatch[T prefixRule](rules []T, requestPath string) (T, bool) {
+	for _, rule := range rules {
+		if hasPathPrefix(requestPath, rule.pathPrefix()) {
+			return rule, true
+		}
+	}
+	var none T
+	return none, false
+}
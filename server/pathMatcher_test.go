@@ -0,0 +1,57 @@
+package server_test
+
+import (
+	"testing"
+
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsHashedFileName(t *testing.T) {
+	for _, fileName := range []string{"main.3f9a1c.js", "main.3f9a1c2b4d5e6f7a.js", "index-BxYz12Ab.js", "styles.0ab34c21.css", "chunk-4AB7XDQF.js"} {
+		require.True(t, server.IsHashedFileName(fileName), fileName)
+	}
+	for _, fileName := range []string{"main.js", "index.html", "jquery.min.js", "bootstrap.bundle.js", "logo-2x.png", "index-Abcdefgh.js", "favicon.ico",
+		"report-20240101.pdf", "build.123456.js", "logo-1024x1024.png", "photo.1920x1080.jpg"} {
+		require.False(t, server.IsHashedFileName(fileName), fileName)
+	}
+}
+
+func TestPathMatcherGlob(t *testing.T) {
+	matcher, err := server.NewPathMatcher(server.PathMatch{Glob: "/assets/*.js"})
+	require.NoError(t, err)
+	require.True(t, matcher.Matches("/assets/main.js"))
+	require.False(t, matcher.Matches("/assets/sub/main.js"))
+	require.False(t, matcher.Matches("/assets/main.css"))
+
+	matcher, err = server.NewPathMatcher(server.PathMatch{Glob: "/assets/**.js"})
+	require.NoError(t, err)
+	require.True(t, matcher.Matches("/assets/sub/main.js"))
+	require.False(t, matcher.Matches("/other/main.js"))
+}
+
+func TestPathMatcherCombined(t *testing.T) {
+	matcher, err := server.NewPathMatcher(server.PathMatch{Regex: `\.js$`, Hashed: true})
+	require.NoError(t, err)
+	require.True(t, matcher.Matches("/main.3f9a1c.js"))
+	require.False(t, matcher.Matches("/main.js"))
+	require.False(t, matcher.Matches("/styles.3f9a1c.css"))
+
+	matcher, err = server.NewPathMatcher(server.PathMatch{Prefix: "/fonts/", Glob: "/**.woff2"})
+	require.NoError(t, err)
+	require.True(t, matcher.Matches("/fonts/roboto.woff2"))
+	require.False(t, matcher.Matches("/roboto.woff2"))
+	require.False(t, matcher.Matches("/fonts/roboto.ttf"))
+
+	matcher, err = server.NewPathMatcher(server.PathMatch{Prefix: "/fonts/"})
+	require.NoError(t, err)
+	require.True(t, matcher.Matches("/fonts"))
+	require.False(t, matcher.Matches("/fontsfoo"))
+
+	matcher, err = server.NewPathMatcher(server.PathMatch{})
+	require.NoError(t, err)
+	require.True(t, matcher.Matches("/anything"))
+
+	_, err = server.NewPathMatcher(server.PathMatch{Regex: "("})
+	require.Error(t, err)
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/ngergs/websrv/v5/internal/utils"
+)
+
+// PrecompressedHandler serves precompressed sidecar files like main.js.br or main.js.gz that reside next to the requested main.js in the fsys.
+// The encoding is negotiated from the Accept-Encoding HTTP-Header, the encodings order is used as server preference.
+// If a sidecar is used the request path is rewritten to the sidecar before calling the next handler, the Content-Encoding and
+// the Content-Type of the original file (according to the mediaTypeMap with a fallback on the mime package) are set.
+// The Vary HTTP-Header is set whenever a sidecar is present, duplicates from next handlers (e.g. dynamic compression) are removed
+// before the headers are sent. Next handlers should not overwrite an already set Content-Encoding.
+// For a SnapshotFS the snapshot is pinned to the request, see CacheHandler.
+func PrecompressedHandler(next http.Handler, fsys fs.FS, mediaTypeMap map[string]string, encodings ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, release := pinSnapshot(r, fsys)
+		defer release()
+		snapshot := pinnedSnapshot(r, fsys)
+		name := resolveFileName(snapshot, r.URL.Path)
+		available := make([]string, 0, len(encodings))
+		for _, encoding := range encodings {
+			if isFile(snapshot, name+utils.SidecarExtensions[encoding]) {
+				available = append(available, encoding)
+			}
+		}
+		if len(available) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		wrappedW := beforeWriteHeader(w, func(int) {
+			dedupeHeaderValues(w.Header(), "Vary")
+		})
+		encoding := NegotiateEncoding(r.Header.Get("Accept-Encoding"), available...)
+		if encoding == "" {
+			next.ServeHTTP(wrappedW, r)
+			return
+		}
+		w.Header().Set("Content-Encoding", encoding)
+		w.Header().Set("Content-Type", getMediaType(mediaTypeMap, path.Ext(name)))
+		sidecarUrl := *r.URL
+		sidecarUrl.Path = "/" + name + utils.SidecarExtensions[encoding]
+		sidecarUrl.RawPath = ""
+		sidecarRequest := r.Clone(r.Context())
+		sidecarRequest.URL = &sidecarUrl
+		next.ServeHTTP(wrappedW, sidecarRequest)
+	})
+}
+
+// dedupeHeaderValues removes duplicate comma-separated values of the HTTP header, header values are compared case-insensitive.
+func dedupeHeaderValues(header http.Header, key string) {
+	values := header.Values(key)
+	deduped := make([]string, 0, len(values))
+	for _, value := range values {
+		for _, token := range strings.Split(value, ",") {
+			token = strings.TrimSpace(token)
+			if token != "" && !slices.ContainsFunc(deduped, func(other string) bool { return strings.EqualFold(token, other) }) {
+				deduped = append(deduped, token)
+			}
+		}
+	}
+	header.Set(key, strings.Join(deduped, ", "))
+}
+
+// resolveFileName converts the request path into a fs.FS file name. Directories are resolved to their index.html.
+func resolveFileName(fsys fs.FS, requestPath string) string {
+	name := strings.TrimPrefix(path.Clean(requestPath), "/")
+	if name == "" {
+		name = "."
+	}
+	if stat, err := fs.Stat(fsys, name); err == nil && stat.IsDir() {
+		return path.Join(name, "index.html")
+	}
+	return name
+}
+
+// isFile checks whether the name exists in the fsys and is not a directory
+func isFile(fsys fs.FS, name string) bool {
+	stat, err := fs.Stat(fsys, name)
+	return err == nil && !stat.IsDir()
+}
+
+// getMediaType returns the media type for the file extension from the mediaTypeMap with a fallback on the mime package.
+func getMediaType(mediaTypeMap map[string]string, extension string) string {
+	if mediaType, ok := mediaTypeMap[extension]; ok {
+		return mediaType
+	}
+	if mediaType := mime.TypeByExtension(extension); mediaType != "" {
+		return mediaType
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,80 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/stretchr/testify/require"
+)
+
+var precompressedFs = fstest.MapFS{
+	"main.js":            {Data: []byte("plain")},
+	"main.js.br":         {Data: []byte("brotli")},
+	"main.js.gz":         {Data: []byte("gzip")},
+	"style.css":          {Data: []byte("plain")},
+	"sub/index.html":     {Data: []byte("plain")},
+	"sub/index.html.zst": {Data: []byte("zstd")},
+}
+
+func TestPrecompressedSidecar(t *testing.T) {
+	w, r, next := getDefaultHandlerMocks()
+	handler := server.PrecompressedHandler(next, precompressedFs, map[string]string{".js": "text/javascript"}, "br", "zstd", "gzip")
+	r.URL = &url.URL{Path: "/main.js"}
+	r.Header.Set("Accept-Encoding", "gzip, br;q=0.5")
+	handler.ServeHTTP(w, r)
+	require.Equal(t, "/main.js.gz", next.r.URL.Path)
+	require.Equal(t, "/main.js", r.URL.Path)
+	require.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	require.Equal(t, "text/javascript", w.Header().Get("Content-Type"))
+	require.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+}
+
+func TestPrecompressedDirectoryIndex(t *testing.T) {
+	w, r, next := getDefaultHandlerMocks()
+	handler := server.PrecompressedHandler(next, precompressedFs, nil, "br", "zstd", "gzip")
+	r.URL = &url.URL{Path: "/sub/"}
+	r.Header.Set("Accept-Encoding", "zstd")
+	handler.ServeHTTP(w, r)
+	require.Equal(t, "/sub/index.html.zst", next.r.URL.Path)
+	require.Equal(t, "zstd", w.Header().Get("Content-Encoding"))
+	require.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+}
+
+func TestPrecompressedNotAccepted(t *testing.T) {
+	w, r, next := getDefaultHandlerMocks()
+	handler := server.PrecompressedHandler(next, precompressedFs, nil, "br", "zstd", "gzip")
+	r.URL = &url.URL{Path: "/main.js"}
+	r.Header.Set("Accept-Encoding", "zstd")
+	handler.ServeHTTP(w, r)
+	require.Equal(t, "/main.js", next.r.URL.Path)
+	require.Empty(t, w.Header().Get("Content-Encoding"))
+	require.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+}
+
+func TestPrecompressedNoSidecar(t *testing.T) {
+	w, r, next := getDefaultHandlerMocks()
+	handler := server.PrecompressedHandler(next, precompressedFs, nil, "br", "zstd", "gzip")
+	r.URL = &url.URL{Path: "/style.css"}
+	r.Header.Set("Accept-Encoding", "br")
+	handler.ServeHTTP(w, r)
+	require.Equal(t, http.Header{}, w.Header())
+	require.Equal(t, "/style.css", next.r.URL.Path)
+}
+
+func TestPrecompressedDynamicCompressionVary(t *testing.T) {
+	fsys := &mockETagFs{MapFS: precompressedFs, eTags: map[string]string{"main.js": eTag}}
+	handler := server.Precompressed(fsys, nil, "br")(
+		server.Caching(fsys)(middleware.Compress(5, "text/javascript")(server.FileServer(fsys))))
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/main.js", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	require.Equal(t, []string{"Accept-Encoding"}, w.Header().Values("Vary"))
+}
@@ -0,0 +1,272 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// defaultHealthCheckInterval is used if the health check path is set without interval
+const defaultHealthCheckInterval = 10 * time.Second
+
+var (
+	ErrInvalidProxyRoute = errors.New("proxy routes require a prefix starting with a slash and at least one absolute http(s) upstream URL")
+	ErrNoHealthyUpstream = errors.New("no healthy upstream")
+)
+
+// ProxyRoute forwards the requests with the path Prefix to the Upstreams
+type ProxyRoute struct {
+	// Prefix is the path prefix like /api/
+	Prefix string
+	// Upstreams are the base URLs of the backends, the requests are distributed round-robin between the healthy ones
+	Upstreams []*url.URL
+	// StripPrefix removes the Prefix from the path before it is appended to the upstream URL
+	StripPrefix bool
+	// PreserveHost forwards the Host header of the client instead of the upstream host
+	PreserveHost bool
+	// RequestHeaders are applied to the request before it is forwarded, after the X-Forwarded-* headers have been set
+	RequestHeaders HeaderRewrite
+	// ResponseHeaders are applied to the upstream response
+	ResponseHeaders HeaderRewrite
+	// ConnectTimeout bounds establishing the connection to an upstream, zero means no timeout
+	ConnectTimeout time.Duration
+	// Timeout bounds the wait for the upstream response headers, zero means no timeout
+	Timeout time.Duration
+	// Retries is the number of retries with the next upstream for idempotent requests without body that failed with a connection error
+	Retries int
+	// HealthCheck holds the configuration for active upstream health checks
+	HealthCheck HealthCheck
+}
+
+// HeaderRewrite deletes and sets HTTP headers
+type HeaderRewrite struct {
+	Set    map[string]string
+	Delete []string
+}
+
+// apply deletes and then sets the headers
+func (rewrite *HeaderRewrite) apply(header http.Header) {
+	for _, key := range rewrite.Delete {
+		header.Del(key)
+	}
+	for key, value := range rewrite.Set {
+		header.Set(key, value)
+	}
+}
+
+// HealthCheck holds the configuration for active upstream health checks. Upstreams are healthy if the Path answers with a status code below 400.
+type HealthCheck struct {
+	// Path is requested on every upstream, empty disables the health checks
+	Path string
+	// Interval between the health checks, defaults to 10s
+	Interval time.Duration
+	// Timeout of a single health check request, zero means no timeout
+	Timeout time.Duration
+}
+
+// upstream is a backend with its health state
+type upstream struct {
+	url     *url.URL
+	healthy atomic.Bool
+}
+
+// upstreamPool distributes the requests round-robin between the healthy upstreams
+type upstreamPool struct {
+	upstreams []*upstream
+	counter   atomic.Uint64
+}
+
+// next returns the next healthy upstream, nil if all upstreams are unhealthy
+func (pool *upstreamPool) next() *upstream {
+	start := pool.counter.Add(1)
+	for i := range uint64(len(pool.upstreams)) {
+		candidate := pool.upstreams[(start+i)%uint64(len(pool.upstreams))]
+		if candidate.healthy.Load() {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// healthCheck checks the health of all upstreams every interval till the context is cancelled. Blocks till then.
+func (pool *upstreamPool) healthCheck(ctx context.Context, client *http.Client, check HealthCheck) {
+	if check.Interval <= 0 {
+		check.Interval = defaultHealthCheckInterval
+	}
+	ticker := time.NewTicker(check.Interval)
+	defer ticker.Stop()
+	for {
+		for _, target := range pool.upstreams {
+			healthy := isHealthy(ctx, client, joinURLPath(target.url, check.Path), check.Timeout)
+			if target.healthy.Swap(healthy) != healthy {
+				log.Warn().Msgf("Upstream %s changed health state to healthy=%t", target.url, healthy)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// isHealthy requests the URL and checks for a status code below 400
+func isHealthy(ctx context.Context, client *http.Client, target *url.URL, timeout time.Duration) bool {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Health check of %s failed", target)
+		return false
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode < http.StatusBadRequest
+}
+
+// joinURLPath returns a copy of the base URL with the path appended
+func joinURLPath(base *url.URL, requestPath string) *url.URL {
+	result := *base
+	basePath := strings.TrimSuffix(base.Path, "/")
+	if basePath != "" && !strings.HasPrefix(basePath, "/") {
+		basePath = "/" + basePath
+	}
+	result.Path = basePath + "/" + strings.TrimPrefix(requestPath, "/")
+	result.RawPath = ""
+	return &result
+}
+
+// isRetryable checks whether the request is idempotent and has no body that would have to be replayed
+func isRetryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return req.Body == nil || req.Body == http.NoBody
+	default:
+		return false
+	}
+}
+
+// upstreamTransport sends the requests to the next healthy upstream and retries retryable requests on connection errors
+type upstreamTransport struct {
+	next    http.RoundTripper
+	pool    *upstreamPool
+	retries int
+}
+
+// RoundTrip implements http.RoundTripper
+func (transport *upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	attempts := 1
+	if isRetryable(req) {
+		attempts += transport.retries
+	}
+	var err error
+	for attempt := range attempts {
+		target := transport.pool.next()
+		if target == nil {
+			return nil, ErrNoHealthyUpstream
+		}
+		out := req.Clone(req.Context())
+		targetURL := joinURLPath(target.url, req.URL.Path)
+		targetURL.RawQuery = req.URL.RawQuery
+		out.URL = targetURL
+		var resp *http.Response
+		resp, err = transport.next.RoundTrip(out)
+		if err == nil {
+			return resp, nil
+		}
+		if req.Context().Err() != nil {
+			return nil, err
+		}
+		log.Warn().Err(err).Msgf("Proxy attempt %d of %d to %s failed", attempt+1, attempts, target.url)
+	}
+	return nil, err
+}
+
+// proxyErrorHandler answers with 503 if no upstream is healthy, 504 on timeouts and 502 otherwise
+func proxyErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	log.Error().Err(err).Msgf("Error proxying %s", r.URL.Path)
+	status := http.StatusBadGateway
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrNoHealthyUpstream):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		status = http.StatusGatewayTimeout
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+// NewProxyHandler returns a reverse proxy for the route, the health checks run till the context is cancelled.
+// The X-Forwarded-For, X-Forwarded-Host and X-Forwarded-Proto headers are set for the client, incoming values are discarded.
+// X-Forwarded-For holds the client IP, see GetClientIP.
+func NewProxyHandler(ctx context.Context, route ProxyRoute) (http.Handler, error) {
+	prefix := strings.TrimSuffix(route.Prefix, "/")
+	if !strings.HasPrefix(route.Prefix, "/") || len(route.Upstreams) == 0 {
+		return nil, ErrInvalidProxyRoute
+	}
+	pool := &upstreamPool{upstreams: make([]*upstream, len(route.Upstreams))}
+	for i, upstreamURL := range route.Upstreams {
+		if upstreamURL.Scheme != "http" && upstreamURL.Scheme != "https" || upstreamURL.Host == "" {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidProxyRoute, upstreamURL)
+		}
+		pool.upstreams[i] = &upstream{url: upstreamURL}
+		pool.upstreams[i].healthy.Store(true)
+	}
+
+	// same as the http.DefaultTransport apart from the timeouts
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: route.ConnectTimeout, KeepAlive: 30 * time.Second}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		ResponseHeaderTimeout: route.Timeout,
+	}
+	if route.HealthCheck.Path != "" {
+		client := &http.Client{Transport: transport, CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+		go pool.healthCheck(ctx, client, route.HealthCheck)
+	}
+
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			if route.StripPrefix {
+				pr.Out.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(pr.In.URL.Path, prefix), "/")
+				pr.Out.URL.RawPath = ""
+			}
+			pr.SetXForwarded()
+			// behind trusted proxies the direct peer is not the client, see RealIPHandler
+			if isForwarded(pr.In) {
+				pr.Out.Header.Set("X-Forwarded-For", GetClientIP(pr.In).String())
+			}
+			if !route.PreserveHost {
+				pr.Out.Host = ""
+			}
+			route.RequestHeaders.apply(pr.Out.Header)
+		},
+		Transport: &upstreamTransport{next: transport, pool: pool, retries: route.Retries},
+		ModifyResponse: func(resp *http.Response) error {
+			route.ResponseHeaders.apply(resp.Header)
+			return nil
+		},
+		ErrorHandler: proxyErrorHandler,
+	}, nil
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+var ProxyProtocolKey = &ContextKey{val: "proxyProtocol"}
+
+// ProxyProtocol wraps listeners to parse PROXY protocol v1 and v2 headers from the allowed upstreams like load balancers.
+// The RemoteAddr of the requests is the source address of the header, see also GetProxyProtocol.
+type ProxyProtocol struct {
+	allowed           []netip.Prefix
+	strict            bool
+	readHeaderTimeout time.Duration
+}
+
+// ProxyProtocolInfo holds the addresses of a connection that has been established via the PROXY protocol
+type ProxyProtocolInfo struct {
+	// Source is the client address from the PROXY header
+	Source net.Addr
+	// Destination is the address the client connected to from the PROXY header
+	Destination net.Addr
+	// Peer is the address of the upstream that has sent the PROXY header
+	Peer net.Addr
+}
+
+// NewProxyProtocol parses the CIDRs of the upstreams that are allowed to send the PROXY header. In strict mode the allowed upstreams
+// have to send the header and connections from all other upstreams that send it are closed. In lenient mode the header is optional
+// for the allowed upstreams and ignored for all other upstreams. The readHeaderTimeout defaults to 10s if zero.
+func NewProxyProtocol(strict bool, readHeaderTimeout time.Duration, allowed ...string) (*ProxyProtocol, error) {
+	result := &ProxyProtocol{allowed: make([]netip.Prefix, len(allowed)), strict: strict, readHeaderTimeout: readHeaderTimeout}
+	for i, cidr := range allowed {
+		prefix, err := parsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+		result.allowed[i] = prefix
+	}
+	return result, nil
+}
+
+// policy decides per upstream whether the PROXY header is required, optional, ignored or rejected
+func (proxyProtocol *ProxyProtocol) policy(options proxyproto.ConnPolicyOptions) (proxyproto.Policy, error) {
+	upstream := remoteAddr(options.Upstream.String())
+	allowed := false
+	for _, prefix := range proxyProtocol.allowed {
+		if prefix.Contains(upstream) {
+			allowed = true
+			break
+		}
+	}
+	switch {
+	case allowed && proxyProtocol.strict:
+		return proxyproto.REQUIRE, nil
+	case allowed:
+		return proxyproto.USE, nil
+	case proxyProtocol.strict:
+		return proxyproto.REJECT, nil
+	default:
+		return proxyproto.IGNORE, nil
+	}
+}
+
+// Listener wraps the listener to parse the PROXY headers
+func (proxyProtocol *ProxyProtocol) Listener(l net.Listener) net.Listener {
+	return &proxyproto.Listener{
+		Listener:          l,
+		ConnPolicy:        proxyProtocol.policy,
+		ReadHeaderTimeout: proxyProtocol.readHeaderTimeout,
+	}
+}
+
+// connContext stores the connection in the context, the PROXY header is read lazily by GetProxyProtocol to not block the accept loop.
+// TLS connections are unwrapped as the TLS listener wraps the connections of the PROXY protocol listener.
+func connContext(ctx context.Context, conn net.Conn) context.Context {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	if proxyConn, ok := conn.(*proxyproto.Conn); ok {
+		return context.WithValue(ctx, ProxyProtocolKey, proxyConn)
+	}
+	return ctx
+}
+
+// GetProxyProtocol returns the addresses of the PROXY header, nil if the connection has not been established via the PROXY protocol
+func GetProxyProtocol(r *http.Request) *ProxyProtocolInfo {
+	proxyConn, ok := r.Context().Value(ProxyProtocolKey).(*proxyproto.Conn)
+	if !ok {
+		return nil
+	}
+	header := proxyConn.ProxyHeader()
+	if header == nil {
+		return nil
+	}
+	return &ProxyProtocolInfo{Source: header.SourceAddr, Destination: header.DestinationAddr, Peer: proxyConn.Raw().RemoteAddr()}
+}
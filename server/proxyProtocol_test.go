@@ -0,0 +1,141 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/pires/go-proxyproto"
+	"github.com/stretchr/testify/require"
+)
+
+// startProxyProtocolServer starts a server that answers with the RemoteAddr and the PROXY header source address
+func startProxyProtocolServer(t *testing.T, strict bool, allowed ...string) string {
+	return startProxyProtocolTLSServer(t, nil, strict, allowed...)
+}
+
+// startProxyProtocolTLSServer is startProxyProtocolServer that terminates TLS if the tlsConfig is set
+func startProxyProtocolTLSServer(t *testing.T, tlsConfig *tls.Config, strict bool, allowed ...string) string {
+	proxyProtocol, err := server.NewProxyProtocol(strict, time.Second, allowed...)
+	require.NoError(t, err)
+	port := unusedPort(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		source := "none"
+		if info := server.GetProxyProtocol(r); info != nil {
+			source = info.Source.String() + " via " + info.Peer.String()
+		}
+		_, _ = w.Write([]byte(r.RemoteAddr + " " + source))
+	})
+	srv := server.Build(uint16(port), time.Second, time.Second, time.Second, false, handler) //nolint:gosec // valid port
+	srv.TLSConfig = tlsConfig
+	srv.UseProxyProtocol(proxyProtocol)
+	ctx, cancel := context.WithCancel(context.Background())
+	errChan := make(chan error, 1)
+	srv.ListenGoServe(ctx, errChan)
+	t.Cleanup(func() {
+		cancel()
+		_ = srv.Close()
+	})
+	return "127.0.0.1:" + strconv.Itoa(port)
+}
+
+// proxyProtocolRequest sends a GET request with an optional PROXY header and returns the body, an error if the connection has been closed
+func proxyProtocolRequest(t *testing.T, addr string, header *proxyproto.Header) (string, error) {
+	return proxyProtocolTLSRequest(t, addr, nil, header)
+}
+
+// proxyProtocolTLSRequest is proxyProtocolRequest that establishes a TLS connection after the PROXY header if the tlsConfig is set
+func proxyProtocolTLSRequest(t *testing.T, addr string, tlsConfig *tls.Config, header *proxyproto.Header) (string, error) {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	if header != nil {
+		_, err = header.WriteTo(conn)
+		require.NoError(t, err)
+	}
+	if tlsConfig != nil {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body), nil
+}
+
+func proxyHeader(version byte) *proxyproto.Header {
+	return &proxyproto.Header{
+		Version:           version,
+		Command:           proxyproto.PROXY,
+		TransportProtocol: proxyproto.TCPv4,
+		SourceAddr:        &net.TCPAddr{IP: net.ParseIP("203.0.113.1"), Port: 4711},
+		DestinationAddr:   &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 443},
+	}
+}
+
+func TestProxyProtocolStrict(t *testing.T) {
+	addr := startProxyProtocolServer(t, true, "127.0.0.1")
+	for _, version := range []byte{1, 2} {
+		body, err := proxyProtocolRequest(t, addr, proxyHeader(version))
+		require.NoError(t, err)
+		require.Regexp(t, `^203\.0\.113\.1:4711 203\.0\.113\.1:4711 via 127\.0\.0\.1:\d+$`, body, version)
+	}
+	// the allowed upstreams have to send the header
+	_, err := proxyProtocolRequest(t, addr, nil)
+	require.Error(t, err)
+
+	// other upstreams must not send the header
+	addr = startProxyProtocolServer(t, true, "10.0.0.0/8")
+	_, err = proxyProtocolRequest(t, addr, proxyHeader(2))
+	require.Error(t, err)
+	body, err := proxyProtocolRequest(t, addr, nil)
+	require.NoError(t, err)
+	require.Regexp(t, `^127\.0\.0\.1:\d+ none$`, body)
+}
+
+func TestProxyProtocolLenient(t *testing.T) {
+	addr := startProxyProtocolServer(t, false, "127.0.0.0/8")
+	body, err := proxyProtocolRequest(t, addr, proxyHeader(1))
+	require.NoError(t, err)
+	require.Regexp(t, `^203\.0\.113\.1:4711 `, body)
+	body, err = proxyProtocolRequest(t, addr, nil)
+	require.NoError(t, err)
+	require.Regexp(t, `^127\.0\.0\.1:\d+ none$`, body)
+
+	// the header of other upstreams is ignored
+	addr = startProxyProtocolServer(t, false, "10.0.0.0/8")
+	body, err = proxyProtocolRequest(t, addr, proxyHeader(2))
+	require.NoError(t, err)
+	require.Regexp(t, `^127\.0\.0\.1:\d+ none$`, body)
+}
+
+func TestProxyProtocolTLS(t *testing.T) {
+	certPEM, keyPEM := generateCert(t, "localhost", "localhost")
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(certPEM))
+	addr := startProxyProtocolTLSServer(t, &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, true, "127.0.0.1")
+
+	body, err := proxyProtocolTLSRequest(t, addr, &tls.Config{RootCAs: roots, ServerName: "localhost", MinVersion: tls.VersionTLS12}, proxyHeader(2))
+	require.NoError(t, err)
+	require.Regexp(t, `^203\.0\.113\.1:4711 203\.0\.113\.1:4711 via 127\.0\.0\.1:\d+$`, body)
+}
+
+func TestProxyProtocolInvalidCIDR(t *testing.T) {
+	_, err := server.NewProxyProtocol(true, 0, "10.0.0.0/33")
+	require.Error(t, err)
+}
@@ -0,0 +1,197 @@
+package server_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/stretchr/testify/require"
+)
+
+// startUpstream starts a backend that answers with its name and the received path, query and headers
+func startUpstream(t *testing.T, name string) *url.URL {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", name)
+		w.Header().Set("Server", "backend")
+		w.Header().Set("X-Received-Host", r.Host)
+		w.Header().Set("X-Received-Forwarded-For", r.Header.Get("X-Forwarded-For"))
+		w.Header().Set("X-Received-Forwarded-Host", r.Header.Get("X-Forwarded-Host"))
+		w.Header().Set("X-Received-Api-Key", r.Header.Get("X-Api-Key"))
+		w.Header().Set("X-Received-Cookie", r.Header.Get("Cookie"))
+		_, _ = w.Write([]byte(r.Method + " " + r.URL.RequestURI()))
+	}))
+	t.Cleanup(upstream.Close)
+	return mustParseURL(t, upstream.URL)
+}
+
+// deadUpstream returns an upstream URL that refuses connections
+func deadUpstream(t *testing.T) *url.URL {
+	return mustParseURL(t, "http://127.0.0.1:"+strconv.Itoa(unusedPort(t)))
+}
+
+func mustParseURL(t *testing.T, rawURL string) *url.URL {
+	result, err := url.Parse(rawURL)
+	require.NoError(t, err)
+	return result
+}
+
+func proxyRequest(t *testing.T, handler http.Handler, method string, target string) *http.Response {
+	var body io.Reader
+	if method == http.MethodPost {
+		body = strings.NewReader("data")
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, target, body)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	handler.ServeHTTP(w, r)
+	result := w.Result()
+	t.Cleanup(func() { _ = result.Body.Close() })
+	return result
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestProxyRewrite(t *testing.T) {
+	handler, err := server.NewProxyHandler(context.Background(), server.ProxyRoute{
+		Prefix:          "/api/",
+		Upstreams:       []*url.URL{startUpstream(t, "a").JoinPath("/v1")},
+		StripPrefix:     true,
+		RequestHeaders:  server.HeaderRewrite{Set: map[string]string{"X-Api-Key": "secret"}, Delete: []string{"Cookie"}},
+		ResponseHeaders: server.HeaderRewrite{Set: map[string]string{"X-Proxy": "websrv"}, Delete: []string{"Server"}},
+	})
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "http://example.com/api/users/?page=2", nil)
+	r.Header.Set("Cookie", "session=1")
+	r.RemoteAddr = "192.0.2.1:1234"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	resp := w.Result()
+	defer func() { require.NoError(t, resp.Body.Close()) }()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "GET /v1/users/?page=2", readBody(t, resp))
+	require.Equal(t, "192.0.2.1", resp.Header.Get("X-Received-Forwarded-For"))
+	require.Equal(t, "example.com", resp.Header.Get("X-Received-Forwarded-Host"))
+	require.NotEqual(t, "example.com", resp.Header.Get("X-Received-Host"))
+	require.Equal(t, "secret", resp.Header.Get("X-Received-Api-Key"))
+	require.Empty(t, resp.Header.Get("X-Received-Cookie"))
+	require.Equal(t, "websrv", resp.Header.Get("X-Proxy"))
+	require.Empty(t, resp.Header.Get("Server"))
+}
+
+func TestProxyPreserveHost(t *testing.T) {
+	handler, err := server.NewProxyHandler(context.Background(), server.ProxyRoute{
+		Prefix: "/api/", Upstreams: []*url.URL{startUpstream(t, "a")}, PreserveHost: true,
+	})
+	require.NoError(t, err)
+	resp := proxyRequest(t, handler, http.MethodGet, "http://example.com/api/users")
+	require.Equal(t, "example.com", resp.Header.Get("X-Received-Host"))
+	require.Equal(t, "GET /api/users", readBody(t, resp))
+	// incoming X-Forwarded-For headers are not trusted
+	require.Equal(t, "192.0.2.1", resp.Header.Get("X-Received-Forwarded-For"))
+}
+
+func TestProxyTrustedForwardedFor(t *testing.T) {
+	proxy, err := server.NewProxyHandler(context.Background(), server.ProxyRoute{Prefix: "/api/", Upstreams: []*url.URL{startUpstream(t, "a")}})
+	require.NoError(t, err)
+	resolver, err := server.NewClientIPResolver("X-Forwarded-For", "192.0.2.0/24")
+	require.NoError(t, err)
+	// the client IP resolved from the headers of the trusted load balancer is forwarded
+	resp := proxyRequest(t, server.RealIPHandler(proxy, resolver), http.MethodGet, "http://example.com/api/users")
+	require.Equal(t, "198.51.100.1", resp.Header.Get("X-Received-Forwarded-For"))
+}
+
+func TestProxyLoadBalancing(t *testing.T) {
+	handler, err := server.NewProxyHandler(context.Background(), server.ProxyRoute{
+		Prefix: "/api/", Upstreams: []*url.URL{startUpstream(t, "a"), startUpstream(t, "b")},
+	})
+	require.NoError(t, err)
+	counts := make(map[string]int)
+	for range 4 {
+		counts[proxyRequest(t, handler, http.MethodGet, "/api/").Header.Get("X-Upstream")]++
+	}
+	require.Equal(t, map[string]int{"a": 2, "b": 2}, counts)
+}
+
+func TestProxyRetries(t *testing.T) {
+	handler, err := server.NewProxyHandler(context.Background(), server.ProxyRoute{
+		Prefix: "/api/", Upstreams: []*url.URL{deadUpstream(t), startUpstream(t, "a")}, Retries: 1,
+	})
+	require.NoError(t, err)
+	for range 4 {
+		require.Equal(t, http.StatusOK, proxyRequest(t, handler, http.MethodGet, "/api/").StatusCode)
+	}
+	// requests with body are not retried
+	statusCodes := make(map[int]int)
+	for range 4 {
+		statusCodes[proxyRequest(t, handler, http.MethodPost, "/api/").StatusCode]++
+	}
+	require.Equal(t, 2, statusCodes[http.StatusBadGateway])
+	require.Equal(t, 2, statusCodes[http.StatusOK])
+}
+
+func TestProxyHealthCheck(t *testing.T) {
+	healthy := startUpstream(t, "healthy")
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer unhealthy.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler, err := server.NewProxyHandler(ctx, server.ProxyRoute{
+		Prefix:      "/api/",
+		Upstreams:   []*url.URL{healthy, mustParseURL(t, unhealthy.URL)},
+		HealthCheck: server.HealthCheck{Path: "/healthz", Interval: 10 * time.Millisecond, Timeout: time.Second},
+	})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		for range 2 {
+			if proxyRequest(t, handler, http.MethodGet, "/api/").StatusCode != http.StatusOK {
+				return false
+			}
+		}
+		return true
+	}, time.Second, 10*time.Millisecond)
+
+	handler, err = server.NewProxyHandler(ctx, server.ProxyRoute{
+		Prefix:      "/api/",
+		Upstreams:   []*url.URL{mustParseURL(t, unhealthy.URL)},
+		HealthCheck: server.HealthCheck{Path: "/healthz", Interval: 10 * time.Millisecond, Timeout: time.Second},
+	})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return proxyRequest(t, handler, http.MethodGet, "/api/").StatusCode == http.StatusServiceUnavailable
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestProxyTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer slow.Close()
+	handler, err := server.NewProxyHandler(context.Background(), server.ProxyRoute{
+		Prefix: "/api/", Upstreams: []*url.URL{mustParseURL(t, slow.URL)}, Timeout: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusGatewayTimeout, proxyRequest(t, handler, http.MethodGet, "/api/").StatusCode)
+}
+
+func TestProxyInvalidRoute(t *testing.T) {
+	_, err := server.NewProxyHandler(context.Background(), server.ProxyRoute{Prefix: "/api/"})
+	require.ErrorIs(t, err, server.ErrInvalidProxyRoute)
+	_, err = server.NewProxyHandler(context.Background(), server.ProxyRoute{Prefix: "/api/", Upstreams: []*url.URL{mustParseURL(t, "backend:8080")}})
+	require.ErrorIs(t, err, server.ErrInvalidProxyRoute)
+}
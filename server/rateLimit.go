@@ -0,0 +1,136 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/httprate"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrInvalidRateLimit = errors.New("rate limits require a positive number of requests and time window")
+
+// rateLimitHeaders are the response headers according to the IETF draft for RateLimit header fields
+var rateLimitHeaders = httprate.ResponseHeaders{
+	Limit:      "RateLimit-Limit",
+	Remaining:  "RateLimit-Remaining",
+	Reset:      "RateLimit-Reset",
+	RetryAfter: "Retry-After",
+}
+
+// RateLimitRule allows MaxRequests per TimeWindow for the requests with the path Prefix
+type RateLimitRule struct {
+	// Prefix is a path prefix like /api/, empty for the default limit
+	Prefix string
+	// MaxRequests is the number of requests allowed per time window
+	MaxRequests int
+	// TimeWindow is the time window for which the maximal number of requests applies
+	TimeWindow time.Duration
+}
+
+func (rule RateLimitRule) pathPrefix() string {
+	return rule.Prefix
+}
+
+// rateLimitBucket is a RateLimitRule with its own request counters
+type rateLimitBucket struct {
+	RateLimitRule
+	limiter *httprate.RateLimiter
+}
+
+// RateLimiter holds the request counters of the rate limits
+type RateLimiter struct {
+	byIP bool
+	// buckets are sorted by descending prefix length, the default limit is the last one
+	buckets []*rateLimitBucket
+}
+
+// NewRateLimiter sets up the default limit and per path prefix overrides, the longest matching prefix applies.
+// The requests are counted per client IP (see GetClientIP) if byIP is set and globally otherwise.
+func NewRateLimiter(byIP bool, defaultLimit RateLimitRule, overrides ...RateLimitRule) (*RateLimiter, error) {
+	overrides = sortByPrefixLength(overrides)
+	defaultLimit.Prefix = ""
+	result := &RateLimiter{byIP: byIP}
+	for _, limit := range append(overrides, defaultLimit) {
+		if limit.MaxRequests <= 0 || limit.TimeWindow <= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidRateLimit, limit.Prefix)
+		}
+		result.buckets = append(result.buckets, &rateLimitBucket{
+			RateLimitRule: limit,
+			limiter:       httprate.NewRateLimiter(limit.MaxRequests, limit.TimeWindow, httprate.WithResponseHeaders(rateLimitHeaders)),
+		})
+	}
+	return result, nil
+}
+
+// bucket returns the rate limit with the longest matching prefix
+func (rateLimiter *RateLimiter) bucket(requestPath string) *rateLimitBucket {
+	// the rate limiting happens before the request path is validated, so it is cleaned here to prevent bypassing the prefixes
+	requestPath = path.Clean("/" + requestPath)
+	// the default limit with the empty prefix matches all paths
+	bucket, _ := longestPrefixMatch(rateLimiter.buckets, requestPath)
+	return bucket
+}
+
+// key returns the client IP if limiting per IP, else a global key
+func (rateLimiter *RateLimiter) key(r *http.Request) string {
+	if !rateLimiter.byIP {
+		return "*"
+	}
+	return GetClientIP(r).String()
+}
+
+// RateLimitRegistration wraps the registered prometheus types for rate limiting.
+type RateLimitRegistration struct {
+	rejected *prometheus.CounterVec
+}
+
+// RateLimitMetricsRegister registrates a counter for the rejected requests per rate limit prefix
+func RateLimitMetricsRegister(registerer prometheus.Registerer, prometheusNamespace string) (*RateLimitRegistration, error) {
+	var rejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: prometheusNamespace,
+		Subsystem: "ratelimit",
+		Name:      "rejected_requests_total",
+		Help:      "Number of requests rejected due to the rate limit.",
+	}, []string{PrefixLabel})
+	if err := registerer.Register(rejected); err != nil {
+		return nil, fmt.Errorf("failed to register rejected_requests_total metric: %w", err)
+	}
+	return &RateLimitRegistration{rejected: rejected}, nil
+}
+
+// RateLimitHandler answers with 429 if the matching rate limit of the rateLimiter is exceeded. The RateLimit-Limit, RateLimit-Remaining
+// and RateLimit-Reset (seconds till the window resets) headers are set on all responses, Retry-After on rejected ones.
+// The rejected requests are counted if the registration is not nil, it has to be prepared via the RateLimitMetricsRegister function.
+func RateLimitHandler(next http.Handler, rateLimiter *RateLimiter, registration *RateLimitRegistration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bucket := rateLimiter.bucket(r.URL.Path)
+		limited := bucket.limiter.OnLimit(w, r, rateLimiter.key(r))
+		resetToDelta(w.Header())
+		if !limited {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if registration != nil {
+			registration.rejected.With(map[string]string{PrefixLabel: bucket.Prefix}).Inc()
+		}
+		log.Debug().Msgf("Rate limit for prefix '%s' exceeded", bucket.Prefix)
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+	})
+}
+
+// resetToDelta converts the unix timestamp of the RateLimit-Reset header to the remaining seconds and
+// clamps the RateLimit-Remaining header to zero, as both are required to be non-negative deltas
+func resetToDelta(header http.Header) {
+	if reset, err := strconv.ParseInt(header.Get(rateLimitHeaders.Reset), 10, 64); err == nil {
+		header.Set(rateLimitHeaders.Reset, strconv.FormatInt(max(0, reset-time.Now().Unix()), 10))
+	}
+	if remaining, err := strconv.Atoi(header.Get(rateLimitHeaders.Remaining)); err == nil && remaining < 0 {
+		header.Set(rateLimitHeaders.Remaining, "0")
+	}
+}
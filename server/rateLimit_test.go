@@ -0,0 +1,98 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func rateLimitRequest(handler http.Handler, remoteAddr string, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.RemoteAddr = remoteAddr
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestRateLimitByIP(t *testing.T) {
+	rateLimiter, err := server.NewRateLimiter(true, server.RateLimitRule{MaxRequests: 2, TimeWindow: time.Hour})
+	require.NoError(t, err)
+	registry := prometheus.NewRegistry()
+	registration, err := server.RateLimitMetricsRegister(registry, "test")
+	require.NoError(t, err)
+	handler := server.RateLimitHandler(namedHandler("ok"), rateLimiter, registration)
+
+	for i := range 2 {
+		w := rateLimitRequest(handler, "192.0.2.1:1234", "/")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+		require.Equal(t, strconv.Itoa(1-i), w.Header().Get("RateLimit-Remaining"))
+		reset, err := strconv.Atoi(w.Header().Get("RateLimit-Reset"))
+		require.NoError(t, err)
+		require.LessOrEqual(t, reset, 3600)
+	}
+	w := rateLimitRequest(handler, "192.0.2.1:1234", "/")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	require.NotEmpty(t, w.Header().Get("Retry-After"))
+	// other clients have their own bucket
+	require.Equal(t, http.StatusOK, rateLimitRequest(handler, "192.0.2.2:1234", "/").Code)
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 1)
+	require.Equal(t, "test_ratelimit_rejected_requests_total", families[0].GetName())
+	require.Len(t, families[0].GetMetric(), 1)
+	require.InDelta(t, 1, families[0].GetMetric()[0].GetCounter().GetValue(), 0)
+}
+
+func TestRateLimitByForwardedIP(t *testing.T) {
+	resolver, err := server.NewClientIPResolver("X-Forwarded-For", "10.0.0.0/8")
+	require.NoError(t, err)
+	rateLimiter, err := server.NewRateLimiter(true, server.RateLimitRule{MaxRequests: 1, TimeWindow: time.Hour})
+	require.NoError(t, err)
+	handler := server.RealIPHandler(server.RateLimitHandler(namedHandler("ok"), rateLimiter, nil), resolver)
+	for i, expected := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("X-Forwarded-For", "203.0.113."+strconv.Itoa(min(i+1, 2)))
+		handler.ServeHTTP(w, r)
+		require.Equal(t, expected, w.Code, i)
+	}
+}
+
+func TestRateLimitGlobal(t *testing.T) {
+	rateLimiter, err := server.NewRateLimiter(false, server.RateLimitRule{MaxRequests: 1, TimeWindow: time.Hour})
+	require.NoError(t, err)
+	handler := server.RateLimitHandler(namedHandler("ok"), rateLimiter, nil)
+	require.Equal(t, http.StatusOK, rateLimitRequest(handler, "192.0.2.1:1234", "/").Code)
+	require.Equal(t, http.StatusTooManyRequests, rateLimitRequest(handler, "192.0.2.2:1234", "/").Code)
+}
+
+func TestRateLimitOverrides(t *testing.T) {
+	rateLimiter, err := server.NewRateLimiter(false, server.RateLimitRule{MaxRequests: 10, TimeWindow: time.Hour},
+		server.RateLimitRule{Prefix: "/api/", MaxRequests: 2, TimeWindow: time.Hour},
+		server.RateLimitRule{Prefix: "/api/login/", MaxRequests: 1, TimeWindow: time.Hour},
+	)
+	require.NoError(t, err)
+	handler := server.RateLimitHandler(namedHandler("ok"), rateLimiter, nil)
+
+	require.Equal(t, http.StatusOK, rateLimitRequest(handler, "192.0.2.1:1234", "/api/login").Code)
+	require.Equal(t, http.StatusTooManyRequests, rateLimitRequest(handler, "192.0.2.1:1234", "/api/login/").Code)
+	// unclean paths cannot bypass the prefixes
+	require.Equal(t, http.StatusTooManyRequests, rateLimitRequest(handler, "192.0.2.1:1234", "/static/../api//login").Code)
+	require.Equal(t, "2", rateLimitRequest(handler, "192.0.2.1:1234", "/api/users").Header().Get("RateLimit-Limit"))
+	require.Equal(t, "10", rateLimitRequest(handler, "192.0.2.1:1234", "/").Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimitInvalid(t *testing.T) {
+	_, err := server.NewRateLimiter(false, server.RateLimitRule{MaxRequests: 10, TimeWindow: time.Hour}, server.RateLimitRule{Prefix: "/api/"})
+	require.ErrorIs(t, err, server.ErrInvalidRateLimit)
+}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// RewriteCheckKey is the ContextKey under which the check for rewritten requests is stored, see RewriteCheckHandler
+	RewriteCheckKey          = &ContextKey{val: "rewriteCheck"}
+	ErrInvalidRedirectMatch  = errors.New("exactly one of path, prefix or regex has to be set")
+	ErrInvalidRedirectStatus = errors.New("only the status codes 200 (rewrite), 301, 302, 307 and 308 are supported")
+	ErrExternalRewrite       = errors.New("rewrites (status 200) have to target a local path")
+	ErrInvalidPlaceholder    = errors.New("invalid placeholder")
+)
+
+// defaultRedirectStatus is used if no status code has been set, same as for Netlify
+const defaultRedirectStatus = http.StatusMovedPermanently
+
+var (
+	// placeholderRegex matches placeholders like :slug in redirect paths and targets
+	placeholderRegex = regexp.MustCompile(`:([A-Za-z_][0-9A-Za-z_]*)`)
+	// placeholderNameRegex validates placeholder names, they are used as regexp group names
+	placeholderNameRegex = regexp.MustCompile(`^[A-Za-z_][0-9A-Za-z_]*$`)
+)
+
+// RedirectMatch holds the configuration for a RedirectRule. Exactly one of Path, Prefix or Regex has to be set.
+type RedirectMatch struct {
+	// Host restricts the rule to the given host, wildcards like *.example.com match all subdomains. Empty matches all hosts.
+	Host string
+	// Path is an exact path that may contain placeholders like /blog/:slug and a trailing wildcard like /docs/*.
+	// The placeholders and the wildcard (as :splat) can be used in To.
+	Path string
+	// Prefix is a path prefix like /docs/, the remaining path can be used in To as :splat
+	Prefix string
+	// Regex is a regular expression for the path, the capture groups can be used in To as $1 or ${name}
+	Regex string
+	// To is the redirect target, either a local path or an absolute URL
+	To string
+	// Status is the HTTP status code of the redirect (301, 302, 307, 308) or 200 for an internal rewrite. Defaults to 301.
+	Status int
+	// Force also applies the rule if a file exists at the request path. Otherwise, existing files take precedence.
+	Force bool
+}
+
+// RedirectRule is a compiled RedirectMatch
+type RedirectRule struct {
+	host   string
+	path   *regexp.Regexp
+	to     string
+	status int
+	force  bool
+}
+
+// NewRedirectRule validates and compiles the RedirectMatch into a RedirectRule.
+func NewRedirectRule(match RedirectMatch) (*RedirectRule, error) {
+	rule := &RedirectRule{host: strings.ToLower(match.Host), status: match.Status, force: match.Force}
+	if rule.status == 0 {
+		rule.status = defaultRedirectStatus
+	}
+	switch rule.status {
+	case http.StatusOK, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrInvalidRedirectStatus, rule.status)
+	}
+	if rule.status == http.StatusOK && !strings.HasPrefix(match.To, "/") {
+		return nil, fmt.Errorf("%w: %s", ErrExternalRewrite, match.To)
+	}
+
+	var err error
+	switch {
+	case match.Path != "" && match.Prefix == "" && match.Regex == "":
+		rule.path, rule.to, err = compilePathPattern(match.Path, match.To)
+	case match.Prefix != "" && match.Path == "" && match.Regex == "":
+		rule.path = regexp.MustCompile("^" + regexp.QuoteMeta(match.Prefix) + "(?P<splat>.*)$")
+		rule.to = toTemplate(match.To, []string{"splat"})
+	case match.Regex != "" && match.Path == "" && match.Prefix == "":
+		rule.path, err = regexp.Compile(match.Regex)
+		rule.to = match.To
+	default:
+		return nil, ErrInvalidRedirectMatch
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid redirect path pattern: %w", err)
+	}
+	return rule, nil
+}
+
+// compilePathPattern converts a path like /blog/:slug or /docs/* into a regular expression with named groups
+// and the target into the corresponding regexp template. Trailing slashes are optional, as for Netlify.
+func compilePathPattern(pattern string, to string) (*regexp.Regexp, string, error) {
+	var names []string
+	var sb strings.Builder
+	sb.WriteString("^")
+	segments := strings.Split(strings.TrimSuffix(pattern, "/"), "/")
+	for i, segment := range segments {
+		if i > 0 {
+			sb.WriteString("/")
+		}
+		switch {
+		case segment == "*" && i == len(segments)-1 && i > 0:
+			// the wildcard also matches the parent path itself
+			result := sb.String()
+			sb.Reset()
+			sb.WriteString(strings.TrimSuffix(result, "/"))
+			sb.WriteString("(?:/(?P<splat>.*))?")
+			names = append(names, "splat")
+		case strings.HasPrefix(segment, ":"):
+			name := segment[1:]
+			if !placeholderNameRegex.MatchString(name) {
+				return nil, "", fmt.Errorf("%w: %s", ErrInvalidPlaceholder, segment)
+			}
+			sb.WriteString("(?P<" + name + ">[^/]+)")
+			names = append(names, name)
+		default:
+			sb.WriteString(regexp.QuoteMeta(segment))
+		}
+	}
+	if len(names) == 0 || names[len(names)-1] != "splat" {
+		sb.WriteString("/?")
+	}
+	sb.WriteString("$")
+	regex, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, "", err
+	}
+	return regex, toTemplate(to, names), nil
+}
+
+// toTemplate converts the placeholders like :slug from the target into the regexp template syntax ${slug}.
+// Placeholders that are not in names are kept as is, e.g. to not modify ports.
+func toTemplate(to string, names []string) string {
+	to = strings.ReplaceAll(to, "$", "$$")
+	return placeholderRegex.ReplaceAllStringFunc(to, func(placeholder string) string {
+		for _, name := range names {
+			if placeholder[1:] == name {
+				return "${" + name + "}"
+			}
+		}
+		return placeholder
+	})
+}
+
+// matches checks the host and path of the rule and returns the expanded target
+func (rule *RedirectRule) matches(host string, requestPath string) (target string, ok bool) {
+	if !matchesHost(rule.host, host) {
+		return "", false
+	}
+	submatches := rule.path.FindStringSubmatchIndex(requestPath)
+	if submatches == nil {
+		return "", false
+	}
+	return string(rule.path.ExpandString(nil, rule.to, requestPath, submatches)), true
+}
+
+// matchesHost compares the request host (without port) against the expected host which may contain a leading wildcard like *.example.com
+func matchesHost(expected string, host string) bool {
+	if expected == "" {
+		return true
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	if wildcardDomain, ok := strings.CutPrefix(expected, "*."); ok {
+		return strings.HasSuffix(host, "."+wildcardDomain)
+	}
+	return host == expected
+}
+
+// RedirectRules holds a list of RedirectRules that can be swapped concurrently, e.g. after the _redirects file has been changed.
+type RedirectRules struct {
+	rules atomic.Pointer[[]*RedirectRule]
+}
+
+// NewRedirectRules returns RedirectRules that hold the given rules
+func NewRedirectRules(rules ...*RedirectRule) *RedirectRules {
+	result := &RedirectRules{}
+	result.Store(rules...)
+	return result
+}
+
+// Store replaces the current rules
+func (rules *RedirectRules) Store(r ...*RedirectRule) {
+	rules.rules.Store(&r)
+}
+
+// Load returns the current rules
+func (rules *RedirectRules) Load() []*RedirectRule {
+	return *rules.rules.Load()
+}
+
+// RedirectHandler applies the first matching rule. Redirects are answered directly, rewrites change the request path before the request is passed to the next handler.
+// Rules that are not forced are skipped if the request path resolves to a file in fsys. The original query is kept if the target does not contain its own query.
+func RedirectHandler(next http.Handler, fsys fs.FS, rules *RedirectRules) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, rule := range rules.Load() {
+			target, ok := rule.matches(r.Host, r.URL.Path)
+			if !ok || (!rule.force && isFile(fsys, resolveFileName(fsys, r.URL.Path))) {
+				continue
+			}
+			targetPath, targetQuery, hasQuery := strings.Cut(target, "?")
+			if !hasQuery {
+				targetQuery = r.URL.RawQuery
+			}
+			if rule.status != http.StatusOK {
+				if targetQuery != "" {
+					targetPath += "?" + targetQuery
+				}
+				log.Debug().Msgf("Redirecting %s to %s with %d", r.URL.Path, targetPath, rule.status)
+				http.Redirect(w, r, targetPath, rule.status)
+				return
+			}
+			log.Debug().Msgf("Rewriting %s to %s", r.URL.Path, target)
+			if dir, ok := strings.CutSuffix(targetPath, "/index.html"); ok {
+				// http.FileServer redirects requests for index.html to the directory, which serves the index.html itself
+				targetPath = dir + "/"
+			}
+			r = r.Clone(r.Context())
+			r.URL.Path = targetPath
+			r.URL.RawPath = ""
+			r.URL.RawQuery = targetQuery
+			next = withRewriteCheck(r, next)
+			break
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RewriteCheckHandler stores the check in the request context. Rewrites of the RedirectHandler pass the rewritten request through the check
+// before the next handler, so that path based access checks like the ClientCertHandler are also applied to the rewritten path.
+func RewriteCheckHandler(next http.Handler, check HandlerMiddleware) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), RewriteCheckKey, check)))
+	})
+}
+
+// withRewriteCheck wraps the handler with the check of the RewriteCheckHandler, if any
+func withRewriteCheck(r *http.Request, next http.Handler) http.Handler {
+	if check, ok := r.Context().Value(RewriteCheckKey).(HandlerMiddleware); ok {
+		return check(next)
+	}
+	return next
+}
@@ -0,0 +1,138 @@
+package server_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"testing/fstest"
+
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/stretchr/testify/require"
+)
+
+var redirectFs = fstest.MapFS{
+	"index.html":         {Data: []byte("index")},
+	"old-docs/keep.html": {Data: []byte("keep")},
+}
+
+func getRedirectRules(t *testing.T, matches ...server.RedirectMatch) *server.RedirectRules {
+	rules := make([]*server.RedirectRule, len(matches))
+	for i, match := range matches {
+		var err error
+		rules[i], err = server.NewRedirectRule(match)
+		require.NoError(t, err)
+	}
+	return server.NewRedirectRules(rules...)
+}
+
+// rewriteHandler rewrites /pub/* to /admin/* and passes the rewritten requests through the check
+func rewriteHandler(t *testing.T, next http.Handler, check server.HandlerMiddleware) http.Handler {
+	rules := getRedirectRules(t, server.RedirectMatch{Path: "/pub/*", To: "/admin/:splat", Status: http.StatusOK})
+	return server.RewriteCheckHandler(server.RedirectHandler(next, redirectFs, rules), check)
+}
+
+func TestRedirect(t *testing.T) {
+	rules := getRedirectRules(t,
+		server.RedirectMatch{Path: "/exact", To: "/target", Status: http.StatusFound},
+		server.RedirectMatch{Path: "/old-docs/*", To: "/docs/:splat"},
+		server.RedirectMatch{Prefix: "/prefix/", To: "/new/:splat", Status: http.StatusPermanentRedirect},
+		server.RedirectMatch{Path: "/user/:id/profile", To: "/profiles/:id", Status: http.StatusTemporaryRedirect},
+		server.RedirectMatch{Regex: `^/posts/(?P<year>\d{4})/(\d+)$`, To: "/blog/${year}-$2"},
+		server.RedirectMatch{Host: "www.example.com", Path: "/*", To: "https://example.com/:splat"},
+	)
+	tests := []struct {
+		name     string
+		host     string
+		target   string
+		status   int
+		location string
+	}{
+		{name: "exact", target: "/exact", status: http.StatusFound, location: "/target"},
+		{name: "exact trailing slash", target: "/exact/", status: http.StatusFound, location: "/target"},
+		{name: "wildcard", target: "/old-docs/a/b.html?x=1", status: http.StatusMovedPermanently, location: "/docs/a/b.html?x=1"},
+		{name: "wildcard parent", target: "/old-docs", status: http.StatusMovedPermanently, location: "/docs/"},
+		{name: "wildcard shadowed by file", target: "/old-docs/keep.html", status: http.StatusOK},
+		{name: "prefix", target: "/prefix/a/b", status: http.StatusPermanentRedirect, location: "/new/a/b"},
+		{name: "placeholder", target: "/user/42/profile", status: http.StatusTemporaryRedirect, location: "/profiles/42"},
+		{name: "regex", target: "/posts/2024/7", status: http.StatusMovedPermanently, location: "/blog/2024-7"},
+		{name: "host", host: "WWW.example.com:8080", target: "/a?b=c", status: http.StatusMovedPermanently, location: "https://example.com/a?b=c"},
+		{name: "no match", host: "example.com", target: "/a", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, r, next := getDefaultHandlerMocks()
+			target, err := url.Parse(tt.target)
+			require.NoError(t, err)
+			r.URL = target
+			r.Host = tt.host
+			server.RedirectHandler(next, redirectFs, rules).ServeHTTP(w, r)
+			require.Equal(t, tt.status, w.Code)
+			require.Equal(t, tt.location, w.Header().Get("Location"))
+			if tt.status == http.StatusOK {
+				require.Equal(t, target.Path, next.r.URL.Path)
+			} else {
+				require.Nil(t, next.r)
+			}
+		})
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	rules := getRedirectRules(t,
+		server.RedirectMatch{Path: "/blog/:slug", To: "/blog/:slug/index.html", Status: http.StatusOK},
+		server.RedirectMatch{Path: "/*", To: "/index.html?spa=true", Status: http.StatusOK},
+	)
+	w, r, next := getDefaultHandlerMocks()
+	r.URL = &url.URL{Path: "/blog/hello", RawQuery: "a=b"}
+	server.RedirectHandler(next, redirectFs, rules).ServeHTTP(w, r)
+	require.Equal(t, "/blog/hello/", next.r.URL.Path)
+	require.Equal(t, "a=b", next.r.URL.RawQuery)
+	require.Equal(t, "/blog/hello", r.URL.Path)
+
+	w, r, next = getDefaultHandlerMocks()
+	r.URL = &url.URL{Path: "/some/route"}
+	server.RedirectHandler(next, redirectFs, rules).ServeHTTP(w, r)
+	require.Equal(t, "/", next.r.URL.Path)
+	require.Equal(t, "spa=true", next.r.URL.RawQuery)
+}
+
+func TestRedirectForce(t *testing.T) {
+	rules := getRedirectRules(t, server.RedirectMatch{Path: "/index.html", To: "/moved.html", Force: true})
+	w, r, next := getDefaultHandlerMocks()
+	r.URL = &url.URL{Path: "/index.html"}
+	server.RedirectHandler(next, redirectFs, rules).ServeHTTP(w, r)
+	require.Equal(t, http.StatusMovedPermanently, w.Code)
+	require.Equal(t, "/moved.html", w.Header().Get("Location"))
+	require.Nil(t, next.r)
+}
+
+func TestRedirectStore(t *testing.T) {
+	rules := getRedirectRules(t)
+	rule, err := server.NewRedirectRule(server.RedirectMatch{Path: "/a", To: "/b"})
+	require.NoError(t, err)
+	rules.Store(rule)
+	w, r, next := getDefaultHandlerMocks()
+	r.URL = &url.URL{Path: "/a"}
+	server.RedirectHandler(next, redirectFs, rules).ServeHTTP(w, r)
+	require.Equal(t, "/b", w.Header().Get("Location"))
+}
+
+func TestNewRedirectRuleInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		match server.RedirectMatch
+		err   error
+	}{
+		{name: "no path", match: server.RedirectMatch{To: "/b"}, err: server.ErrInvalidRedirectMatch},
+		{name: "path and prefix", match: server.RedirectMatch{Path: "/a", Prefix: "/a", To: "/b"}, err: server.ErrInvalidRedirectMatch},
+		{name: "status", match: server.RedirectMatch{Path: "/a", To: "/b", Status: http.StatusNotFound}, err: server.ErrInvalidRedirectStatus},
+		{name: "external rewrite", match: server.RedirectMatch{Path: "/a", To: "https://example.com", Status: http.StatusOK}, err: server.ErrExternalRewrite},
+		{name: "placeholder", match: server.RedirectMatch{Path: "/a/:b.html", To: "/b"}, err: server.ErrInvalidPlaceholder},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := server.NewRedirectRule(tt.match)
+			require.ErrorIs(t, err, tt.err)
+		})
+	}
+}
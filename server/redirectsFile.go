@@ -0,0 +1,82 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+var ErrInvalidRedirectsLine = errors.New("invalid line, expected: from to [status[!]]")
+
+// ParseRedirectsFile parses a Netlify-style _redirects file. Each line holds the source path, the target and an optional status code,
+// e.g. "/blog/:slug /blog/:slug/index.html 200" or "/old-docs/* /docs/:splat 301!". A trailing ! forces the rule, # starts a comment.
+// The source path may be an absolute URL to match a host. Lines with query parameter or header conditions are not supported and skipped.
+func ParseRedirectsFile(r io.Reader) ([]*RedirectRule, error) {
+	var rules []*RedirectRule
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		match, err := parseRedirectsLine(fields)
+		if err != nil {
+			return nil, fmt.Errorf("_redirects line %d: %w", lineNumber, err)
+		}
+		if match == nil {
+			log.Warn().Msgf("Skipping unsupported _redirects line %d: %s", lineNumber, line)
+			continue
+		}
+		rule, err := NewRedirectRule(*match)
+		if err != nil {
+			return nil, fmt.Errorf("_redirects line %d: %w", lineNumber, err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading _redirects file: %w", err)
+	}
+	return rules, nil
+}
+
+// parseRedirectsLine converts the fields of a single _redirects line into a RedirectMatch. Returns nil for unsupported lines.
+func parseRedirectsLine(fields []string) (*RedirectMatch, error) {
+	for _, field := range fields[1:] {
+		if strings.Contains(field, "=") && !strings.HasPrefix(field, "/") && !strings.Contains(field, "://") {
+			// query parameter, country, language or role conditions
+			return nil, nil
+		}
+	}
+	if len(fields) < 2 || len(fields) > 3 {
+		return nil, ErrInvalidRedirectsLine
+	}
+	match := &RedirectMatch{Path: fields[0], To: fields[1]}
+	if len(fields) == 3 {
+		status, forced := strings.CutSuffix(fields[2], "!")
+		var err error
+		match.Status, err = strconv.Atoi(status)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid status %s", ErrInvalidRedirectsLine, fields[2])
+		}
+		match.Force = forced
+	}
+	if strings.HasPrefix(match.Path, "http://") || strings.HasPrefix(match.Path, "https://") {
+		from, err := url.Parse(match.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidRedirectsLine, err)
+		}
+		match.Host = from.Hostname()
+		match.Path = from.Path
+		if match.Path == "" {
+			match.Path = "/"
+		}
+	}
+	return match, nil
+}
@@ -0,0 +1,55 @@
+package server_test
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/stretchr/testify/require"
+)
+
+const redirectsFile = `
+# comment
+/old-docs/*   /docs/:splat   301
+/news         /blog          302!  # forced
+/store id=:id /blog/:id      301
+https://www.example.com/* https://example.com/:splat 301!
+/blog/:slug   /blog/:slug/index.html 200
+`
+
+func TestParseRedirectsFile(t *testing.T) {
+	rules, err := server.ParseRedirectsFile(strings.NewReader(redirectsFile))
+	require.NoError(t, err)
+	require.Len(t, rules, 4)
+
+	tests := []struct {
+		host     string
+		path     string
+		status   int
+		location string
+	}{
+		{path: "/old-docs/a", status: http.StatusMovedPermanently, location: "/docs/a"},
+		{path: "/news", status: http.StatusFound, location: "/blog"},
+		{host: "www.example.com", path: "/index.html", status: http.StatusMovedPermanently, location: "https://example.com/index.html"},
+		{path: "/store", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		w, r, next := getDefaultHandlerMocks()
+		r.Host = tt.host
+		r.URL = &url.URL{Path: tt.path}
+		server.RedirectHandler(next, redirectFs, server.NewRedirectRules(rules...)).ServeHTTP(w, r)
+		require.Equal(t, tt.status, w.Code, tt.path)
+		require.Equal(t, tt.location, w.Header().Get("Location"), tt.path)
+	}
+}
+
+func TestParseRedirectsFileInvalid(t *testing.T) {
+	_, err := server.ParseRedirectsFile(strings.NewReader("/a /b 301 extra"))
+	require.ErrorIs(t, err, server.ErrInvalidRedirectsLine)
+	_, err = server.ParseRedirectsFile(strings.NewReader("/a /b abc"))
+	require.ErrorIs(t, err, server.ErrInvalidRedirectsLine)
+	_, err = server.ParseRedirectsFile(strings.NewReader("/a /b 404"))
+	require.ErrorIs(t, err, server.ErrInvalidRedirectStatus)
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/felixge/httpsnoop"
+)
+
+// beforeWriteHeader wraps the response writer so that the before function is called exactly once with the status code before the HTTP headers
+// are sent, irrespective of whether WriteHeader is called explicitly or implicitly via Write or ReadFrom.
+func beforeWriteHeader(w http.ResponseWriter, before func(code int)) http.ResponseWriter {
+	called := false
+	callOnce := func(code int) {
+		if !called {
+			called = true
+			before(code)
+		}
+	}
+	return httpsnoop.Wrap(w, httpsnoop.Hooks{
+		WriteHeader: func(headerFunc httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+			return func(code int) {
+				callOnce(code)
+				headerFunc(code)
+			}
+		},
+		Write: func(writeFunc httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return func(b []byte) (int, error) {
+				callOnce(http.StatusOK)
+				return writeFunc(b)
+			}
+		},
+		ReadFrom: func(fromFunc httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			return func(src io.Reader) (int64, error) {
+				callOnce(http.StatusOK)
+				return fromFunc(src)
+			}
+		},
+	})
+}
@@ -21,19 +21,37 @@ type ContextKey struct {
 // SessionIdKey is the ContextKey under which the current sessionId can be found
 var SessionIdKey = &ContextKey{val: "sessionId"}
 
-func readSessionIdCookie(r *http.Request, cookieName string) (sessionId string, ok bool) {
+// readCookie returns the value of the cookieName cookie if present
+func readCookie(r *http.Request, cookieName string) (value string, ok bool) {
 	for _, cookie := range r.Cookies() {
 		if cookie.Name == cookieName {
 			return cookie.Value, true
 		}
-		if cookie.Name == cookieName {
-			return cookie.Value, true
-		}
 	}
 	log.Ctx(r.Context()).Debug().Msgf("Cookie %s not present in request", cookieName)
 	return "", false
 }
 
+// newCookie returns a Secure and HttpOnly cookie that expires after the cookieTimeToLife.
+// A negative cookieTimeToLife returns a cookie that deletes the cookieName cookie.
+func newCookie(cookieName string, value string, path string, cookieTimeToLife time.Duration, sameSite http.SameSite) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     cookieName,
+		Value:    value,
+		Path:     path,
+		MaxAge:   int(cookieTimeToLife.Seconds()),
+		Expires:  time.Now().Add(cookieTimeToLife),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: sameSite,
+	}
+	if cookieTimeToLife < 0 {
+		cookie.MaxAge = -1
+		cookie.Expires = time.Unix(0, 0)
+	}
+	return cookie
+}
+
 // SessionCookieHandler reads the cookieName cookie from the request and adds if to the context unter the SessionIdKey if present.
 // If absent it generates a new sessionId and adds it to the context and the HTTP Set-Cookie Response header.
 //
@@ -41,20 +59,11 @@ func readSessionIdCookie(r *http.Request, cookieName string) (sessionId string,
 func SessionCookieHandler(next http.Handler, cookieName string, cookieTimeToLife time.Duration) http.Handler {
 	randGen := random.NewBufferedRandomIdGenerator(sessionCookieLength, sessionCookieLength/2)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		sessionId, ok := readSessionIdCookie(r, cookieName)
+		sessionId, ok := readCookie(r, cookieName)
 		if !ok {
 			// random collisions are not problematic for CSP nonces, so we can just take what we get
 			sessionId = randGen.GetRandomId()
-			http.SetCookie(w, &http.Cookie{
-				Name:     cookieName,
-				Value:    sessionId,
-				Path:     "/",
-				MaxAge:   int(cookieTimeToLife.Seconds()),
-				Expires:  time.Now().Add(cookieTimeToLife),
-				Secure:   true,
-				HttpOnly: true,
-				SameSite: http.SameSiteStrictMode,
-			})
+			http.SetCookie(w, newCookie(cookieName, sessionId, "/", cookieTimeToLife, http.SameSiteStrictMode))
 		}
 		ctx := context.WithValue(r.Context(), SessionIdKey, sessionId)
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"io/fs"
 	"net"
 	"net/http"
 	"strconv"
@@ -13,10 +14,18 @@ type HandlerMiddleware func(handler http.Handler) http.Handler
 
 type Server struct {
 	*http.Server
+	proxyProtocol *ProxyProtocol
+}
+
+// UseProxyProtocol parses the PROXY protocol headers of the connections accepted by ListenGoServe, see GetProxyProtocol.
+func (s *Server) UseProxyProtocol(proxyProtocol *ProxyProtocol) {
+	s.proxyProtocol = proxyProtocol
+	s.ConnContext = connContext
 }
 
 // ListenGoServe is a half-asynchronous version of ListenAnDServe from http.Server.
 // This blocks till net.Listen has returned, the actual Serve of the http.Server is done in a separate (automatically spawned) goroutine.
+// TLS is terminated if the TLSConfig of the http.Server is set, the certificates have to be provided by the TLSConfig.
 // All errors (including http.ErrServerClosed) are returned via the error channel.
 func (s *Server) ListenGoServe(ctx context.Context, errChan chan<- error) {
 	addr := s.Addr
@@ -29,7 +38,14 @@ func (s *Server) ListenGoServe(ctx context.Context, errChan chan<- error) {
 		errChan <- err
 		return
 	}
+	if s.proxyProtocol != nil {
+		l = s.proxyProtocol.Listener(l)
+	}
 	go func() {
+		if s.TLSConfig != nil {
+			errChan <- s.ServeTLS(l, "", "")
+			return
+		}
 		errChan <- s.Serve(l)
 	}()
 }
@@ -45,11 +61,12 @@ func Build(port uint16, readTimeout time.Duration, writeTimeout time.Duration, i
 	if h2c {
 		protocols = new(http.Protocols)
 		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
 		protocols.SetUnencryptedHTTP2(true)
 	}
 
 	return &Server{
-		&http.Server{
+		Server: &http.Server{
 			Addr:         ":" + strconv.FormatUint(uint64(port), 10),
 			Protocols:    protocols,
 			Handler:      handler,
@@ -71,10 +88,11 @@ func Optional(middleware HandlerMiddleware, isActive bool) HandlerMiddleware {
 }
 
 // Caching adds a caching middleware handler which uses the ETag HTTP response and If-None-Match HTTP request headers.
-// This requires that all following handler only serve static resources. Following handlers will only be called when a cache mismatch occurs.
-func Caching() HandlerMiddleware {
+// The ETags are read from the fsys. This requires that all following handler only serve static resources from the fsys.
+// Following handlers will only be called when a cache mismatch occurs.
+func Caching(fsys ETagFS) HandlerMiddleware {
 	return func(handler http.Handler) http.Handler {
-		return NewCacheHandler(handler)
+		return NewCacheHandler(handler, fsys)
 	}
 }
 
@@ -110,6 +128,43 @@ func Header(headers map[string]string) HandlerMiddleware {
 	}
 }
 
+// HeaderRules adds a middleware that modifies the HTTP response headers according to all matching rules
+func HeaderRules(rules ...HeaderRule) HandlerMiddleware {
+	return func(handler http.Handler) http.Handler {
+		return HeaderRulesHandler(handler, rules...)
+	}
+}
+
+// CacheControl adds a middleware that sets the Cache-Control HTTP-Header according to the first matching rule
+func CacheControl(rules ...CacheControlRule) HandlerMiddleware {
+	return func(handler http.Handler) http.Handler {
+		return CacheControlHandler(handler, rules...)
+	}
+}
+
+// Redirect adds a middleware that redirects or internally rewrites the request according to the first matching rule.
+// Rules that are not forced do not apply to request paths that resolve to files in the fsys.
+func Redirect(fsys fs.FS, rules *RedirectRules) HandlerMiddleware {
+	return func(handler http.Handler) http.Handler {
+		return RedirectHandler(handler, fsys, rules)
+	}
+}
+
+// RewriteCheck adds a middleware that applies the check also to the requests that are rewritten by the Redirect middleware
+func RewriteCheck(check HandlerMiddleware) HandlerMiddleware {
+	return func(handler http.Handler) http.Handler {
+		return RewriteCheckHandler(handler, check)
+	}
+}
+
+// ClientCert adds a middleware that adds the identity of verified TLS client certificates to the request context
+// and restricts the paths of the rules to matching client certificates.
+func ClientCert(rules ...ClientCertRule) HandlerMiddleware {
+	return func(handler http.Handler) http.Handler {
+		return ClientCertHandler(handler, rules...)
+	}
+}
+
 // Fallback adds a fallback route handler.
 // THis routes the request to a fallback route on of the given HTTP fallback status codes
 func Fallback(fallbackPath string, fallbackCodes ...int) HandlerMiddleware {
@@ -118,9 +173,20 @@ func Fallback(fallbackPath string, fallbackCodes ...int) HandlerMiddleware {
 	}
 }
 
+// Precompressed adds a middleware that serves precompressed sidecar files (e.g. main.js.br for main.js) from the fsys if the client accepts their encoding.
+// The encodings order is the server preference.
+func Precompressed(fsys fs.FS, mediaTypeMap map[string]string, encodings ...string) HandlerMiddleware {
+	return func(handler http.Handler) http.Handler {
+		return PrecompressedHandler(handler, fsys, mediaTypeMap, encodings...)
+	}
+}
+
 // Validate adds to the validate middleware and prevent path transversal attacks by cleaning the request path.
-func Validate() HandlerMiddleware {
-	return ValidateHandler
+// All HTTP methods are allowed for paths with one of the proxyPrefixes.
+func Validate(proxyPrefixes ...string) HandlerMiddleware {
+	return func(handler http.Handler) http.Handler {
+		return ValidateHandler(handler, proxyPrefixes...)
+	}
 }
 
 // AccessLog adds an access logging middleware.
@@ -136,11 +202,72 @@ func AccessMetrics(registration *PrometheusRegistration) HandlerMiddleware {
 	}
 }
 
+// RealIP adds a middleware that stores the client IP in the request context, forwarding headers are only trusted from the proxies of the resolver.
+func RealIP(resolver *ClientIPResolver) HandlerMiddleware {
+	return func(handler http.Handler) http.Handler {
+		return RealIPHandler(handler, resolver)
+	}
+}
+
+// IPFilter adds a middleware that rejects requests with 403 if the client IP is not allowed by the filter.
+// The registration is optional and has to be prepared via the AccessMetricsRegister function.
+func IPFilter(filter *IPFilterRules, registration *PrometheusRegistration) HandlerMiddleware {
+	return func(handler http.Handler) http.Handler {
+		return IPFilterHandler(handler, filter, registration)
+	}
+}
+
+// BasicAuth adds a middleware that requires HTTP Basic authentication for the path prefixes of the auth rules.
+func BasicAuth(auth *BasicAuthenticator) HandlerMiddleware {
+	return func(handler http.Handler) http.Handler {
+		return BasicAuthHandler(handler, auth)
+	}
+}
+
+// OIDC adds a middleware that requires an OpenID Connect login for the protected paths and stores the claims in the request context.
+func OIDC(rp *OIDCRelyingParty) HandlerMiddleware {
+	return func(handler http.Handler) http.Handler {
+		return OIDCHandler(handler, rp)
+	}
+}
+
+// JWT adds a middleware that requires a valid JWT for the path prefixes of the verifier rules and stores the claims in the request context.
+func JWT(verifier *JWTVerifier) HandlerMiddleware {
+	return func(handler http.Handler) http.Handler {
+		return JWTHandler(handler, verifier)
+	}
+}
+
+// SignedURL adds a middleware that rejects requests with 403 if the URL for a protected path has no valid signature or has expired.
+func SignedURL(verifier *SignedURLVerifier) HandlerMiddleware {
+	return func(handler http.Handler) http.Handler {
+		return SignedURLHandler(handler, verifier)
+	}
+}
+
+// RateLimit adds a middleware that rejects requests that exceed the rate limits with 429.
+// The registration is optional and has to be prepared via the RateLimitMetricsRegister function.
+func RateLimit(rateLimiter *RateLimiter, registration *RateLimitRegistration) HandlerMiddleware {
+	return func(handler http.Handler) http.Handler {
+		return RateLimitHandler(handler, rateLimiter, registration)
+	}
+}
+
 // H2C adds a middleware that adds a `Alt-Svc` HTTP-header to advertise http2
 func H2C(h2cPort uint16) HandlerMiddleware {
 	return func(handler http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Alt-Svc", "h2=\":"+strconv.FormatUint(uint64(h2cPort), 10)+"\"")
+			w.Header().Add("Alt-Svc", "h2=\":"+strconv.FormatUint(uint64(h2cPort), 10)+"\"")
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HTTP3 adds a middleware that adds a `Alt-Svc` HTTP-header to advertise HTTP/3 on the given UDP port
+func HTTP3(h3Port uint16) HandlerMiddleware {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Alt-Svc", "h3=\":"+strconv.FormatUint(uint64(h3Port), 10)+"\"")
 			handler.ServeHTTP(w, r)
 		})
 	}
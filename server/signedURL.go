@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// query parameters of signed URLs
+const (
+	signedURLExpires   = "expires"
+	signedURLIP        = "ip"
+	signedURLKeyID     = "kid"
+	signedURLSignature = "sig"
+)
+
+var (
+	// SignedURLKeyIDKey is the ContextKey under which the id of the key that has verified the signed URL is stored
+	SignedURLKeyIDKey      = &ContextKey{val: "signedURLKeyID"}
+	ErrInvalidSignedURLKey = errors.New("invalid signed url key")
+	errInvalidSignedURL    = errors.New("invalid signed url")
+)
+
+// SignedURLKey signs URLs either with an HMAC-SHA256 Secret or an Ed25519 key
+type SignedURLKey struct {
+	// ID is added to the URLs to select the key for the verification, so that several keys can be active during a rotation
+	ID string
+	// Secret is the HMAC-SHA256 secret
+	Secret []byte
+	// PublicKey verifies Ed25519 signatures
+	PublicKey ed25519.PublicKey
+	// PrivateKey is only required to sign URLs, the PublicKey is derived from it if not set
+	PrivateKey ed25519.PrivateKey
+}
+
+// validate checks that the key is either an HMAC or an Ed25519 key and derives the Ed25519 public key
+func (key *SignedURLKey) validate() error {
+	if key.ID == "" {
+		return fmt.Errorf("%w: the key id is required", ErrInvalidSignedURLKey)
+	}
+	if key.PublicKey == nil && key.PrivateKey != nil {
+		key.PublicKey, _ = key.PrivateKey.Public().(ed25519.PublicKey)
+	}
+	if (len(key.Secret) == 0) == (key.PublicKey == nil) {
+		return fmt.Errorf("%w: key %s has to have either a secret or an ed25519 key", ErrInvalidSignedURLKey, key.ID)
+	}
+	if key.PublicKey != nil && len(key.PublicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("%w: key %s has an invalid ed25519 public key length %d", ErrInvalidSignedURLKey, key.ID, len(key.PublicKey))
+	}
+	return nil
+}
+
+// sign returns the signature of the message
+func (key *SignedURLKey) sign(message []byte) ([]byte, error) {
+	if len(key.Secret) > 0 {
+		mac := hmac.New(sha256.New, key.Secret)
+		mac.Write(message)
+		return mac.Sum(nil), nil
+	}
+	if len(key.PrivateKey) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("%w: key %s has no ed25519 private key", ErrInvalidSignedURLKey, key.ID)
+	}
+	return ed25519.Sign(key.PrivateKey, message), nil
+}
+
+// verify checks the signature of the message in constant time
+func (key *SignedURLKey) verify(message []byte, signature []byte) bool {
+	if len(key.Secret) > 0 {
+		mac := hmac.New(sha256.New, key.Secret)
+		mac.Write(message)
+		return hmac.Equal(mac.Sum(nil), signature)
+	}
+	return ed25519.Verify(key.PublicKey, message, signature)
+}
+
+// signedURLMessage is the signed part of the URL, the path and all query parameters apart from the signature
+func signedURLMessage(requestPath string, query url.Values) []byte {
+	query = maps.Clone(query)
+	query.Del(signedURLSignature)
+	return []byte(requestPath + "?" + query.Encode())
+}
+
+// SignURL adds the expiry, the key id, the optional client IP or CIDR and the signature to the query of the target URL,
+// which can be a path or an absolute URL. The signature covers the cleaned path and all query parameters.
+func SignURL(target string, key SignedURLKey, expires time.Time, clientIP string) (string, error) {
+	if err := key.validate(); err != nil {
+		return "", err
+	}
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return "", fmt.Errorf("invalid url %s: %w", target, err)
+	}
+	if !path.IsAbs(targetURL.Path) {
+		return "", fmt.Errorf("invalid url %s: the path has to be absolute", target)
+	}
+	// the request path is cleaned before the verification, see ValidateHandler
+	targetURL.Path = path.Clean(targetURL.Path)
+	targetURL.RawPath = ""
+	query := targetURL.Query()
+	query.Set(signedURLExpires, strconv.FormatInt(expires.Unix(), 10))
+	query.Set(signedURLKeyID, key.ID)
+	query.Del(signedURLIP)
+	if clientIP != "" {
+		if _, err := parsePrefix(clientIP); err != nil {
+			return "", err
+		}
+		query.Set(signedURLIP, clientIP)
+	}
+	signature, err := key.sign(signedURLMessage(targetURL.EscapedPath(), query))
+	if err != nil {
+		return "", err
+	}
+	query.Set(signedURLSignature, base64.RawURLEncoding.EncodeToString(signature))
+	targetURL.RawQuery = query.Encode()
+	return targetURL.String(), nil
+}
+
+// SignedURLVerifier verifies the signed URLs for the path prefixes
+type SignedURLVerifier struct {
+	keys     map[string]SignedURLKey
+	prefixes []string
+}
+
+// NewSignedURLVerifier validates the keys, all keys are accepted for the verification. All paths are protected if no prefixes are given.
+func NewSignedURLVerifier(keys []SignedURLKey, prefixes ...string) (*SignedURLVerifier, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: at least one key is required", ErrInvalidSignedURLKey)
+	}
+	verifier := &SignedURLVerifier{keys: make(map[string]SignedURLKey, len(keys)), prefixes: prefixes}
+	for _, key := range keys {
+		if err := key.validate(); err != nil {
+			return nil, err
+		}
+		if _, ok := verifier.keys[key.ID]; ok {
+			return nil, fmt.Errorf("%w: duplicate key id %s", ErrInvalidSignedURLKey, key.ID)
+		}
+		verifier.keys[key.ID] = key
+	}
+	return verifier, nil
+}
+
+// verify checks the signature, the expiry and the client IP binding of the request URL
+func (verifier *SignedURLVerifier) verify(r *http.Request) error {
+	query := r.URL.Query()
+	key, ok := verifier.keys[query.Get(signedURLKeyID)]
+	if !ok {
+		return fmt.Errorf("%w: unknown key id %s", errInvalidSignedURL, query.Get(signedURLKeyID))
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(query.Get(signedURLSignature))
+	if err != nil || !key.verify(signedURLMessage(r.URL.EscapedPath(), query), signature) {
+		return fmt.Errorf("%w: invalid signature", errInvalidSignedURL)
+	}
+	expires, err := strconv.ParseInt(query.Get(signedURLExpires), 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return fmt.Errorf("%w: expired", errInvalidSignedURL)
+	}
+	if clientIP := query.Get(signedURLIP); clientIP != "" {
+		prefix, err := parsePrefix(clientIP)
+		if err != nil || !prefix.Contains(GetClientIP(r)) {
+			return fmt.Errorf("%w: bound to %s", errInvalidSignedURL, clientIP)
+		}
+	}
+	return nil
+}
+
+// SignedURLHandler answers with 403 if the URL for a protected path prefix has no valid signature, has expired
+// or is bound to another client IP, see GetClientIP. The request path has to be cleaned beforehand, see ValidateHandler.
+// The key id is stored in the request context, requests that have already been verified before an internal rewrite are passed on,
+// as the signature covers the original path.
+func SignedURLHandler(next http.Handler, verifier *SignedURLVerifier) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, verified := r.Context().Value(SignedURLKeyIDKey).(string); verified || !hasAnyPathPrefix(r.URL.Path, verifier.prefixes) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := verifier.verify(r); err != nil {
+			log.Ctx(r.Context()).Debug().Err(err).Msgf("Rejected signed url for %s", r.URL.Path)
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), SignedURLKeyIDKey, r.URL.Query().Get(signedURLKeyID))))
+	})
+}
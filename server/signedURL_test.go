@@ -0,0 +1,159 @@
+package server_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/stretchr/testify/require"
+)
+
+func signedURLKeys(t *testing.T) (server.SignedURLKey, server.SignedURLKey) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return server.SignedURLKey{ID: "hmac", Secret: []byte("0123456789abcdef0123456789abcdef")},
+		server.SignedURLKey{ID: "ed", PrivateKey: privateKey}
+}
+
+func signedURLRequest(handler http.Handler, target string, remoteAddr string) int {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.RemoteAddr = remoteAddr
+	handler.ServeHTTP(w, r)
+	return w.Code
+}
+
+func signURL(t *testing.T, target string, key server.SignedURLKey, expires time.Time, clientIP string) string {
+	signed, err := server.SignURL(target, key, expires, clientIP)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestSignedURL(t *testing.T) {
+	hmacKey, edKey := signedURLKeys(t)
+	verifier, err := server.NewSignedURLVerifier([]server.SignedURLKey{hmacKey, {ID: edKey.ID, PublicKey: edKey.PrivateKey.Public().(ed25519.PublicKey)}}, "/downloads/")
+	require.NoError(t, err)
+	handler := server.SignedURLHandler(namedHandler("file"), verifier)
+	expires := time.Now().Add(time.Hour)
+
+	for _, key := range []server.SignedURLKey{hmacKey, edKey} {
+		signed := signURL(t, "/downloads/report.pdf?download=1", key, expires, "")
+		require.Equal(t, http.StatusOK, signedURLRequest(handler, signed, "192.0.2.1:1234"), key.ID)
+		parsed := mustParseURL(t, signed)
+		require.Equal(t, "1", parsed.Query().Get("download"))
+		require.Equal(t, key.ID, parsed.Query().Get("kid"))
+
+		tampered := map[string]func(query url.Values){
+			"expires":    func(query url.Values) { query.Set("expires", "9999999999") },
+			"parameter":  func(query url.Values) { query.Set("download", "2") },
+			"added":      func(query url.Values) { query.Add("extra", "1") },
+			"signature":  func(query url.Values) { query.Set("sig", "AAAA") },
+			"no sig":     func(query url.Values) { query.Del("sig") },
+			"unknown id": func(query url.Values) { query.Set("kid", "other") },
+		}
+		for name, modify := range tampered {
+			query := parsed.Query()
+			modify(query)
+			require.Equal(t, http.StatusForbidden, signedURLRequest(handler, parsed.Path+"?"+query.Encode(), "192.0.2.1:1234"), name)
+		}
+		require.Equal(t, http.StatusForbidden, signedURLRequest(handler, "/downloads/other.pdf?"+parsed.RawQuery, "192.0.2.1:1234"))
+	}
+	// unsigned URLs are rejected, paths without matching prefix are not protected
+	require.Equal(t, http.StatusForbidden, signedURLRequest(handler, "/downloads/report.pdf", "192.0.2.1:1234"))
+	require.Equal(t, http.StatusOK, signedURLRequest(handler, "/public/index.html", "192.0.2.1:1234"))
+}
+
+func TestSignedURLRewrite(t *testing.T) {
+	hmacKey, _ := signedURLKeys(t)
+	expires := time.Now().Add(time.Hour)
+	verifier, err := server.NewSignedURLVerifier([]server.SignedURLKey{hmacKey}, "/admin/")
+	require.NoError(t, err)
+	handler := server.SignedURLHandler(rewriteHandler(t, namedHandler("file"), server.SignedURL(verifier)), verifier)
+	require.Equal(t, http.StatusForbidden, signedURLRequest(handler, "/pub/a", "192.0.2.1:1234"))
+	require.Equal(t, http.StatusForbidden, signedURLRequest(handler, signURL(t, "/pub/a", hmacKey, expires, ""), "192.0.2.1:1234"))
+	require.Equal(t, http.StatusOK, signedURLRequest(handler, signURL(t, "/admin/a", hmacKey, expires, ""), "192.0.2.1:1234"))
+
+	// the signature of the original path is accepted for the rewritten path
+	verifier, err = server.NewSignedURLVerifier([]server.SignedURLKey{hmacKey}, "/admin/", "/pub/")
+	require.NoError(t, err)
+	handler = server.SignedURLHandler(rewriteHandler(t, namedHandler("file"), server.SignedURL(verifier)), verifier)
+	require.Equal(t, http.StatusOK, signedURLRequest(handler, signURL(t, "/pub/a", hmacKey, expires, ""), "192.0.2.1:1234"))
+}
+
+func TestSignedURLExpiry(t *testing.T) {
+	hmacKey, _ := signedURLKeys(t)
+	verifier, err := server.NewSignedURLVerifier([]server.SignedURLKey{hmacKey})
+	require.NoError(t, err)
+	handler := server.SignedURLHandler(namedHandler("file"), verifier)
+	require.Equal(t, http.StatusForbidden, signedURLRequest(handler, signURL(t, "/report.pdf", hmacKey, time.Now().Add(-time.Second), ""), "192.0.2.1:1234"))
+	require.Equal(t, http.StatusOK, signedURLRequest(handler, signURL(t, "/report.pdf", hmacKey, time.Now().Add(time.Minute), ""), "192.0.2.1:1234"))
+}
+
+func TestSignedURLClientIP(t *testing.T) {
+	hmacKey, _ := signedURLKeys(t)
+	verifier, err := server.NewSignedURLVerifier([]server.SignedURLKey{hmacKey})
+	require.NoError(t, err)
+	resolver, err := server.NewClientIPResolver("X-Forwarded-For", "10.0.0.0/8")
+	require.NoError(t, err)
+	handler := server.RealIPHandler(server.SignedURLHandler(namedHandler("file"), verifier), resolver)
+	expires := time.Now().Add(time.Hour)
+
+	signed := signURL(t, "/report.pdf", hmacKey, expires, "192.0.2.1")
+	require.Equal(t, http.StatusOK, signedURLRequest(handler, signed, "192.0.2.1:1234"))
+	require.Equal(t, http.StatusForbidden, signedURLRequest(handler, signed, "192.0.2.2:1234"))
+	signed = signURL(t, "/report.pdf", hmacKey, expires, "192.0.2.0/24")
+	require.Equal(t, http.StatusOK, signedURLRequest(handler, signed, "192.0.2.2:1234"))
+	require.Equal(t, http.StatusForbidden, signedURLRequest(handler, signed, "198.51.100.1:1234"))
+
+	// the client IP is resolved behind trusted proxies
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, signURL(t, "/report.pdf", hmacKey, expires, "192.0.2.1"), nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "192.0.2.1")
+	handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestSignedURLKeyRotation(t *testing.T) {
+	hmacKey, edKey := signedURLKeys(t)
+	oldURL := signURL(t, "/report.pdf", hmacKey, time.Now().Add(time.Hour), "")
+	newURL := signURL(t, "/report.pdf", edKey, time.Now().Add(time.Hour), "")
+
+	// both keys are active during the rotation
+	verifier, err := server.NewSignedURLVerifier([]server.SignedURLKey{edKey, hmacKey})
+	require.NoError(t, err)
+	handler := server.SignedURLHandler(namedHandler("file"), verifier)
+	require.Equal(t, http.StatusOK, signedURLRequest(handler, oldURL, "192.0.2.1:1234"))
+	require.Equal(t, http.StatusOK, signedURLRequest(handler, newURL, "192.0.2.1:1234"))
+
+	verifier, err = server.NewSignedURLVerifier([]server.SignedURLKey{edKey})
+	require.NoError(t, err)
+	handler = server.SignedURLHandler(namedHandler("file"), verifier)
+	require.Equal(t, http.StatusForbidden, signedURLRequest(handler, oldURL, "192.0.2.1:1234"))
+	require.Equal(t, http.StatusOK, signedURLRequest(handler, newURL, "192.0.2.1:1234"))
+}
+
+func TestSignURL(t *testing.T) {
+	hmacKey, edKey := signedURLKeys(t)
+	expires := time.Unix(1700000000, 0)
+	signed := signURL(t, "https://files.example.com/downloads/../downloads//a%20b.pdf", hmacKey, expires, "")
+	parsed := mustParseURL(t, signed)
+	require.Equal(t, "files.example.com", parsed.Host)
+	require.Equal(t, "/downloads/a%20b.pdf", parsed.EscapedPath())
+	require.Equal(t, "1700000000", parsed.Query().Get("expires"))
+
+	publicOnly := server.SignedURLKey{ID: "ed", PublicKey: edKey.PrivateKey.Public().(ed25519.PublicKey)}
+	_, err := server.SignURL("/a.pdf", publicOnly, expires, "")
+	require.ErrorIs(t, err, server.ErrInvalidSignedURLKey)
+	_, err = server.SignURL("/a.pdf", server.SignedURLKey{ID: "none"}, expires, "")
+	require.ErrorIs(t, err, server.ErrInvalidSignedURLKey)
+	_, err = server.SignURL("/a.pdf", hmacKey, expires, "not-an-ip")
+	require.Error(t, err)
+	_, err = server.NewSignedURLVerifier([]server.SignedURLKey{hmacKey, hmacKey})
+	require.ErrorIs(t, err, server.ErrInvalidSignedURLKey)
+}
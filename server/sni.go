@@ -0,0 +1,105 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ErrNoDefaultCertificate = errors.New("no default certificate configured")
+	ErrDuplicateSNIName     = errors.New("duplicate SNI name")
+)
+
+var SNILabel = "sni"
+
+// SNICertificates selects the certificate for a TLS handshake by the server name indication (SNI) of the client.
+// Exact names take precedence over wildcards like *.example.com, which match a single label as usual for certificates.
+// The default certificate is used if no name matches or the client did not send a server name.
+type SNICertificates struct {
+	defaultCert *CertReloader
+	certs       map[string]*CertReloader
+}
+
+// NewSNICertificates returns SNICertificates with the given default certificate and without any SNI names
+func NewSNICertificates(defaultCert *CertReloader) (*SNICertificates, error) {
+	if defaultCert == nil {
+		return nil, ErrNoDefaultCertificate
+	}
+	return &SNICertificates{defaultCert: defaultCert, certs: make(map[string]*CertReloader)}, nil
+}
+
+// Add registers the certificate for the SNI names, wildcards like *.example.com are supported.
+// It is not safe to call Add concurrently with handshakes.
+func (sni *SNICertificates) Add(reloader *CertReloader, names ...string) error {
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if _, ok := sni.certs[name]; ok {
+			return fmt.Errorf("%w: %s", ErrDuplicateSNIName, name)
+		}
+		sni.certs[name] = reloader
+	}
+	return nil
+}
+
+// get returns the certificate reloader for the server name
+func (sni *SNICertificates) get(serverName string) *CertReloader {
+	serverName = strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if reloader, ok := sni.certs[serverName]; ok {
+		return reloader
+	}
+	if _, parent, ok := strings.Cut(serverName, "."); ok {
+		if reloader, ok := sni.certs["*."+parent]; ok {
+			return reloader
+		}
+	}
+	return sni.defaultCert
+}
+
+// GetCertificate returns the current certificate for the server name of the client hello, it can be used as tls.Config.GetCertificate.
+func (sni *SNICertificates) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return sni.get(hello.ServerName).Certificate(), nil
+}
+
+// certExpiryCollector exports the expiry of the current certificates per SNI name
+type certExpiryCollector struct {
+	sni  *SNICertificates
+	desc *prometheus.Desc
+}
+
+// Describe implements prometheus.Collector
+func (collector *certExpiryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.desc
+}
+
+// Collect implements prometheus.Collector. The certificates are read on every scrape, so reloaded certificates are always reflected.
+func (collector *certExpiryCollector) Collect(ch chan<- prometheus.Metric) {
+	collect := func(name string, reloader *CertReloader) {
+		cert := reloader.Certificate()
+		if cert == nil || cert.Leaf == nil {
+			return
+		}
+		ch <- prometheus.MustNewConstMetric(collector.desc, prometheus.GaugeValue, float64(cert.Leaf.NotAfter.Unix()), name)
+	}
+	collect("", collector.sni.defaultCert)
+	for name, reloader := range collector.sni.certs {
+		collect(name, reloader)
+	}
+}
+
+// CertExpiryMetricsRegister registrates a gauge with the expiry time (unix seconds) of the current certificate per SNI name.
+// The default certificate has an empty SNI label.
+func CertExpiryMetricsRegister(registerer prometheus.Registerer, prometheusNamespace string, sni *SNICertificates) error {
+	collector := &certExpiryCollector{
+		sni: sni,
+		desc: prometheus.NewDesc(prometheus.BuildFQName(prometheusNamespace, "tls", "certificate_expiry_timestamp_seconds"),
+			"Expiry time of the TLS certificate in seconds since the unix epoch.", []string{SNILabel}, nil),
+	}
+	if err := registerer.Register(collector); err != nil {
+		return fmt.Errorf("failed to register certificate_expiry_timestamp_seconds metric: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package server_test
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func getSNICertificates(ctx context.Context, t *testing.T, dir string) *server.SNICertificates {
+	certFile, keyFile := writeCert(t, dir, "default", "default")
+	defaultCert, err := server.NewCertReloader(ctx, certFile, keyFile, certReloadDebounce)
+	require.NoError(t, err)
+	sni, err := server.NewSNICertificates(defaultCert)
+	require.NoError(t, err)
+
+	certFile, keyFile = writeCert(t, dir, "exact", "exact", "www.example.com")
+	exactCert, err := server.NewCertReloader(ctx, certFile, keyFile, certReloadDebounce)
+	require.NoError(t, err)
+	require.NoError(t, sni.Add(exactCert, "www.example.com"))
+
+	certFile, keyFile = writeCert(t, dir, "wildcard", "wildcard", "*.example.com", "example.com")
+	wildcardCert, err := server.NewCertReloader(ctx, certFile, keyFile, certReloadDebounce)
+	require.NoError(t, err)
+	require.NoError(t, sni.Add(wildcardCert, "*.example.com", "example.com"))
+	return sni
+}
+
+func TestSNICertificates(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sni := getSNICertificates(ctx, t, t.TempDir())
+
+	for serverName, expected := range map[string]string{
+		"www.example.com":     "exact",
+		"WWW.Example.com.":    "exact",
+		"api.example.com":     "wildcard",
+		"example.com":         "wildcard",
+		"a.api.example.com":   "default",
+		"other.org":           "default",
+		"":                    "default",
+		"www.example.com.org": "default",
+	} {
+		cert, err := sni.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+		require.NoError(t, err)
+		require.Equal(t, expected, getCommonName(t, cert), serverName)
+	}
+}
+
+func TestSNICertificatesReload(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := t.TempDir()
+	sni := getSNICertificates(ctx, t, dir)
+
+	writeCert(t, dir, "exact", "exact-new", "www.example.com")
+	require.Eventually(t, func() bool {
+		cert, err := sni.GetCertificate(&tls.ClientHelloInfo{ServerName: "www.example.com"})
+		return err == nil && getCommonName(t, cert) == "exact-new"
+	}, time.Second, certReloadDebounce)
+	cert, err := sni.GetCertificate(&tls.ClientHelloInfo{ServerName: "api.example.com"})
+	require.NoError(t, err)
+	require.Equal(t, "wildcard", getCommonName(t, cert))
+}
+
+func TestSNICertificatesInvalid(t *testing.T) {
+	_, err := server.NewSNICertificates(nil)
+	require.ErrorIs(t, err, server.ErrNoDefaultCertificate)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sni := getSNICertificates(ctx, t, t.TempDir())
+	certFile, keyFile := writeCert(t, t.TempDir(), "duplicate", "duplicate")
+	reloader, err := server.NewCertReloader(ctx, certFile, keyFile, certReloadDebounce)
+	require.NoError(t, err)
+	require.ErrorIs(t, sni.Add(reloader, "WWW.example.com"), server.ErrDuplicateSNIName)
+}
+
+func TestCertExpiryMetrics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sni := getSNICertificates(ctx, t, t.TempDir())
+	registry := prometheus.NewRegistry()
+	require.NoError(t, server.CertExpiryMetricsRegister(registry, "test", sni))
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 1)
+	require.Equal(t, "test_tls_certificate_expiry_timestamp_seconds", families[0].GetName())
+	expiries := make(map[string]float64)
+	for _, metric := range families[0].GetMetric() {
+		require.Len(t, metric.GetLabel(), 1)
+		expiries[metric.GetLabel()[0].GetValue()] = metric.GetGauge().GetValue()
+	}
+	require.Len(t, expiries, 4)
+	for _, name := range []string{"", "www.example.com", "*.example.com", "example.com"} {
+		require.InDelta(t, float64(time.Now().Add(time.Hour).Unix()), expiries[name], 60, name)
+	}
+}
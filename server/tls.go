@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrInvalidTLSVersion  = errors.New("invalid TLS version, only 1.0, 1.1, 1.2 and 1.3 are valid")
+	ErrInvalidCipherSuite = errors.New("unknown or insecure TLS cipher suite")
+)
+
+// tlsVersions maps the configuration values to the crypto/tls versions
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseTLSVersion converts a TLS version like 1.2 to the corresponding crypto/tls constant.
+func ParseTLSVersion(version string) (uint16, error) {
+	result, ok := tlsVersions[version]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidTLSVersion, version)
+	}
+	return result, nil
+}
+
+// ParseCipherSuites converts the cipher suite names as used by crypto/tls, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, to their IDs.
+// Only secure cipher suites are accepted. The cipher suites of TLS 1.3 are not configurable, see tls.Config.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	result := make([]uint16, len(names))
+	for i, name := range names {
+		found := false
+		for _, suite := range tls.CipherSuites() {
+			if suite.Name == name {
+				result[i] = suite.ID
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCipherSuite, name)
+		}
+	}
+	return result, nil
+}
+
+// CertReloader holds a TLS certificate and reloads it when the certificate or key file changes.
+// The directories of the files are watched, so the atomic symlink swaps of Kubernetes secret volumes are also picked up.
+// Established connections are not affected by a reload, the new certificate is used for all following handshakes.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+}
+
+// NewCertReloader loads the certificate and watches the files for changes till the context is cancelled.
+// A reload is executed once no further change has been observed for the debounce duration.
+func NewCertReloader(ctx context.Context, certFile string, keyFile string, debounce time.Duration) (*CertReloader, error) {
+	reloader := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := reloader.Reload(); err != nil {
+		return nil, err
+	}
+	if err := watchFiles(ctx, "tls certificate", debounce, reloader.Reload, certFile, keyFile); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// Reload reads the certificate and key files. The previous certificate is kept on errors.
+func (reloader *CertReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(reloader.certFile, reloader.keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading TLS certificate %s: %w", reloader.certFile, err)
+	}
+	reloader.cert.Store(&cert)
+	return nil
+}
+
+// Certificate returns the current certificate
+func (reloader *CertReloader) Certificate() *tls.Certificate {
+	return reloader.cert.Load()
+}
+
+// GetCertificate returns the current certificate, it can be used as tls.Config.GetCertificate.
+func (reloader *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return reloader.cert.Load(), nil
+}
+
+// TLSConfig returns a TLS configuration with the given minimal version and cipher suites that uses getCertificate for the handshakes.
+func TLSConfig(minVersion uint16, cipherSuites []uint16, getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) *tls.Config {
+	return &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		GetCertificate: getCertificate,
+	}
+}
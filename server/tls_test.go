@@ -0,0 +1,112 @@
+package server_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/stretchr/testify/require"
+)
+
+const certReloadDebounce = 10 * time.Millisecond
+
+// generateCert creates a self-signed certificate for the given DNS names and returns the PEM encoded certificate and key
+func generateCert(t *testing.T, commonName string, dnsNames ...string) (certPEM []byte, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+// writeCert generates a self-signed certificate and writes it to dir/name.crt and dir/name.key
+func writeCert(t *testing.T, dir string, name string, commonName string, dnsNames ...string) (certFile string, keyFile string) {
+	certPEM, keyPEM := generateCert(t, commonName, dnsNames...)
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0o600))
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+	return
+}
+
+func getCommonName(t *testing.T, cert *tls.Certificate) string {
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return parsed.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "tls", "old")
+
+	reloader, err := server.NewCertReloader(ctx, certFile, keyFile, certReloadDebounce)
+	require.NoError(t, err)
+	cert, err := reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, "old", getCommonName(t, cert))
+
+	writeCert(t, dir, "tls", "new")
+	require.Eventually(t, func() bool {
+		return getCommonName(t, reloader.Certificate()) == "new"
+	}, time.Second, certReloadDebounce)
+}
+
+func TestCertReloaderKeepsCertOnError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "tls", "old")
+
+	reloader, err := server.NewCertReloader(ctx, certFile, keyFile, certReloadDebounce)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certFile, []byte("invalid"), 0o600))
+	require.Error(t, reloader.Reload())
+	require.Equal(t, "old", getCommonName(t, reloader.Certificate()))
+}
+
+func TestNewCertReloaderMissingFile(t *testing.T) {
+	_, err := server.NewCertReloader(context.Background(), filepath.Join(t.TempDir(), "missing.crt"), "missing.key", certReloadDebounce)
+	require.Error(t, err)
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	version, err := server.ParseTLSVersion("1.3")
+	require.NoError(t, err)
+	require.Equal(t, uint16(tls.VersionTLS13), version)
+	_, err = server.ParseTLSVersion("1.4")
+	require.ErrorIs(t, err, server.ErrInvalidTLSVersion)
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	suites, err := server.ParseCipherSuites([]string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"})
+	require.NoError(t, err)
+	require.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, suites)
+	_, err = server.ParseCipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"})
+	require.ErrorIs(t, err, server.ErrInvalidCipherSuite)
+}
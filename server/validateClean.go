@@ -3,13 +3,19 @@ package server
 import (
 	"net/http"
 	"path"
+	"slices"
+	"strings"
 )
 
 // ValidateHandler returns HTTP 405 if the request method is not GET or HEAD.
+// Requests whose cleaned path has one of the proxyPrefixes are exempted from the method check and keep their trailing slash.
 // Also, pa relative paths are rejected with HTTP 400.
-func ValidateHandler(next http.Handler) http.Handler {
+func ValidateHandler(next http.Handler, proxyPrefixes ...string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		isProxied := len(proxyPrefixes) > 0 && path.IsAbs(r.URL.Path) && slices.ContainsFunc(proxyPrefixes, func(prefix string) bool {
+			return hasPathPrefix(path.Clean(r.URL.Path), prefix)
+		})
+		if !isProxied && r.Method != http.MethodGet && r.Method != http.MethodHead {
 			http.Error(w, "This server only supports HTTP methods GET and HEAD", http.StatusMethodNotAllowed)
 			return
 		}
@@ -18,7 +24,11 @@ func ValidateHandler(next http.Handler) http.Handler {
 			return
 		}
 
-		r.URL.Path = path.Clean(r.URL.Path)
+		cleanPath := path.Clean(r.URL.Path)
+		if isProxied && strings.HasSuffix(r.URL.Path, "/") && cleanPath != "/" {
+			cleanPath += "/"
+		}
+		r.URL.Path = cleanPath
 		next.ServeHTTP(w, r)
 	})
 }
@@ -54,3 +54,22 @@ func TestCleanPathTransversalAttack(t *testing.T) {
 	}()
 	require.Equal(t, "/a/c", r.URL.Path)
 }
+
+func TestValidateProxyPrefix(t *testing.T) {
+	for requestPath, expected := range map[string]string{
+		"/api/users/":    "/api/users/",
+		"/api":           "/api",
+		"/api/../users/": "",
+	} {
+		w, r, next := getDefaultHandlerMocks()
+		r.Method = http.MethodPost
+		r.URL = &url.URL{Path: requestPath}
+		server.ValidateHandler(next, "/api/").ServeHTTP(w, r)
+		if expected == "" {
+			require.Equal(t, http.StatusMethodNotAllowed, w.Code, requestPath)
+			continue
+		}
+		require.Equal(t, http.StatusOK, w.Code, requestPath)
+		require.Equal(t, expected, next.r.URL.Path, requestPath)
+	}
+}
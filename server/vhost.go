@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// VirtualHost serves the requests for the Hosts with its own Handler
+type VirtualHost struct {
+	// Hosts are the host names (without port), wildcards like *.example.com match all subdomains
+	Hosts   []string
+	Handler http.Handler
+}
+
+// wildcardHost is a wildcard host name like *.example.com with its handler
+type wildcardHost struct {
+	host    string
+	handler http.Handler
+}
+
+// VirtualHostHandler dispatches the requests by their Host header to the handler of the matching VirtualHost.
+// Exact host names take precedence over wildcards, the wildcard with the longest domain wins.
+// Requests for unknown hosts are passed to the defaultHandler or answered with 404 if it is nil.
+func VirtualHostHandler(defaultHandler http.Handler, vhosts ...VirtualHost) http.Handler {
+	exact := make(map[string]http.Handler)
+	var wildcards []wildcardHost
+	for _, vhost := range vhosts {
+		for _, host := range vhost.Hosts {
+			host = strings.ToLower(host)
+			if strings.HasPrefix(host, "*.") {
+				wildcards = append(wildcards, wildcardHost{host: host, handler: vhost.Handler})
+				continue
+			}
+			exact[host] = vhost.Handler
+		}
+	}
+	slices.SortStableFunc(wildcards, func(a wildcardHost, b wildcardHost) int {
+		return len(b.host) - len(a.host)
+	})
+	if defaultHandler == nil {
+		defaultHandler = http.NotFoundHandler()
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+		if handler, ok := exact[host]; ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		for _, wildcard := range wildcards {
+			if matchesHost(wildcard.host, host) {
+				wildcard.handler.ServeHTTP(w, r)
+				return
+			}
+		}
+		log.Debug().Msgf("No virtual host configured for %s, using the default", r.Host)
+		defaultHandler.ServeHTTP(w, r)
+	})
+}
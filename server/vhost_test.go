@@ -0,0 +1,50 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/stretchr/testify/require"
+)
+
+// namedHandler answers with its name as body
+func namedHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(name))
+	})
+}
+
+func TestVirtualHostHandler(t *testing.T) {
+	handler := server.VirtualHostHandler(namedHandler("default"),
+		server.VirtualHost{Hosts: []string{"example.com", "www.example.com"}, Handler: namedHandler("marketing")},
+		server.VirtualHost{Hosts: []string{"*.example.com"}, Handler: namedHandler("wildcard")},
+		server.VirtualHost{Hosts: []string{"*.docs.example.com", "Docs.example.com"}, Handler: namedHandler("docs")},
+	)
+	for host, expected := range map[string]string{
+		"example.com":          "marketing",
+		"WWW.example.com:8080": "marketing",
+		"www.example.com.":     "marketing",
+		"app.example.com":      "wildcard",
+		"docs.example.com":     "docs",
+		"v1.docs.example.com":  "docs",
+		"example.org":          "default",
+		"":                     "default",
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Host = host
+		handler.ServeHTTP(w, r)
+		require.Equal(t, expected, w.Body.String(), host)
+	}
+}
+
+func TestVirtualHostHandlerWithoutDefault(t *testing.T) {
+	handler := server.VirtualHostHandler(nil, server.VirtualHost{Hosts: []string{"example.com"}, Handler: namedHandler("marketing")})
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Host = "example.org"
+	handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,143 @@
+package acme_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/pebble/v2/ca"
+	"github.com/letsencrypt/pebble/v2/db"
+	"github.com/letsencrypt/pebble/v2/va"
+	"github.com/letsencrypt/pebble/v2/wfe"
+	"github.com/miekg/dns"
+	"github.com/ngergs/websrv/v5/server"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// acmeDomain is resolved to the loopback address by the startDNS resolver
+const acmeDomain = "websrv.localhost"
+
+// startDNS starts a DNS server for the pebble validation authority that resolves all A queries to the loopback address
+func startDNS(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	dnsServer := &dns.Server{Listener: l, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		for _, q := range r.Question {
+			if q.Qtype == dns.TypeA {
+				m.Answer = append(m.Answer, &dns.A{
+					Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+					A:   net.IPv4(127, 0, 0, 1),
+				})
+			}
+		}
+		_ = w.WriteMsg(m)
+	})}
+	go func() { _ = dnsServer.ActivateAndServe() }()
+	t.Cleanup(func() { _ = dnsServer.Shutdown() })
+	return l.Addr().String()
+}
+
+// startPebble starts an in-memory pebble ACME test CA that validates the challenges against the given local ports.
+// Returns the directory URL and an HTTP client that trusts the ACME endpoint.
+func startPebble(t *testing.T, httpPort int, tlsPort int) (directoryURL string, client *http.Client) {
+	t.Setenv("PEBBLE_VA_NOSLEEP", "1")
+	t.Setenv("PEBBLE_AUTHZREUSE", "0")
+	logger := log.New(io.Discard, "", 0)
+	store := db.NewMemoryStore()
+	certificateAuthority := ca.New(logger, store, "", "ecdsa", 0, 1, map[string]ca.Profile{"default": {ValidityPeriod: uint64((24 * time.Hour).Seconds())}})
+	validationAuthority := va.New(logger, httpPort, tlsPort, false, startDNS(t), store)
+	frontEnd := wfe.New(logger, store, validationAuthority, certificateAuthority, nil, false, false, 0, 0)
+	handler := frontEnd.Handler()
+	acmeServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// pebble finalizes asynchronously without the order Location header which is required by the acme client to poll the order
+		if orderID, ok := strings.CutPrefix(r.URL.Path, "/finalize-order/"); ok {
+			w.Header().Set("Location", "https://"+r.Host+"/my-order/"+orderID)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(acmeServer.Close)
+	return acmeServer.URL + "/dir", acmeServer.Client()
+}
+
+// getManager returns an ACME manager for the pebble test CA
+func getManager(cacheDir string, directoryURL string, client *http.Client) *autocert.Manager {
+	manager := server.NewACMEManager([]string{acmeDomain}, "test@example.com", cacheDir, directoryURL, 0)
+	manager.Client.HTTPClient = client
+	return manager
+}
+
+// listen opens a local TCP listener on a random port
+func listen(t *testing.T) (net.Listener, int) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	tcpAddr, ok := l.Addr().(*net.TCPAddr)
+	require.True(t, ok)
+	return l, tcpAddr.Port
+}
+
+// requireCert performs a TLS handshake against the listener and checks that an ACME certificate for the acmeDomain is presented
+func requireCert(t *testing.T, addr string) {
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: acmeDomain, InsecureSkipVerify: true}) //nolint:gosec // issued by the pebble test CA
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, conn.Close())
+	}()
+	certs := conn.ConnectionState().PeerCertificates
+	require.NotEmpty(t, certs)
+	require.NoError(t, certs[0].VerifyHostname(acmeDomain))
+	require.NotEqual(t, certs[0].Issuer.String(), certs[0].Subject.String())
+	_, err = certs[0].Verify(x509.VerifyOptions{Roots: x509.NewCertPool()})
+	require.Error(t, err, "certificate should be issued by the test CA and not be self-signed")
+}
+
+// unusedPort returns a local TCP port that refuses connections
+func unusedPort(t *testing.T) int {
+	l, port := listen(t)
+	require.NoError(t, l.Close())
+	return port
+}
+
+func TestACMETLSALPN01(t *testing.T) {
+	tlsListener, tlsPort := listen(t)
+	directoryURL, client := startPebble(t, unusedPort(t), tlsPort)
+	cacheDir := t.TempDir()
+	manager := getManager(cacheDir, directoryURL, client)
+
+	srv := &http.Server{Handler: server.HealthCheckHandler(), TLSConfig: server.ACMETLSConfig(manager, tls.VersionTLS12, nil), ReadHeaderTimeout: time.Minute}
+	go func() { _ = srv.ServeTLS(tlsListener, "", "") }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	requireCert(t, tlsListener.Addr().String())
+	_, err := os.Stat(filepath.Join(cacheDir, acmeDomain))
+	require.NoError(t, err)
+}
+
+func TestACMEHTTP01(t *testing.T) {
+	httpListener, httpPort := listen(t)
+	tlsListener, _ := listen(t)
+	// the tls port of the validation authority is not served, so the TLS-ALPN-01 challenge fails
+	directoryURL, client := startPebble(t, httpPort, unusedPort(t))
+	manager := getManager(t.TempDir(), directoryURL, client)
+
+	httpSrv := &http.Server{Handler: server.HTTPSRedirectHandler(443, server.ACMEHTTPHandler(manager)), ReadHeaderTimeout: time.Minute}
+	go func() { _ = httpSrv.Serve(httpListener) }()
+	t.Cleanup(func() { _ = httpSrv.Close() })
+	srv := &http.Server{Handler: server.HealthCheckHandler(), TLSConfig: server.ACMETLSConfig(manager, tls.VersionTLS12, nil), ReadHeaderTimeout: time.Minute}
+	go func() { _ = srv.ServeTLS(tlsListener, "", "") }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	requireCert(t, tlsListener.Addr().String())
+}